@@ -3,11 +3,14 @@ package redshiftdatasetannotator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strings"
 
+	"github.com/Songmu/prompter"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/quicksight"
 	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
@@ -16,33 +19,211 @@ import (
 )
 
 type AnnotateOption struct {
-	DataSetID              string `help:"task ID" required:""`
+	DataSetID              string `help:"task ID"`
+	DataSourceID           string `help:"Annotate all data sets using the data source, instead of --data-set-id"`
+	Schema                 string `help:"With --data-source-id, annotate only data sets using a table in the schema"`
+	Table                  string `help:"With --data-source-id, annotate only data sets using the table"`
+	AnnotationsFile        string `help:"Annotate with the fields of the YAML file written by export, instead of the column comments of Redshift" type:"path"`
 	DryRun                 bool   `help:"if true, no update data set and display plan"`
 	ForceRename            bool   `help:"The default is to keep any renaming that has already taken place. Enabling this option forces a name overwrite."`
 	ForceUpdateDescription bool   `help:"The default is to keep any renaming that has already taken place. Enabling this option forces a description overwrite."`
 	Verbose                bool   `help:"Outputs the input information for the UpdateDataSet API"`
+
+	OnConflict string `help:"Behavior when the data set is updated by someone else during annotate" enum:"abort,replan" default:"abort"`
+	MaxReplan  int    `help:"Maximum number of attempts with --on-conflict=replan" default:"3"`
+
+	BackupOption    `embed:""`
+	IngestionOption `embed:""`
+
+	InferGeographicRole        bool              `help:"Set geographic roles from well-known column names (e.g. country, prefecture, *_lat, *_lng)"`
+	GeographicRolePattern      map[string]string `help:"Set geographic roles from column name glob patterns (e.g. *_pref=STATE)"`
+	ForceUpdateGeographicRole  bool              `help:"The default is to keep any geographic role that has already been set. Enabling this option forces a geographic role overwrite."`
+	ApplyColumnLevelPermission bool              `help:"Apply the planned changes of ColumnLevelPermissionRules. Without this option, the changes are only displayed."`
+	FolderPrefix               map[string]string `help:"Put fields into field folders by column name prefix (e.g. addr_=Customer/Address)"`
+	ForceUpdateFolder          bool              `help:"The default is to keep any field folder that has already been set. Enabling this option forces moving fields between folders."`
+
+	RewriteFieldReferences bool `help:"Rewrite the references to renamed fields in analyses and dashboards using the data set, after confirmation"`
+	Yes                    bool `help:"With --rewrite-field-references, rewrite without confirmation" short:"y"`
+}
+
+func (opt *AnnotateOption) validate() error {
+	switch {
+	case opt.DataSetID != "" && opt.DataSourceID != "":
+		return errors.New("--data-set-id and --data-source-id can not be used together")
+	case opt.DataSetID == "" && opt.DataSourceID == "":
+		return errors.New("--data-set-id or --data-source-id is required")
+	case opt.DataSourceID == "" && (opt.Schema != "" || opt.Table != ""):
+		return errors.New("--schema and --table require --data-source-id")
+	}
+	return nil
 }
 
 func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
+	opt = app.settings.annotateOption(opt)
+	if err := opt.validate(); err != nil {
+		return err
+	}
 	if opt.DryRun {
 		log.Println("[info] ************* start dry run ****************")
+		defer log.Println("[info] *************  end dry run  ****************")
+	}
+	if opt.DataSetID != "" {
+		return app.annotateDataSet(ctx, opt, opt.DataSetID)
+	}
+	dataSetIDs, failed, err := app.findDataSetsByDataSource(ctx, opt.DataSourceID, opt.Schema, opt.Table)
+	if err != nil {
+		return err
+	}
+	log.Printf("[info] found %d data set(s) using data source %s", len(dataSetIDs), opt.DataSourceID)
+	total := len(dataSetIDs) + len(failed)
+	for _, dataSetID := range dataSetIDs {
+		log.Printf("[info] annotate data set %s", dataSetID)
+		if err := app.annotateDataSet(ctx, opt, dataSetID); err != nil {
+			log.Printf("[error] data set %s: %s", dataSetID, err)
+			failed = append(failed, dataSetID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to annotate %d of %d data set(s): %s", len(failed), total, strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (app *App) annotateDataSet(ctx context.Context, opt *AnnotateOption, dataSetID string) error {
+	var fileAnnotations *DataSetExport
+	if opt.AnnotationsFile != "" {
+		var err error
+		fileAnnotations, err = loadAnnotationsFile(opt.AnnotationsFile, dataSetID)
+		if err != nil {
+			return err
+		}
+	}
+	return app.updateDataSet(ctx, opt, dataSetID, func(dataSet *types.DataSet) (*quicksight.UpdateDataSetInput, map[string]string, bool, error) {
+		return app.planAnnotate(ctx, opt, dataSet, fileAnnotations)
+	})
+}
+
+// dataSetPlanner plans the UpdateDataSetInput of the data set, and returns the renamed fields (old name to new name) and whether the data set needs update.
+type dataSetPlanner func(dataSet *types.DataSet) (*quicksight.UpdateDataSetInput, map[string]string, bool, error)
+
+// updateDataSet plans the update of the data set, and updates it with the checks of concurrent updates, backups, field references and ingestions.
+func (app *App) updateDataSet(ctx context.Context, opt *AnnotateOption, dataSetID string, plan dataSetPlanner) error {
+	for attempt := 1; ; attempt++ {
+		describeDataSetOutput, err := app.describeDataSet(ctx, aws.String(app.AWSAccountID()), dataSetID)
+		if err != nil {
+			return err
+		}
+		log.Printf("[debug] data set `%s` name=`%s`", *describeDataSetOutput.DataSet.Arn, *describeDataSetOutput.DataSet.Name)
+		fingerprint, err := DataSetFingerprint(describeDataSetOutput.DataSet)
+		if err != nil {
+			return err
+		}
+		currentInput, err := NewUpdateDataSetInput(describeDataSetOutput.DataSet)
+		if err != nil {
+			return fmt.Errorf("NewUpdateDataSetInput: %w", err)
+		}
+		currentDataFingerprint, err := dataFingerprint(currentInput)
+		if err != nil {
+			return err
+		}
+		updateDataSetInput, renamedColumns, needUpdate, err := plan(describeDataSetOutput.DataSet)
+		if err != nil {
+			return err
+		}
+		if !needUpdate {
+			log.Printf("[info] no changes, skip update data set %s", dataSetID)
+			return nil
+		}
+		plannedDataFingerprint, err := dataFingerprint(updateDataSetInput)
+		if err != nil {
+			return err
+		}
+		metadataOnly := currentDataFingerprint == plannedDataFingerprint
+		log.Printf("[debug] metadata only changes=%v", metadataOnly)
+		if err := checkSpiceRefresh(opt.IngestionOption, updateDataSetInput, metadataOnly); err != nil {
+			return err
+		}
+		if opt.Verbose {
+			bs, err := json.MarshalIndent(updateDataSetInput, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(app.w, string(bs))
+		}
+		renamedColumns = changedFieldNames(describeDataSetOutput.DataSet, renamedColumns)
+		var rewrites []*fieldReferenceRewrite
+		if opt.RewriteFieldReferences {
+			rewrites, err = app.planFieldReferenceRewrites(ctx, coalesce(describeDataSetOutput.DataSet.Arn), renamedColumns)
+			if err != nil {
+				return err
+			}
+			if len(rewrites) > 0 {
+				log.Printf("[info] planned rewrites of field references in analyses and dashboards:")
+				printFieldReferenceRewrites(app.w, rewrites)
+			}
+		} else if len(renamedColumns) > 0 {
+			log.Printf("[warn] renamed fields may break analyses and dashboards using data set %s, re-run with --rewrite-field-references to rewrite them", dataSetID)
+		}
+		if opt.DryRun {
+			return nil
+		}
+		if len(rewrites) > 0 && !opt.Yes && !prompter.YesNo(fmt.Sprintf("Rewrite field references of %d analyses and dashboards?", len(rewrites)), false) {
+			return errors.New("rewrite of field references is not confirmed, abort annotate")
+		}
+		latest, err := app.checkConcurrentUpdate(ctx, describeDataSetOutput.DataSet, fingerprint)
+		if err != nil {
+			if errors.Is(err, ErrConcurrentUpdate) && opt.OnConflict == "replan" && attempt < opt.MaxReplan {
+				log.Printf("[warn] %v, re-plan annotations (attempt %d/%d)", err, attempt+1, opt.MaxReplan)
+				continue
+			}
+			return err
+		}
+		if _, err := app.BackupDataSet(ctx, opt.BackupOption, latest); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		output, err := app.client.UpdateDataSet(ctx, updateDataSetInput)
+		if err != nil {
+			return fmt.Errorf("UpdateDataSet:%w", err)
+		}
+		log.Printf("[info] updated data set %s ingestion=`%s`", dataSetID, coalesce(output.IngestionId))
+		// the data set is already updated, so the ingestion is handled even if some rewrites failed
+		rewriteErr := app.applyFieldReferenceRewrites(ctx, rewrites)
+		return errors.Join(rewriteErr, app.handleIngestion(ctx, opt.IngestionOption, updateDataSetInput, output, metadataOnly))
 	}
-	describeDataSetOutput, err := app.client.DescribeDataSet(ctx, &quicksight.DescribeDataSetInput{
-		AwsAccountId: aws.String(app.AWSAccountID()),
-		DataSetId:    aws.String(opt.DataSetID),
+}
+
+func (app *App) describeDataSet(ctx context.Context, awsAccountID *string, dataSetID string) (*quicksight.DescribeDataSetOutput, error) {
+	output, err := app.client.DescribeDataSet(ctx, &quicksight.DescribeDataSetInput{
+		AwsAccountId: awsAccountID,
+		DataSetId:    aws.String(dataSetID),
 	})
 	if err != nil {
-		return fmt.Errorf("DescribeDataSet:%w", err)
+		return nil, fmt.Errorf("DescribeDataSet:%w", err)
 	}
-	if describeDataSetOutput.Status != http.StatusOK {
-		return fmt.Errorf("unexpected data set status:%d", describeDataSetOutput.Status)
+	if output.Status != http.StatusOK {
+		return nil, fmt.Errorf("unexpected data set status:%d", output.Status)
 	}
-	log.Printf("[debug] data set `%s` name=`%s`", *describeDataSetOutput.DataSet.Arn, *describeDataSetOutput.DataSet.Name)
-	updateDataSetInput, err := NewUpdateDataSetInput(describeDataSetOutput.DataSet)
+	return output, nil
+}
+
+// planAnnotate builds the UpdateDataSetInput that annotates the data set, and reports whether the data set needs update.
+// The renamed fields (old name to new name) are also returned.
+// If fileAnnotations is not nil, the annotations are read from it instead of the column comments of Redshift.
+func (app *App) planAnnotate(ctx context.Context, opt *AnnotateOption, dataSet *types.DataSet, fileAnnotations *DataSetExport) (*quicksight.UpdateDataSetInput, map[string]string, bool, error) {
+	geographicRoles, err := newGeographicRoleMatcher(opt.InferGeographicRole, opt.GeographicRolePattern)
 	if err != nil {
-		return fmt.Errorf("NewUpdateDataSetInput: %w", err)
+		return nil, nil, false, err
+	}
+	folderPrefixes := newFolderPrefixMatcher(opt.FolderPrefix)
+	updateDataSetInput, err := NewUpdateDataSetInput(dataSet)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("NewUpdateDataSetInput: %w", err)
 	}
 	var needUpdate bool
+	renamedColumns := make(map[string]string)
+	hiddenColumns := make([]string, 0)
+	columnLevelPermissions := newColumnLevelPermissionPlan()
+	geoHierarchies := make(map[string]*geoHierarchy)
 	for physicalTableID, physicalTable := range updateDataSetInput.PhysicalTableMap {
 		log.Printf("[debug] found physical table `%s` in `%s`", physicalTableID, *updateDataSetInput.Name)
 		relationalTable, ok := physicalTable.(*types.PhysicalTableMemberRelationalTable)
@@ -52,20 +233,35 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 		}
 		describeDataSourceOutput, err := app.DescribeDataSrouce(ctx, *relationalTable.Value.DataSourceArn)
 		if err != nil {
-			return fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
+			return nil, nil, false, fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
 		}
 		if describeDataSourceOutput.DataSource.Type != types.DataSourceTypeRedshift {
 			log.Printf("[debug] physical table `%s` data source type is not redshift. type is `%s`", physicalTableID, describeDataSourceOutput.DataSource.Type)
 			continue
 		}
 		log.Printf("[debug] physical table `%s` data source `\"%s\".\"%s\"` in `%s`", physicalTableID, *relationalTable.Value.Schema, *relationalTable.Value.Name, *relationalTable.Value.DataSourceArn)
-		columnAnnotations, err := app.GetColumnAnnotations(ctx, describeDataSourceOutput.DataSource, relationalTable.Value)
+		var columnAnnotations ColumnAnnotations
+		if fileAnnotations != nil {
+			columnAnnotations = fileAnnotations.ColumnAnnotations(*relationalTable.Value.Schema, *relationalTable.Value.Name)
+		} else {
+			columnAnnotations, err = app.GetColumnAnnotations(ctx, describeDataSourceOutput.DataSource, relationalTable.Value)
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("GetColumnAnnotations: %w", err)
+			}
+		}
+		profile, _, err := app.redshiftProfile(ctx, describeDataSourceOutput.DataSource)
 		if err != nil {
-			return fmt.Errorf("GetColumnAnnotations: %w", err)
+			return nil, nil, false, fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
+		}
+		isHidden := func(physicalColumnName string) bool {
+			if columnAnnotation, ok := columnAnnotations[physicalColumnName]; ok && columnAnnotation.Hidden() {
+				return true
+			}
+			return matchHiddenColumn(profile.HiddenColumns, physicalColumnName)
 		}
 
 		for logicalTableID, logicalTable := range updateDataSetInput.LogicalTableMap {
-			if *logicalTable.Source.PhysicalTableId != physicalTableID {
+			if coalesce(logicalTable.Source.PhysicalTableId) != physicalTableID {
 				continue
 			}
 			log.Printf("[debug] logical table `%s` source physical table `%s`", logicalTableID, physicalTableID)
@@ -110,7 +306,22 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 				// check rename
 				var logicalColumnName string
 				oldColumnName := physicalColumnName
-				if columnAnnotation.Name != nil {
+				if columnAnnotation.Name != nil && *columnAnnotation.Name == physicalColumnName {
+					// the name of the column itself, that is no rename
+					logicalColumnName = physicalColumnName
+					if renameColumnOperation, ok := renameColumnOperations[physicalColumnName]; ok {
+						if opt.ForceRename {
+							oldColumnName = *renameColumnOperation.Value.NewColumnName
+							delete(renameColumnOperations, physicalColumnName)
+							log.Printf("[debug] drop rename column operation `%s` to `%s` in logical table `%s`", physicalColumnName, oldColumnName, logicalTableID)
+							log.Printf("[info] rename field for `%s`: rewrite `%s` to `%s`", physicalColumnName, oldColumnName, logicalColumnName)
+							needUpdate = true
+						} else {
+							logicalColumnName = *renameColumnOperation.Value.NewColumnName
+							log.Printf("[debug] keep rename column operation `%s` to `%s` in logical table `%s`", physicalColumnName, logicalColumnName, logicalTableID)
+						}
+					}
+				} else if columnAnnotation.Name != nil {
 					renameColumnOperation, ok := renameColumnOperations[physicalColumnName]
 					if !ok {
 						logicalColumnName = *columnAnnotation.Name
@@ -143,6 +354,7 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 
 				// Check the impact of rename
 				if oldColumnName != logicalColumnName {
+					renamedColumns[oldColumnName] = logicalColumnName
 					//check cast operation
 					if op, ok := castColumnOperations[oldColumnName]; ok {
 						op.Value.ColumnName = aws.String(logicalColumnName)
@@ -216,69 +428,174 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 						updateDataSetInput.ColumnLevelPermissionRules[i] = rule
 					}
 
+					//check FieldFolders
+					if renameFieldFolderColumns(updateDataSetInput.FieldFolders, oldColumnName, logicalColumnName) {
+						needUpdate = true
+					}
+
+					//check ColumnGroups
+					if renameColumnGroupColumns(updateDataSetInput.ColumnGroups, oldColumnName, logicalColumnName) {
+						needUpdate = true
+					}
+
+					//check RowLevelPermissionTagConfiguration
+					if renameRowLevelPermissionTagRuleColumns(updateDataSetInput.RowLevelPermissionTagConfiguration, oldColumnName, logicalColumnName) {
+						needUpdate = true
+					}
 				}
 
-				if columnAnnotation.Description == nil {
-					log.Printf("[debug] no description phyisical column `%s` in logical table `%s`", physicalColumnName, logicalTableID)
-					continue
+				// check cast
+				castType, err := columnAnnotation.CastType()
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("column `%s`: %w", physicalColumnName, err)
+				}
+				if castType != "" {
+					op, ok := castColumnOperations[logicalColumnName]
+					if !ok {
+						op = &types.TransformOperationMemberCastColumnTypeOperation{
+							Value: types.CastColumnTypeOperation{
+								ColumnName: aws.String(logicalColumnName),
+							},
+						}
+						castColumnOperations[logicalColumnName] = op
+					}
+					if op.Value.NewColumnType != castType {
+						op.Value.NewColumnType = castType
+						op.Value.SubType = ""
+						log.Printf("[info] Cast %s (`%s`) field to %s", logicalColumnName, physicalColumnName, castType)
+						needUpdate = true
+					}
 				}
 
 				// check tag
-				if tagColumnOperation, ok := tagColumnOperations[logicalColumnName]; !ok {
-					tagColumnOperations[logicalColumnName] = &types.TransformOperationMemberTagColumnOperation{
-						Value: types.TagColumnOperation{
-							ColumnName: aws.String(logicalColumnName),
-							Tags: []types.ColumnTag{
-								{
-									ColumnDescription: &types.ColumnDescription{
-										Text: aws.String(*columnAnnotation.Description),
-									},
-								},
-							},
+				if columnAnnotation.Description != nil {
+					tag := types.ColumnTag{
+						ColumnDescription: &types.ColumnDescription{
+							Text: aws.String(*columnAnnotation.Description),
 						},
 					}
-					log.Printf("[debug] new tag column operation for logical column `%s` in logical table `%s`", logicalColumnName, logicalTableID)
-					log.Printf("[info] Update %s (`%s`) field description", logicalColumnName, physicalColumnName)
-					needUpdate = true
+					if mergeColumnTag(tagColumnOperations, logicalColumnName, tag, opt.ForceUpdateDescription) {
+						log.Printf("[info] Update %s (`%s`) field description", logicalColumnName, physicalColumnName)
+						needUpdate = true
+					} else {
+						log.Printf("[debug] keep description of tag column operation `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+					}
 				} else {
-					var exists bool
-					for j, tag := range tagColumnOperation.Value.Tags {
-						if tag.ColumnDescription == nil {
-							continue
-						}
-						exists = true
-						currentDescription := strings.TrimSpace(*tag.ColumnDescription.Text)
-						if tag.ColumnDescription.Text != nil && currentDescription != "" {
-							if currentDescription != *columnAnnotation.Description && opt.ForceUpdateDescription {
-								log.Printf("[debug] keep tag column operation `%s` in logical table `%s`", logicalColumnName, logicalTableID)
-								tagColumnOperation.Value.Tags[j].ColumnDescription.Text = aws.String(*columnAnnotation.Description)
-								log.Printf("[info] Update %s (`%s`) field description", logicalColumnName, physicalColumnName)
-								needUpdate = true
-							} else {
-								log.Printf("[debug] keep tag column operation `%s` in logical table `%s`", logicalColumnName, logicalTableID)
-							}
-						} else {
-							log.Printf("[debug] tag column operation `%s` is empty, update description in logical table `%s`", logicalColumnName, logicalTableID)
-							tagColumnOperation.Value.Tags[j].ColumnDescription.Text = aws.String(*columnAnnotation.Description)
-							log.Printf("[info] Update %s (`%s`) field description", logicalColumnName, physicalColumnName)
-							needUpdate = true
-						}
-						break
+					log.Printf("[debug] no description phyisical column `%s` in logical table `%s`", physicalColumnName, logicalTableID)
+				}
+
+				// check geographic role
+				geographicRole, err := columnAnnotation.GeographicRole()
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("column `%s`: %w", physicalColumnName, err)
+				}
+				if geographicRole == "" {
+					if role, ok := geographicRoles.Match(physicalColumnName); ok {
+						log.Printf("[debug] physical column `%s` matches geographic role `%s` by column name", physicalColumnName, role)
+						geographicRole = role
 					}
-					if !exists {
-						tagColumnOperation.Value.Tags = append(
-							tagColumnOperation.Value.Tags,
-							types.ColumnTag{
-								ColumnDescription: &types.ColumnDescription{
-									Text: aws.String(*columnAnnotation.Description),
-								},
-							},
-						)
-						log.Printf("[debug] new tag column operation for logical column `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+				}
+				if geographicRole != "" {
+					tag := types.ColumnTag{
+						ColumnGeographicRole: geographicRole,
+					}
+					if mergeColumnTag(tagColumnOperations, logicalColumnName, tag, opt.ForceUpdateGeographicRole) {
+						log.Printf("[info] Update %s (`%s`) field geographic role to %s", logicalColumnName, physicalColumnName, geographicRole)
 						needUpdate = true
+					} else {
+						log.Printf("[debug] keep geographic role of tag column operation `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+					}
+				}
+
+				// check geographic hierarchy
+				hierarchyName, countryCode, err := columnAnnotation.GeoHierarchy()
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("column `%s`: %w", physicalColumnName, err)
+				}
+				if hierarchyName != "" {
+					if geographicRole == "" {
+						return nil, nil, false, fmt.Errorf("column `%s`: geographic hierarchy `%s` member requires geographic role", physicalColumnName, hierarchyName)
+					}
+					h, ok := geoHierarchies[hierarchyName]
+					if !ok {
+						h = &geoHierarchy{Name: hierarchyName}
+						geoHierarchies[hierarchyName] = h
 					}
+					if err := h.add(logicalColumnName, geographicRole, countryCode); err != nil {
+						return nil, nil, false, err
+					}
+				}
+
+				// check field folder
+				folderPath, ok := columnAnnotation.Folder()
+				if !ok {
+					folderPath, ok = folderPrefixes.Match(physicalColumnName)
+				}
+				if ok && isHidden(physicalColumnName) {
+					log.Printf("[debug] skip field folder of hidden column `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+				} else if ok {
+					if updateDataSetInput.FieldFolders == nil {
+						updateDataSetInput.FieldFolders = make(map[string]types.FieldFolder)
+					}
+					if setFieldFolder(updateDataSetInput.FieldFolders, folderPath, logicalColumnName, opt.ForceUpdateFolder) {
+						log.Printf("[info] Move %s (`%s`) field to folder `%s`", logicalColumnName, physicalColumnName, folderPath)
+						needUpdate = true
+					} else {
+						log.Printf("[debug] keep field folder of `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+					}
+				}
+
+				// check restricted column
+				if classification, ok := columnAnnotation.Restricted(); ok {
+					if isHidden(physicalColumnName) {
+						log.Printf("[debug] skip column level permission of hidden column `%s` in logical table `%s`", logicalColumnName, logicalTableID)
+					} else if err := columnLevelPermissions.Add(profile, classification, logicalColumnName); err != nil {
+						return nil, nil, false, err
+					}
+				}
+			}
+
+			// check hidden columns
+			columnNames := make([]string, 0, len(relationalTable.Value.InputColumns))
+			hiddenColumnNames := make([]string, 0)
+			for _, physicalColumn := range relationalTable.Value.InputColumns {
+				physicalColumnName := *physicalColumn.Name
+				logicalColumnName := physicalColumnName
+				if op, ok := renameColumnOperations[physicalColumnName]; ok {
+					logicalColumnName = *op.Value.NewColumnName
+				}
+				columnNames = append(columnNames, logicalColumnName)
+				if !isHidden(physicalColumnName) {
+					continue
+				}
+				err := checkHiddenColumnDependencies(columnDependencies{
+					ColumnLevelPermissionRules:         updateDataSetInput.ColumnLevelPermissionRules,
+					ColumnGroups:                       updateDataSetInput.ColumnGroups,
+					RowLevelPermissionTagConfiguration: updateDataSetInput.RowLevelPermissionTagConfiguration,
+					CreateColumnsOperations:            createColumnOperations,
+					FilterOperations:                   filterColumnOperations,
+				}, logicalColumnName)
+				if err != nil {
+					return nil, nil, false, fmt.Errorf("logical table `%s`: %w", logicalTableID, err)
 				}
+				hiddenColumnNames = append(hiddenColumnNames, logicalColumnName)
+				if removeFieldFolderColumns(updateDataSetInput.FieldFolders, logicalColumnName) {
+					needUpdate = true
+				}
+			}
+			for _, op := range createColumnOperations {
+				for _, column := range op.Value.Columns {
+					columnNames = append(columnNames, coalesce(column.ColumnName))
+				}
+			}
+			var projectChanged bool
+			projectOperations, projectChanged = hideColumns(projectOperations, columnNames, hiddenColumnNames)
+			if projectChanged {
+				log.Printf("[info] Hide fields %v in logical table `%s`", hiddenColumnNames, logicalTableID)
+				needUpdate = true
 			}
+			hiddenColumns = append(hiddenColumns, hiddenColumnNames...)
+
 			log.Printf("[debug] rebuild transform operations(rename:%d, tag:%d, others:%d) in logical table `%s`", len(renameColumnOperations), len(tagColumnOperations), len(otherOperations), logicalTableID)
 			transformOperations := make([]types.TransformOperation, 0, len(renameColumnOperations)+len(tagColumnOperations)+len(otherOperations)+1)
 			transformOperations = append(
@@ -299,6 +616,13 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 					},
 				)...,
 			)
+			// calculated fields are created before the tags, as the tags may describe them
+			transformOperations = append(transformOperations, lo.Map(
+				createColumnOperations,
+				func(op *types.TransformOperationMemberCreateColumnsOperation, _ int) types.TransformOperation {
+					return op
+				},
+			)...)
 			transformOperations = append(
 				transformOperations,
 				lo.Map(
@@ -317,12 +641,6 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 					},
 				)...,
 			)
-			transformOperations = append(transformOperations, lo.Map(
-				createColumnOperations,
-				func(op *types.TransformOperationMemberCreateColumnsOperation, _ int) types.TransformOperation {
-					return op
-				},
-			)...)
 			transformOperations = append(transformOperations, lo.Map(
 				filterColumnOperations,
 				func(op *types.TransformOperationMemberFilterOperation, _ int) types.TransformOperation {
@@ -340,25 +658,93 @@ func (app *App) RunAnnotate(ctx context.Context, opt *AnnotateOption) error {
 			updateDataSetInput.LogicalTableMap[logicalTableID] = logicalTable
 		}
 	}
-	if !needUpdate {
-		log.Printf("[info] no changes, skip update data set %s", opt.DataSetID)
-		return nil
-	}
-	if opt.Verbose {
-		bs, err := json.MarshalIndent(updateDataSetInput, "", "  ")
+	hierarchyNames := lo.Keys(geoHierarchies)
+	sort.Strings(hierarchyNames)
+	roles := columnGeographicRoles(updateDataSetInput.LogicalTableMap)
+	for _, hierarchyName := range hierarchyNames {
+		columnGroups, changed, err := setGeoSpatialColumnGroup(updateDataSetInput.ColumnGroups, geoHierarchies[hierarchyName], roles)
 		if err != nil {
-			return err
+			return nil, nil, false, err
+		}
+		updateDataSetInput.ColumnGroups = columnGroups
+		if changed {
+			log.Printf("[info] Update geographic hierarchy `%s`", hierarchyName)
+			needUpdate = true
 		}
-		fmt.Fprintln(app.w, string(bs))
 	}
-	if opt.DryRun {
-		log.Println("[info] *************  end dry run  ****************")
-		return nil
+	if err := app.checkRowLevelPermissionDataSet(ctx, updateDataSetInput.RowLevelPermissionDataSet, renamedColumns); err != nil {
+		return nil, nil, false, err
+	}
+	columnLevelPermissionRules, columnLevelPermissionChanges, err := columnLevelPermissions.Apply(updateDataSetInput.ColumnLevelPermissionRules)
+	if len(columnLevelPermissionChanges) > 0 {
+		log.Printf("[info] planned changes of ColumnLevelPermissionRules:")
+		printColumnLevelPermissionChanges(app.w, columnLevelPermissionChanges)
 	}
-	output, err := app.client.UpdateDataSet(ctx, updateDataSetInput)
 	if err != nil {
-		return fmt.Errorf("UpdateDataSet:%w", err)
+		if opt.ApplyColumnLevelPermission {
+			return nil, nil, false, err
+		}
+		log.Printf("[warn] %s", err)
 	}
-	log.Printf("[info] updated data set %s ingestion=`%s`", opt.DataSetID, coalesce(output.IngestionId))
-	return nil
+	if len(columnLevelPermissionChanges) > 0 {
+		if opt.ApplyColumnLevelPermission {
+			updateDataSetInput.ColumnLevelPermissionRules = columnLevelPermissionRules
+			needUpdate = true
+		} else {
+			log.Printf("[warn] ColumnLevelPermissionRules changes are not applied, review the changes and re-run with --apply-column-level-permission")
+		}
+	}
+	outputColumnNames := lo.Map(dataSet.OutputColumns, func(column types.OutputColumn, _ int) string {
+		name := coalesce(column.Name)
+		if renamed, ok := renamedColumns[name]; ok {
+			return renamed
+		}
+		return name
+	})
+	outputColumnNames = lo.Without(outputColumnNames, hiddenColumns...)
+	if err := validateColumnGroups(updateDataSetInput.ColumnGroups, outputColumnNames); err != nil {
+		return nil, nil, false, err
+	}
+	return updateDataSetInput, renamedColumns, needUpdate, nil
+}
+
+// mergeColumnTag merges tag into the tag column operation of the logical column.
+// Tags of other kinds (e.g. description and geographic role) are kept as is.
+// An existing non-empty tag of the same kind is only overwritten when force is true.
+// Reports whether the tag column operation has been changed.
+func mergeColumnTag(tagColumnOperations map[string]*types.TransformOperationMemberTagColumnOperation, logicalColumnName string, tag types.ColumnTag, force bool) bool {
+	tagColumnOperation, ok := tagColumnOperations[logicalColumnName]
+	if !ok {
+		tagColumnOperations[logicalColumnName] = &types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{
+				ColumnName: aws.String(logicalColumnName),
+				Tags:       []types.ColumnTag{tag},
+			},
+		}
+		log.Printf("[debug] new tag column operation for logical column `%s`", logicalColumnName)
+		return true
+	}
+	for i, current := range tagColumnOperation.Value.Tags {
+		switch {
+		case tag.ColumnDescription != nil && current.ColumnDescription != nil:
+			currentDescription := strings.TrimSpace(coalesce(current.ColumnDescription.Text))
+			if currentDescription == *tag.ColumnDescription.Text {
+				return false
+			}
+			if currentDescription != "" && !force {
+				return false
+			}
+		case tag.ColumnGeographicRole != "" && current.ColumnGeographicRole != "":
+			if current.ColumnGeographicRole == tag.ColumnGeographicRole || !force {
+				return false
+			}
+		default:
+			continue
+		}
+		tagColumnOperation.Value.Tags[i] = tag
+		return true
+	}
+	tagColumnOperation.Value.Tags = append(tagColumnOperation.Value.Tags, tag)
+	log.Printf("[debug] append tag to tag column operation for logical column `%s`", logicalColumnName)
+	return true
 }
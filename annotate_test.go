@@ -0,0 +1,59 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+	"github.com/samber/lo"
+)
+
+// runTestAnnotate annotates the data set users with the annotations file of export.
+func runTestAnnotate(t *testing.T, app *App, export *DataSetExport, opt *AnnotateOption) {
+	t.Helper()
+	annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opt.DataSetID = "users"
+	opt.AnnotationsFile = annotationsFile
+	opt.OnConflict = "abort"
+	opt.BackupOption = BackupOption{NoBackup: true}
+	opt.IngestionOption = IngestionOption{SpiceRefresh: "allow"}
+	if err := app.RunAnnotate(context.Background(), opt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnnotateUnrename(t *testing.T) {
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users", testRename("pref_code", "Prefecture")))
+	app := newTestApp(t, client, io.Discard)
+	runTestAnnotate(t, app, &DataSetExport{
+		DataSetID: "users",
+		Fields: []*FieldExport{
+			{Name: "pref_code", Source: "public.users.pref_code", Description: "prefecture code"},
+		},
+	}, &AnnotateOption{ForceRename: true, ForceUpdateDescription: true})
+
+	dataSet, _ := client.DataSet(testAWSAccountID, "users")
+	for _, transform := range dataSet.LogicalTableMap["logical"].DataTransforms {
+		switch op := transform.(type) {
+		case *types.TransformOperationMemberRenameColumnOperation:
+			t.Errorf("rename operation `%s` to `%s` is kept", aws.ToString(op.Value.ColumnName), aws.ToString(op.Value.NewColumnName))
+		case *types.TransformOperationMemberTagColumnOperation:
+			if got := aws.ToString(op.Value.ColumnName); got != "pref_code" {
+				t.Errorf("tag operation column = %s, want pref_code", got)
+			}
+		}
+	}
+	if !lo.ContainsBy(dataSet.OutputColumns, func(column types.OutputColumn) bool { return aws.ToString(column.Name) == "pref_code" }) {
+		t.Errorf("output columns do not contain pref_code: %v", dataSet.OutputColumns)
+	}
+}
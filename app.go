@@ -6,7 +6,9 @@ import (
 	"io"
 	"log"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
@@ -14,43 +16,112 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/quicksight"
 	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mashiike/redshift-data-set-annotator/internal/deepcopy"
 	_ "github.com/mashiike/redshift-data-sql-driver"
+	"github.com/samber/lo"
 )
 
 var Version string
 
 type App struct {
-	cfg Config
+	cfg         Config
+	cfgFile     string
+	cfgFiles    []string
+	profileName string
+	// settings of the commands in the project configuration file
+	settings projectSettings
 
+	// deferConfigErrors keeps New from failing on the configuration errors, that are kept in cfgErr for doctor.
+	deferConfigErrors bool
+	cfgErr            error
+
+	awsCfg          aws.Config
+	awsCfgCache     map[string]aws.Config
 	awsAccountID    string
-	client          *quicksight.Client
-	stsClient       *sts.Client
+	client          QuickSightClient
+	stsClient       STSClient
+	credentials     credentialsClients
 	dataSrouceCache map[string]*quicksight.DescribeDataSourceOutput
 
+	redshiftTargetCache map[string]*redshiftTarget
+	catalog             *catalogCache
+
 	w io.Writer
 }
 
-func New(ctx context.Context, awsAccountID string) (*App, error) {
-	cfg, err := loadConfigFile()
-	if err != nil {
-		return nil, err
+func New(ctx context.Context, awsAccountID string, opts ...Option) (*App, error) {
+	app := &App{
+		awsAccountID:    awsAccountID,
+		credentials:     defaultCredentialsClients,
+		dataSrouceCache: make(map[string]*quicksight.DescribeDataSourceOutput),
+
+		awsCfgCache:         make(map[string]aws.Config),
+		redshiftTargetCache: make(map[string]*redshiftTarget),
+		w:                   os.Stdout,
+	}
+	for _, opt := range opts {
+		opt(app)
+	}
+	if err := app.loadConfig(); err != nil {
+		if !app.deferConfigErrors {
+			return nil, err
+		}
+		log.Printf("[debug] defer the configuration error: %s", err)
+		app.cfgErr = err
+		if app.cfg == nil {
+			app.cfg = newConfig()
+		}
 	}
 	awsCfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
-	client := quicksight.NewFromConfig(awsCfg)
-	app := &App{
-		cfg:             cfg,
-		client:          client,
-		awsAccountID:    awsAccountID,
-		stsClient:       sts.NewFromConfig(awsCfg),
-		dataSrouceCache: make(map[string]*quicksight.DescribeDataSourceOutput),
-		w:               os.Stdout,
+	app.awsCfg = awsCfg
+	// QuickSight is accessed with the settings of the default profile (or the profile selected by --profile)
+	defaultProfile := app.cfg.lookupTarget(&redshiftTarget{})
+	if app.awsAccountID == "" {
+		app.awsAccountID = coalesce(defaultProfile.QuickSightAWSAccountID)
+	}
+	quickSightAWSCfg := awsCfg
+	if defaultProfile.QuickSightAWSProfile != nil || defaultProfile.QuickSightAWSRegion != nil || defaultProfile.QuickSightRoleArn != nil {
+		quickSightAWSCfg, err = loadAWSConfig(ctx, coalesce(defaultProfile.QuickSightAWSProfile), coalesce(defaultProfile.QuickSightAWSRegion), coalesce(defaultProfile.QuickSightRoleArn))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if app.client == nil {
+		app.client = quicksight.NewFromConfig(quickSightAWSCfg)
+	}
+	if app.stsClient == nil {
+		app.stsClient = sts.NewFromConfig(quickSightAWSCfg)
 	}
 	return app, nil
 }
 
+// loadConfig loads the configuration files unless given by WithConfig, and validates the environment variables and the profile name.
+func (app *App) loadConfig() error {
+	if app.cfg == nil {
+		cfg, settings, files, err := loadConfig(app.cfgFile)
+		if err != nil {
+			return err
+		}
+		app.cfg = cfg
+		app.settings = settings
+		app.cfgFiles = files
+	}
+	if _, err := envProfile(); err != nil {
+		return err
+	}
+	if app.profileName != "" {
+		profile, ok := app.cfg.Get(app.profileName)
+		if !ok || profile == nil {
+			return fmt.Errorf("profile `%s` not found in the configuration", app.profileName)
+		}
+		app.cfg = app.cfg.withDefault(profile)
+	}
+	return nil
+}
+
 func (app *App) DescribeDataSrouce(ctx context.Context, dataSourceArn string) (*quicksight.DescribeDataSourceOutput, error) {
 	if output, ok := app.dataSrouceCache[dataSourceArn]; ok {
 		return output, nil
@@ -85,24 +156,68 @@ func (app *App) AWSAccountID() string {
 	return app.awsAccountID
 }
 
+// readOnlyDataSetFields are the fields of types.DataSet that can not be set by UpdateDataSet.
+var readOnlyDataSetFields = []string{
+	"Arn",
+	"ConsumedSpiceCapacityInBytes",
+	"CreatedTime",
+	"LastUpdatedTime",
+	"OutputColumns",
+	"UseAs", // can only be set by CreateDataSet
+}
+
+// derivedUpdateDataSetInputFields are the fields of quicksight.UpdateDataSetInput that are not copied from types.DataSet.
+var derivedUpdateDataSetInputFields = []string{
+	"AwsAccountId",
+}
+
+// updateDataSetInputFields returns the fields of UpdateDataSetInput copied from types.DataSet.
+// The fields that can not be copied, added to UpdateDataSetInput or types.DataSet by newer SDK versions,
+// are skipped with a warning instead of failing every update.
+var updateDataSetInputFields = sync.OnceValue(func() []string {
+	dataSetType := reflect.TypeOf(types.DataSet{})
+	inputType := reflect.TypeOf(quicksight.UpdateDataSetInput{})
+	fields := make([]string, 0, inputType.NumField())
+	for i := 0; i < inputType.NumField(); i++ {
+		field := inputType.Field(i)
+		if !field.IsExported() || lo.Contains(derivedUpdateDataSetInputFields, field.Name) {
+			continue
+		}
+		dataSetField, ok := dataSetType.FieldByName(field.Name)
+		if !ok {
+			log.Printf("[warn] UpdateDataSetInput.%s is not found in DataSet, it is not set by update", field.Name)
+			continue
+		}
+		if dataSetField.Type != field.Type {
+			log.Printf("[warn] UpdateDataSetInput.%s type %s is different from DataSet.%s type %s, it is not set by update", field.Name, field.Type, field.Name, dataSetField.Type)
+			continue
+		}
+		fields = append(fields, field.Name)
+	}
+	for i := 0; i < dataSetType.NumField(); i++ {
+		field := dataSetType.Field(i)
+		if field.IsExported() && !lo.Contains(readOnlyDataSetFields, field.Name) && !lo.Contains(fields, field.Name) {
+			log.Printf("[warn] DataSet.%s is not found in UpdateDataSetInput, it is treated as read only", field.Name)
+		}
+	}
+	return fields
+})
+
+// NewUpdateDataSetInput returns the UpdateDataSetInput that keeps the data set as it is.
+// Every field of UpdateDataSetInput that has the same name in types.DataSet is deep copied,
+// so that the fields added by newer QuickSight API versions are also preserved.
 func NewUpdateDataSetInput(dataSet *types.DataSet) (*quicksight.UpdateDataSetInput, error) {
-	arnObj, err := arn.Parse(*dataSet.Arn)
+	arnObj, err := arn.Parse(coalesce(dataSet.Arn))
 	if err != nil {
 		return nil, err
 	}
 	input := &quicksight.UpdateDataSetInput{
-		AwsAccountId:                       aws.String(arnObj.AccountID),
-		DataSetId:                          clonePointer(dataSet.DataSetId),
-		ImportMode:                         dataSet.ImportMode,
-		Name:                               clonePointer(dataSet.Name),
-		PhysicalTableMap:                   cloneMap(dataSet.PhysicalTableMap),
-		ColumnGroups:                       cloneSlice(dataSet.ColumnGroups),
-		ColumnLevelPermissionRules:         cloneSlice(dataSet.ColumnLevelPermissionRules),
-		DataSetUsageConfiguration:          clonePointer(dataSet.DataSetUsageConfiguration),
-		FieldFolders:                       cloneMap(dataSet.FieldFolders),
-		LogicalTableMap:                    cloneMap(dataSet.LogicalTableMap),
-		RowLevelPermissionDataSet:          clonePointer(dataSet.RowLevelPermissionDataSet),
-		RowLevelPermissionTagConfiguration: clonePointer(dataSet.RowLevelPermissionTagConfiguration),
+		AwsAccountId: aws.String(arnObj.AccountID),
+	}
+	src := reflect.ValueOf(dataSet).Elem()
+	dst := reflect.ValueOf(input).Elem()
+	for _, name := range updateDataSetInputFields() {
+		dst.FieldByName(name).Set(deepcopy.Value(src.FieldByName(name)))
 	}
 	return input, nil
 }
@@ -0,0 +1,146 @@
+package redshiftdatasetannotator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// TestUpdateDataSetInputCoversDataSet fails when the SDK adds a field to types.DataSet or
+// quicksight.UpdateDataSetInput that is not handled by NewUpdateDataSetInput.
+func TestUpdateDataSetInputCoversDataSet(t *testing.T) {
+	dataSetType := reflect.TypeOf(types.DataSet{})
+	inputType := reflect.TypeOf(quicksight.UpdateDataSetInput{})
+	for i := 0; i < dataSetType.NumField(); i++ {
+		field := dataSetType.Field(i)
+		if !field.IsExported() || lo.Contains(readOnlyDataSetFields, field.Name) {
+			continue
+		}
+		inputField, ok := inputType.FieldByName(field.Name)
+		if !ok {
+			t.Errorf("DataSet.%s is not settable by UpdateDataSetInput, add it to readOnlyDataSetFields if it is read only", field.Name)
+			continue
+		}
+		if inputField.Type != field.Type {
+			t.Errorf("DataSet.%s type %s is different from UpdateDataSetInput.%s type %s", field.Name, field.Type, field.Name, inputField.Type)
+		}
+	}
+	for i := 0; i < inputType.NumField(); i++ {
+		field := inputType.Field(i)
+		if !field.IsExported() || lo.Contains(derivedUpdateDataSetInputFields, field.Name) {
+			continue
+		}
+		if _, ok := dataSetType.FieldByName(field.Name); !ok {
+			t.Errorf("UpdateDataSetInput.%s is not found in DataSet, handle it in NewUpdateDataSetInput", field.Name)
+		}
+	}
+}
+
+// TestUpdateDataSetInputFields pins the fields copied by NewUpdateDataSetInput.
+// Review the new fields when the SDK is updated, and update the list.
+func TestUpdateDataSetInputFields(t *testing.T) {
+	want := []string{
+		"DataSetId",
+		"ImportMode",
+		"Name",
+		"PhysicalTableMap",
+		"ColumnGroups",
+		"ColumnLevelPermissionRules",
+		"DataPrepConfiguration",
+		"DataSetUsageConfiguration",
+		"DatasetParameters",
+		"FieldFolders",
+		"LogicalTableMap",
+		"PerformanceConfiguration",
+		"RowLevelPermissionDataSet",
+		"RowLevelPermissionTagConfiguration",
+		"SemanticModelConfiguration",
+	}
+	if got := updateDataSetInputFields(); !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestNewUpdateDataSetInput(t *testing.T) {
+	now := time.Date(2022, 12, 9, 0, 0, 0, 0, time.UTC)
+	dataSet := &types.DataSet{
+		Arn:             aws.String("arn:aws:quicksight:ap-northeast-1:123456789012:dataset/example"),
+		DataSetId:       aws.String("example"),
+		Name:            aws.String("example"),
+		ImportMode:      types.DataSetImportModeDirectQuery,
+		CreatedTime:     &now,
+		LastUpdatedTime: &now,
+		PhysicalTableMap: map[string]types.PhysicalTable{
+			"physical": &types.PhysicalTableMemberRelationalTable{
+				Value: types.RelationalTable{
+					DataSourceArn: aws.String("arn:aws:quicksight:ap-northeast-1:123456789012:datasource/example"),
+					Schema:        aws.String("public"),
+					Name:          aws.String("users"),
+					InputColumns: []types.InputColumn{
+						{Name: aws.String("id"), Type: types.InputColumnDataTypeInteger},
+					},
+				},
+			},
+		},
+		LogicalTableMap: map[string]types.LogicalTable{
+			"logical": {
+				Alias:  aws.String("users"),
+				Source: &types.LogicalTableSource{PhysicalTableId: aws.String("physical")},
+				DataTransforms: []types.TransformOperation{
+					&types.TransformOperationMemberRenameColumnOperation{
+						Value: types.RenameColumnOperation{
+							ColumnName:    aws.String("id"),
+							NewColumnName: aws.String("ID"),
+						},
+					},
+				},
+			},
+		},
+		FieldFolders: map[string]types.FieldFolder{
+			"User": {Columns: []string{"ID"}},
+		},
+		ColumnLevelPermissionRules: []types.ColumnLevelPermissionRule{
+			{ColumnNames: []string{"ID"}, Principals: []string{"arn:aws:quicksight:ap-northeast-1:123456789012:group/default/admin"}},
+		},
+		DataSetUsageConfiguration: &types.DataSetUsageConfiguration{
+			DisableUseAsDirectQuerySource: true,
+		},
+	}
+	input, err := NewUpdateDataSetInput(dataSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(input.AwsAccountId); got != "123456789012" {
+		t.Errorf("AwsAccountId = %s, want 123456789012", got)
+	}
+	if !reflect.DeepEqual(input.LogicalTableMap, dataSet.LogicalTableMap) {
+		t.Errorf("LogicalTableMap is not copied")
+	}
+	if !reflect.DeepEqual(input.FieldFolders, dataSet.FieldFolders) {
+		t.Errorf("FieldFolders is not copied")
+	}
+	if !reflect.DeepEqual(input.DataSetUsageConfiguration, dataSet.DataSetUsageConfiguration) {
+		t.Errorf("DataSetUsageConfiguration is not copied")
+	}
+
+	// modifying the input must not modify the data set
+	op := input.LogicalTableMap["logical"].DataTransforms[0].(*types.TransformOperationMemberRenameColumnOperation)
+	op.Value.NewColumnName = aws.String("user_id")
+	input.FieldFolders["User"].Columns[0] = "user_id"
+	input.ColumnLevelPermissionRules[0].ColumnNames[0] = "user_id"
+	original := dataSet.LogicalTableMap["logical"].DataTransforms[0].(*types.TransformOperationMemberRenameColumnOperation)
+	if got := aws.ToString(original.Value.NewColumnName); got != "ID" {
+		t.Errorf("original rename column operation is modified: %s", got)
+	}
+	if got := dataSet.FieldFolders["User"].Columns[0]; got != "ID" {
+		t.Errorf("original field folder is modified: %s", got)
+	}
+	if got := dataSet.ColumnLevelPermissionRules[0].ColumnNames[0]; got != "ID" {
+		t.Errorf("original column level permission rule is modified: %s", got)
+	}
+}
@@ -0,0 +1,464 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+type ApplyOption struct {
+	Spec       []string `arg:"" help:"spec files of data sets, YAML in the format of export" type:"path"`
+	Prune      bool     `help:"Remove the descriptions, geographic roles, casts, folders and calculated fields that are not in the spec"`
+	DryRun     bool     `help:"if true, no update data set and display plan"`
+	Verbose    bool     `help:"Outputs the input information for the UpdateDataSet API"`
+	OnConflict string   `help:"Behavior when the data set is updated by someone else during apply" enum:"abort,replan" default:"abort"`
+	MaxReplan  int      `help:"Maximum number of attempts with --on-conflict=replan" default:"3"`
+
+	BackupOption    `embed:""`
+	IngestionOption `embed:""`
+
+	RewriteFieldReferences bool `help:"Rewrite the references to renamed fields in analyses and dashboards using the data set, after confirmation"`
+	Yes                    bool `help:"With --rewrite-field-references, rewrite without confirmation" short:"y"`
+}
+
+// annotateOption returns the options of annotate to converge the data set to the spec.
+// Everything in the spec is forced, as the spec is the source of truth.
+func (opt *ApplyOption) annotateOption() *AnnotateOption {
+	return &AnnotateOption{
+		DryRun:                    opt.DryRun,
+		Verbose:                   opt.Verbose,
+		ForceRename:               true,
+		ForceUpdateDescription:    true,
+		ForceUpdateGeographicRole: true,
+		ForceUpdateFolder:         true,
+		OnConflict:                opt.OnConflict,
+		MaxReplan:                 opt.MaxReplan,
+		BackupOption:              opt.BackupOption,
+		IngestionOption:           opt.IngestionOption,
+		RewriteFieldReferences:    opt.RewriteFieldReferences,
+		Yes:                       opt.Yes,
+	}
+}
+
+func (app *App) RunApply(ctx context.Context, opt *ApplyOption) error {
+	var specs []*DataSetExport
+	for _, path := range opt.Spec {
+		exports, err := loadDataSetExports(path)
+		if err != nil {
+			return fmt.Errorf("spec file %s: %w", path, err)
+		}
+		specs = append(specs, exports...)
+	}
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		if seen[spec.DataSetID] {
+			return fmt.Errorf("data set %s is specified more than once", spec.DataSetID)
+		}
+		seen[spec.DataSetID] = true
+	}
+	if opt.DryRun {
+		log.Println("[info] ************* start dry run ****************")
+		defer log.Println("[info] *************  end dry run  ****************")
+	}
+	annotateOpt := opt.annotateOption()
+	var failed []string
+	for _, spec := range specs {
+		log.Printf("[info] apply spec of data set %s", spec.DataSetID)
+		err := app.updateDataSet(ctx, annotateOpt, spec.DataSetID, func(dataSet *types.DataSet) (*quicksight.UpdateDataSetInput, map[string]string, bool, error) {
+			updateDataSetInput, renamedColumns, needUpdate, err := app.planAnnotate(ctx, annotateOpt, dataSet, spec)
+			if err != nil {
+				return nil, nil, false, err
+			}
+			if planCalculatedFields(updateDataSetInput, spec) {
+				needUpdate = true
+			}
+			if opt.Prune {
+				pruned, err := pruneUnmanaged(updateDataSetInput, spec)
+				if err != nil {
+					return nil, nil, false, err
+				}
+				if pruned {
+					needUpdate = true
+				}
+			}
+			return updateDataSetInput, renamedColumns, needUpdate, nil
+		})
+		if err != nil {
+			log.Printf("[error] data set %s: %s", spec.DataSetID, err)
+			failed = append(failed, spec.DataSetID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to apply %d of %d data set(s): %s", len(failed), len(specs), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// planCalculatedFields creates or rewrites the calculated fields of the spec, with their descriptions and folders.
+// New calculated fields are created in the root logical table (not joined by others).
+func planCalculatedFields(input *quicksight.UpdateDataSetInput, spec *DataSetExport) bool {
+	var changed bool
+	for _, field := range spec.CalculatedFields {
+		logicalTableID, ok := findCalculatedField(input.LogicalTableMap, field.Name)
+		if ok {
+			if setCalculatedFieldExpression(input.LogicalTableMap, logicalTableID, field.Name, field.Expression) {
+				log.Printf("[info] rewrite expression of calculated field `%s` to `%s`", field.Name, field.Expression)
+				changed = true
+			}
+		} else {
+			logicalTableID, ok = rootLogicalTableID(input.LogicalTableMap)
+			if !ok {
+				log.Printf("[warn] no logical table to create calculated field `%s`", field.Name)
+				continue
+			}
+			addCalculatedField(input.LogicalTableMap, logicalTableID, coalesce(input.DataSetId), field.Name, field.Expression)
+			log.Printf("[info] create calculated field `%s` expression=`%s` in logical table `%s`", field.Name, field.Expression, logicalTableID)
+			changed = true
+		}
+		if field.Description != "" && setCalculatedFieldDescription(input.LogicalTableMap, logicalTableID, field.Name, field.Description) {
+			log.Printf("[info] Update %s (calculated) field description", field.Name)
+			changed = true
+		}
+		if field.Folder != "" {
+			if input.FieldFolders == nil {
+				input.FieldFolders = make(map[string]types.FieldFolder)
+			}
+			if setFieldFolder(input.FieldFolders, normalizeFolderPath(field.Folder), field.Name, true) {
+				log.Printf("[info] Move %s (calculated) field to folder `%s`", field.Name, field.Folder)
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// findCalculatedField returns the logical table creating the calculated field.
+func findCalculatedField(logicalTableMap map[string]types.LogicalTable, name string) (string, bool) {
+	return lo.FindKeyBy(logicalTableMap, func(_ string, logicalTable types.LogicalTable) bool {
+		_, ok := createColumnsIndex(logicalTable.DataTransforms, name)
+		return ok
+	})
+}
+
+// createColumnsIndex returns the index of the CreateColumnsOperation creating the column in transforms.
+func createColumnsIndex(transforms []types.TransformOperation, name string) (int, bool) {
+	for i, transform := range transforms {
+		op, ok := transform.(*types.TransformOperationMemberCreateColumnsOperation)
+		if !ok {
+			continue
+		}
+		for _, column := range op.Value.Columns {
+			if coalesce(column.ColumnName) == name {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func setCalculatedFieldExpression(logicalTableMap map[string]types.LogicalTable, logicalTableID string, name string, expression string) bool {
+	transforms := logicalTableMap[logicalTableID].DataTransforms
+	i, _ := createColumnsIndex(transforms, name)
+	op := transforms[i].(*types.TransformOperationMemberCreateColumnsOperation)
+	for j, column := range op.Value.Columns {
+		if coalesce(column.ColumnName) == name && coalesce(column.Expression) != expression {
+			op.Value.Columns[j].Expression = aws.String(expression)
+			return true
+		}
+	}
+	return false
+}
+
+// rootLogicalTableID returns the logical table that is not an operand of joins.
+// If there are many, e.g. the data set is not joined yet, the first one by ID is returned.
+func rootLogicalTableID(logicalTableMap map[string]types.LogicalTable) (string, bool) {
+	operands := make(map[string]bool)
+	for _, logicalTable := range logicalTableMap {
+		if logicalTable.Source != nil && logicalTable.Source.JoinInstruction != nil {
+			operands[coalesce(logicalTable.Source.JoinInstruction.LeftOperand)] = true
+			operands[coalesce(logicalTable.Source.JoinInstruction.RightOperand)] = true
+		}
+	}
+	ids := lo.Filter(lo.Keys(logicalTableMap), func(id string, _ int) bool {
+		return !operands[id]
+	})
+	if len(ids) == 0 {
+		return "", false
+	}
+	sort.Strings(ids)
+	return ids[0], true
+}
+
+// addCalculatedField inserts a CreateColumnsOperation before the ProjectOperation of the logical table, and projects the new field.
+// The column ID is derived from the data set ID and the name, so that re-planning creates the same ID.
+func addCalculatedField(logicalTableMap map[string]types.LogicalTable, logicalTableID string, dataSetID string, name string, expression string) {
+	logicalTable := logicalTableMap[logicalTableID]
+	op := &types.TransformOperationMemberCreateColumnsOperation{
+		Value: types.CreateColumnsOperation{
+			Columns: []types.CalculatedColumn{
+				{
+					ColumnId:   aws.String(fmt.Sprintf("%x", sha1.Sum([]byte(dataSetID+"/"+name)))),
+					ColumnName: aws.String(name),
+					Expression: aws.String(expression),
+				},
+			},
+		},
+	}
+	transforms := make([]types.TransformOperation, 0, len(logicalTable.DataTransforms)+1)
+	var inserted bool
+	for _, transform := range logicalTable.DataTransforms {
+		if project, ok := transform.(*types.TransformOperationMemberProjectOperation); ok {
+			if !inserted {
+				transforms = append(transforms, op)
+				inserted = true
+			}
+			project.Value.ProjectedColumns = append(project.Value.ProjectedColumns, name)
+		}
+		transforms = append(transforms, transform)
+	}
+	if !inserted {
+		transforms = append(transforms, op)
+	}
+	logicalTable.DataTransforms = transforms
+	logicalTableMap[logicalTableID] = logicalTable
+}
+
+// setCalculatedFieldDescription sets the description tag of the calculated field.
+// A new TagColumnOperation is inserted right after the CreateColumnsOperation.
+func setCalculatedFieldDescription(logicalTableMap map[string]types.LogicalTable, logicalTableID string, name string, description string) bool {
+	logicalTable := logicalTableMap[logicalTableID]
+	tag := types.ColumnTag{
+		ColumnDescription: &types.ColumnDescription{
+			Text: aws.String(description),
+		},
+	}
+	for _, transform := range logicalTable.DataTransforms {
+		if op, ok := transform.(*types.TransformOperationMemberTagColumnOperation); ok && coalesce(op.Value.ColumnName) == name {
+			return mergeColumnTag(map[string]*types.TransformOperationMemberTagColumnOperation{name: op}, name, tag, true)
+		}
+	}
+	i, _ := createColumnsIndex(logicalTable.DataTransforms, name)
+	logicalTable.DataTransforms = append(logicalTable.DataTransforms[:i+1], append([]types.TransformOperation{
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{
+				ColumnName: aws.String(name),
+				Tags:       []types.ColumnTag{tag},
+			},
+		},
+	}, logicalTable.DataTransforms[i+1:]...)...)
+	logicalTableMap[logicalTableID] = logicalTable
+	return true
+}
+
+// pruneUnmanaged removes the changes that are not in the spec:
+// calculated fields, and descriptions, geographic roles, casts and folders of the fields.
+// Only the fields of the relations in the spec are pruned. Renames and hidden fields are not pruned,
+// as reverting them would break the references to the fields.
+// It is an error to prune the calculated fields used by the other fields, filters or permissions.
+func pruneUnmanaged(input *quicksight.UpdateDataSetInput, spec *DataSetExport) (bool, error) {
+	var changed bool
+	calculatedFields := lo.SliceToMap(spec.CalculatedFields, func(field *CalculatedFieldExport) (string, *CalculatedFieldExport) {
+		return field.Name, field
+	})
+	if err := checkPruneDependencies(input, calculatedFields); err != nil {
+		return false, err
+	}
+	for logicalTableID, logicalTable := range input.LogicalTableMap {
+		for _, transform := range logicalTable.DataTransforms {
+			op, ok := transform.(*types.TransformOperationMemberCreateColumnsOperation)
+			if !ok {
+				continue
+			}
+			for _, column := range op.Value.Columns {
+				name := coalesce(column.ColumnName)
+				field, ok := calculatedFields[name]
+				if !ok {
+					removeCalculatedField(input, logicalTableID, name)
+					log.Printf("[info] prune calculated field `%s` in logical table `%s`", name, logicalTableID)
+					changed = true
+					continue
+				}
+				if field.Description == "" && removeColumnTag(input.LogicalTableMap, name, isDescriptionTag) {
+					log.Printf("[info] prune description of %s (calculated) field", name)
+					changed = true
+				}
+				if field.Folder == "" && removeFieldFolderColumns(input.FieldFolders, name) {
+					log.Printf("[info] prune folder of %s (calculated) field", name)
+					changed = true
+				}
+			}
+		}
+	}
+
+	fields := lo.SliceToMap(spec.Fields, func(field *FieldExport) (string, *FieldExport) {
+		return strings.ToLower(field.Source), field
+	})
+	relations := lo.SliceToMap(spec.Fields, func(field *FieldExport) (string, bool) {
+		source := strings.ToLower(field.Source)
+		return source[:strings.LastIndex(source, ".")+1], true
+	})
+	dataSet := &types.DataSet{
+		PhysicalTableMap: input.PhysicalTableMap,
+		LogicalTableMap:  input.LogicalTableMap,
+	}
+	for _, sourceField := range sourceFields(dataSet) {
+		source := strings.ToLower(sourceField.Source())
+		if sourceField.Table == nil || !relations[source[:strings.LastIndex(source, ".")+1]] {
+			continue
+		}
+		field, ok := fields[source]
+		if !ok {
+			field = &FieldExport{}
+		}
+		name := sourceField.Trace.Name
+		if field.Description == "" && removeColumnTag(input.LogicalTableMap, name, isDescriptionTag) {
+			log.Printf("[info] prune description of %s (`%s`) field", name, sourceField.Column)
+			changed = true
+		}
+		if field.GeographicRole == "" && removeColumnTag(input.LogicalTableMap, name, isGeographicRoleTag) {
+			log.Printf("[info] prune geographic role of %s (`%s`) field", name, sourceField.Column)
+			changed = true
+		}
+		if field.Cast == "" && removeColumnOperations(input.LogicalTableMap, name, isCastColumnOperation) {
+			log.Printf("[info] prune cast of %s (`%s`) field", name, sourceField.Column)
+			changed = true
+		}
+		if field.Folder == "" && removeFieldFolderColumns(input.FieldFolders, name) {
+			log.Printf("[info] prune folder of %s (`%s`) field", name, sourceField.Column)
+			changed = true
+		}
+	}
+	return changed, nil
+}
+
+// checkPruneDependencies returns an error if the calculated fields not in the spec are used by
+// column level permission rules, column groups, row-level security tag rules, the remaining calculated fields or filters,
+// the same dependencies as the hidden columns.
+func checkPruneDependencies(input *quicksight.UpdateDataSetInput, calculatedFields map[string]*CalculatedFieldExport) error {
+	dependencies := columnDependencies{
+		ColumnLevelPermissionRules:         input.ColumnLevelPermissionRules,
+		ColumnGroups:                       input.ColumnGroups,
+		RowLevelPermissionTagConfiguration: input.RowLevelPermissionTagConfiguration,
+	}
+	var pruned []string
+	for _, logicalTable := range input.LogicalTableMap {
+		for _, transform := range logicalTable.DataTransforms {
+			switch op := transform.(type) {
+			case *types.TransformOperationMemberCreateColumnsOperation:
+				kept := &types.TransformOperationMemberCreateColumnsOperation{}
+				for _, column := range op.Value.Columns {
+					if _, ok := calculatedFields[coalesce(column.ColumnName)]; ok {
+						kept.Value.Columns = append(kept.Value.Columns, column)
+					} else {
+						pruned = append(pruned, coalesce(column.ColumnName))
+					}
+				}
+				dependencies.CreateColumnsOperations = append(dependencies.CreateColumnsOperations, kept)
+			case *types.TransformOperationMemberFilterOperation:
+				dependencies.FilterOperations = append(dependencies.FilterOperations, op)
+			}
+		}
+	}
+	sort.Strings(pruned)
+	for _, name := range pruned {
+		if usedBy := dependencies.usedBy(name); len(usedBy) > 0 {
+			return fmt.Errorf("can not prune calculated field `%s`, it is used by %s; add it to calculated_fields of the spec", name, strings.Join(usedBy, ", "))
+		}
+	}
+	return nil
+}
+
+func isDescriptionTag(tag types.ColumnTag) bool {
+	return tag.ColumnDescription != nil
+}
+
+func isGeographicRoleTag(tag types.ColumnTag) bool {
+	return tag.ColumnGeographicRole != ""
+}
+
+func isCastColumnOperation(transform types.TransformOperation, name string) bool {
+	op, ok := transform.(*types.TransformOperationMemberCastColumnTypeOperation)
+	return ok && coalesce(op.Value.ColumnName) == name
+}
+
+// removeCalculatedField removes the calculated field from the CreateColumnsOperation, and the transforms and folders of the field.
+func removeCalculatedField(input *quicksight.UpdateDataSetInput, logicalTableID string, name string) {
+	logicalTable := input.LogicalTableMap[logicalTableID]
+	transforms := make([]types.TransformOperation, 0, len(logicalTable.DataTransforms))
+	for _, transform := range logicalTable.DataTransforms {
+		switch op := transform.(type) {
+		case *types.TransformOperationMemberCreateColumnsOperation:
+			op.Value.Columns = lo.Filter(op.Value.Columns, func(column types.CalculatedColumn, _ int) bool {
+				return coalesce(column.ColumnName) != name
+			})
+			if len(op.Value.Columns) == 0 {
+				continue
+			}
+		case *types.TransformOperationMemberProjectOperation:
+			op.Value.ProjectedColumns = lo.Without(op.Value.ProjectedColumns, name)
+		}
+		transforms = append(transforms, transform)
+	}
+	logicalTable.DataTransforms = transforms
+	input.LogicalTableMap[logicalTableID] = logicalTable
+	removeColumnOperations(input.LogicalTableMap, name, func(transform types.TransformOperation, name string) bool {
+		switch op := transform.(type) {
+		case *types.TransformOperationMemberTagColumnOperation:
+			return coalesce(op.Value.ColumnName) == name
+		case *types.TransformOperationMemberUntagColumnOperation:
+			return coalesce(op.Value.ColumnName) == name
+		}
+		return isCastColumnOperation(transform, name)
+	})
+	removeFieldFolderColumns(input.FieldFolders, name)
+}
+
+// removeColumnOperations removes the transforms of the column matching fn from all logical tables.
+func removeColumnOperations(logicalTableMap map[string]types.LogicalTable, name string, fn func(types.TransformOperation, string) bool) bool {
+	var changed bool
+	for logicalTableID, logicalTable := range logicalTableMap {
+		transforms := lo.Reject(logicalTable.DataTransforms, func(transform types.TransformOperation, _ int) bool {
+			return fn(transform, name)
+		})
+		if len(transforms) == len(logicalTable.DataTransforms) {
+			continue
+		}
+		logicalTable.DataTransforms = transforms
+		logicalTableMap[logicalTableID] = logicalTable
+		changed = true
+	}
+	return changed
+}
+
+// removeColumnTag removes the tags of the column matching fn, and the TagColumnOperations without tags.
+func removeColumnTag(logicalTableMap map[string]types.LogicalTable, name string, fn func(types.ColumnTag) bool) bool {
+	var changed bool
+	for _, logicalTable := range logicalTableMap {
+		for _, transform := range logicalTable.DataTransforms {
+			op, ok := transform.(*types.TransformOperationMemberTagColumnOperation)
+			if !ok || coalesce(op.Value.ColumnName) != name {
+				continue
+			}
+			tags := lo.Reject(op.Value.Tags, func(tag types.ColumnTag, _ int) bool {
+				return fn(tag)
+			})
+			if len(tags) != len(op.Value.Tags) {
+				op.Value.Tags = tags
+				changed = true
+			}
+		}
+	}
+	removeColumnOperations(logicalTableMap, name, func(transform types.TransformOperation, name string) bool {
+		op, ok := transform.(*types.TransformOperationMemberTagColumnOperation)
+		return ok && coalesce(op.Value.ColumnName) == name && len(op.Value.Tags) == 0
+	})
+	return changed
+}
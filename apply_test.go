@@ -0,0 +1,217 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users",
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{ColumnName: aws.String("pref_code"), Tags: []types.ColumnTag{
+				{ColumnDescription: &types.ColumnDescription{Text: aws.String("Prefecture code")}},
+				{ColumnGeographicRole: types.GeoSpatialDataRoleState},
+			}},
+		},
+		&types.TransformOperationMemberCreateColumnsOperation{
+			Value: types.CreateColumnsOperation{Columns: []types.CalculatedColumn{
+				{ColumnId: aws.String("c1"), ColumnName: aws.String("Legacy"), Expression: aws.String("1")},
+			}},
+		},
+		&types.TransformOperationMemberProjectOperation{
+			Value: types.ProjectOperation{ProjectedColumns: []string{"id", "pref_code", "Legacy"}},
+		},
+	))
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	specFile := filepath.Join(t.TempDir(), "users.yaml")
+	apply := func(spec *DataSetExport, prune bool) {
+		t.Helper()
+		if err := os.WriteFile(specFile, marshalYAML(t, spec), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := app.RunApply(ctx, &ApplyOption{
+			Spec:            []string{specFile},
+			Prune:           prune,
+			OnConflict:      "abort",
+			BackupOption:    BackupOption{NoBackup: true},
+			IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	export := func() *DataSetExport {
+		t.Helper()
+		buf.Reset()
+		if err := app.RunExport(ctx, &ExportOption{DataSetID: []string{"users"}}); err != nil {
+			t.Fatal(err)
+		}
+		var exported DataSetExport
+		if err := yaml.Unmarshal(buf.Bytes(), &exported); err != nil {
+			t.Fatal(err)
+		}
+		return &exported
+	}
+
+	spec := &DataSetExport{
+		DataSetID: "users",
+		Name:      "users",
+		Fields: []*FieldExport{
+			{Name: "id", Source: "public.users.id"},
+			{Name: "Prefecture", Source: "public.users.pref_code", GeographicRole: "STATE", Folder: "Address"},
+		},
+		CalculatedFields: []*CalculatedFieldExport{
+			{Name: "Legacy", Expression: "2"},
+			{Name: "Region", Expression: "ifelse({Prefecture} = '13', 'Kanto', 'Other')", Description: "Region of the user", Folder: "Address"},
+		},
+	}
+	// without --prune, the description of the source field not in the spec is kept.
+	apply(spec, false)
+	want := &DataSetExport{
+		DataSetID: "users",
+		Name:      "users",
+		Fields: []*FieldExport{
+			{Name: "id", Source: "public.users.id"},
+			{Name: "Prefecture", Source: "public.users.pref_code", Description: "Prefecture code", GeographicRole: "STATE", Folder: "Address"},
+		},
+		CalculatedFields: spec.CalculatedFields,
+	}
+	if exported := export(); !reflect.DeepEqual(exported, want) {
+		t.Fatalf("export after apply = %s, want %s", buf.String(), marshalYAML(t, want))
+	}
+	if n := len(client.Updates()); n != 1 {
+		t.Fatalf("updates = %d, want 1", n)
+	}
+	// applying the same spec again makes no changes.
+	apply(spec, false)
+	if n := len(client.Updates()); n != 1 {
+		t.Fatalf("updates = %d, want 1", n)
+	}
+
+	spec.CalculatedFields = spec.CalculatedFields[1:]
+	apply(spec, true)
+	if exported := export(); !reflect.DeepEqual(exported, spec) {
+		t.Errorf("export after apply --prune = %s, want %s", buf.String(), marshalYAML(t, spec))
+	}
+}
+
+func TestApplyUnrename(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users",
+		testRename("pref_code", "Prefecture"),
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{ColumnName: aws.String("Prefecture"), Tags: []types.ColumnTag{
+				{ColumnDescription: &types.ColumnDescription{Text: aws.String("Prefecture code")}},
+			}},
+		},
+	))
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	spec := &DataSetExport{
+		DataSetID: "users",
+		Name:      "users",
+		Fields: []*FieldExport{
+			{Name: "id", Source: "public.users.id"},
+			{Name: "pref_code", Source: "public.users.pref_code", Description: "Prefecture code"},
+		},
+	}
+	specFile := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(specFile, marshalYAML(t, spec), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := app.RunApply(ctx, &ApplyOption{
+		Spec:            []string{specFile},
+		OnConflict:      "abort",
+		BackupOption:    BackupOption{NoBackup: true},
+		IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunExport(ctx, &ExportOption{DataSetID: []string{"users"}}); err != nil {
+		t.Fatal(err)
+	}
+	var exported DataSetExport
+	if err := yaml.Unmarshal(buf.Bytes(), &exported); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&exported, spec) {
+		t.Errorf("export after apply = %s, want %s", buf.String(), marshalYAML(t, spec))
+	}
+}
+
+func TestApplyPruneDependencies(t *testing.T) {
+	cases := []struct {
+		name             string
+		calculatedFields []*CalculatedFieldExport
+		tagRule          bool
+		want             string
+	}{
+		{
+			name:             "used by the calculated field in the spec",
+			calculatedFields: []*CalculatedFieldExport{{Name: "Score", Expression: "{Legacy} + 1"}},
+			want:             "can not prune calculated field `Legacy`, it is used by calculated field `Score`",
+		},
+		{
+			name:             "used by the row-level security tag rule",
+			calculatedFields: []*CalculatedFieldExport{{Name: "Score", Expression: "{Legacy} + 1"}},
+			tagRule:          true,
+			want:             "row-level security tag rule `legacy`",
+		},
+		{
+			name: "used by the calculated field pruned together",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dataSet := testDataSet("users", &types.TransformOperationMemberCreateColumnsOperation{
+				Value: types.CreateColumnsOperation{Columns: []types.CalculatedColumn{
+					{ColumnId: aws.String("c1"), ColumnName: aws.String("Legacy"), Expression: aws.String("1")},
+					{ColumnId: aws.String("c2"), ColumnName: aws.String("Score"), Expression: aws.String("{Legacy} + 1")},
+				}},
+			})
+			if c.tagRule {
+				dataSet.RowLevelPermissionTagConfiguration = &types.RowLevelPermissionTagConfiguration{
+					Status:   types.StatusEnabled,
+					TagRules: []types.RowLevelPermissionTagRule{{ColumnName: aws.String("Legacy"), TagKey: aws.String("legacy")}},
+				}
+			}
+			input, err := NewUpdateDataSetInput(dataSet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed, err := pruneUnmanaged(input, &DataSetExport{DataSetID: "users", CalculatedFields: c.calculatedFields})
+			if c.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !changed {
+					t.Error("pruneUnmanaged changed nothing, want the calculated fields pruned")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("error = %v, want %q", err, c.want)
+			}
+			if changed {
+				t.Error("pruneUnmanaged changed the data set, want unchanged")
+			}
+		})
+	}
+}
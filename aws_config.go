@@ -0,0 +1,50 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// loadAWSConfig loads the AWS config of the named profile (of the AWS shared config) and region,
+// and assumes the role if roleArn is not empty.
+func loadAWSConfig(ctx context.Context, profile string, region string, roleArn string) (aws.Config, error) {
+	var optFns []func(*config.LoadOptions) error
+	if profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(profile))
+	}
+	if region != "" {
+		optFns = append(optFns, config.WithRegion(region))
+	}
+	awsCfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if roleArn != "" {
+		log.Printf("[debug] assume role %s", roleArn)
+		awsCfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), roleArn))
+	}
+	return awsCfg, nil
+}
+
+// redshiftAWSConfig returns the AWS config to access Redshift with the aws_profile, aws_region and role_arn of the profile.
+func (app *App) redshiftAWSConfig(ctx context.Context, profile *ProfileConfig) (aws.Config, error) {
+	if profile.AWSProfile == nil && profile.AWSRegion == nil && profile.RoleArn == nil {
+		return app.awsCfg, nil
+	}
+	key := strings.Join([]string{coalesce(profile.AWSProfile), coalesce(profile.AWSRegion), coalesce(profile.RoleArn)}, "\x00")
+	if awsCfg, ok := app.awsCfgCache[key]; ok {
+		return awsCfg, nil
+	}
+	awsCfg, err := loadAWSConfig(ctx, coalesce(profile.AWSProfile), coalesce(profile.AWSRegion), coalesce(profile.RoleArn))
+	if err != nil {
+		return aws.Config{}, err
+	}
+	app.awsCfgCache[key] = awsCfg
+	return awsCfg, nil
+}
@@ -0,0 +1,177 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type BackupOption struct {
+	BackupLocation   string `help:"Backup location of the data set definition before update. local directory or s3://bucket/prefix" default:"${backup_location}"`
+	NoBackup         bool   `help:"Do not back up the data set definition before update"`
+	BackupS3Endpoint string `name:"backup-s3-endpoint" help:"Endpoint URL of S3 compatible storage for backup"`
+}
+
+// DataSetBackup is the DescribeDataSet output saved before update.
+type DataSetBackup struct {
+	BackedUpAt time.Time
+	RequestId  *string
+	Status     int32
+	DataSet    *types.DataSet
+}
+
+type jsonDataSetBackup struct {
+	BackedUpAt time.Time
+	RequestId  *string
+	Status     int32
+	DataSet    *jsonDataSet
+}
+
+func (backup *DataSetBackup) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDataSetBackup{
+		BackedUpAt: backup.BackedUpAt,
+		RequestId:  backup.RequestId,
+		Status:     backup.Status,
+		DataSet:    newJSONDataSet(backup.DataSet),
+	})
+}
+
+func (backup *DataSetBackup) UnmarshalJSON(data []byte) error {
+	var v jsonDataSetBackup
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	backup.BackedUpAt = v.BackedUpAt
+	backup.RequestId = v.RequestId
+	backup.Status = v.Status
+	if v.DataSet != nil {
+		backup.DataSet = v.DataSet.dataSet()
+	}
+	return nil
+}
+
+func defaultBackupLocation() string {
+	return filepath.Join(configDir, "backups")
+}
+
+// BackupDataSet saves the DescribeDataSet output to the backup location, and returns the saved location.
+func (app *App) BackupDataSet(ctx context.Context, opt BackupOption, output *quicksight.DescribeDataSetOutput) (string, error) {
+	if opt.NoBackup {
+		log.Println("[debug] skip backup of data set")
+		return "", nil
+	}
+	if opt.BackupLocation == "" {
+		return "", fmt.Errorf("backup location is empty, specify --backup-location or --no-backup")
+	}
+	backup := &DataSetBackup{
+		BackedUpAt: time.Now(),
+		RequestId:  output.RequestId,
+		Status:     output.Status,
+		DataSet:    output.DataSet,
+	}
+	bs, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	name := path.Join(coalesce(output.DataSet.DataSetId), backup.BackedUpAt.UTC().Format("20060102T150405.000Z")+".json")
+	location, err := app.writeBackup(ctx, opt, name, bs)
+	if err != nil {
+		return "", err
+	}
+	log.Printf("[info] backup data set %s to %s", coalesce(output.DataSet.DataSetId), location)
+	return location, nil
+}
+
+// LoadDataSetBackup reads a backup file from local path or s3://bucket/key.
+func (app *App) LoadDataSetBackup(ctx context.Context, opt BackupOption, location string) (*DataSetBackup, error) {
+	bs, err := app.readBackup(ctx, opt, location)
+	if err != nil {
+		return nil, err
+	}
+	var backup DataSetBackup
+	if err := json.Unmarshal(bs, &backup); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal backup %s: %w", location, err)
+	}
+	if backup.DataSet == nil {
+		return nil, fmt.Errorf("backup %s has no data set", location)
+	}
+	return &backup, nil
+}
+
+func (app *App) writeBackup(ctx context.Context, opt BackupOption, name string, body []byte) (string, error) {
+	if u, ok := parseS3URL(opt.BackupLocation); ok {
+		key := strings.TrimPrefix(path.Join(strings.TrimPrefix(u.Path, "/"), name), "/")
+		_, err := app.s3Client(opt).PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(u.Host),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(body),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to put backup object: %w", err)
+		}
+		return fmt.Sprintf("s3://%s/%s", u.Host, key), nil
+	}
+	p := filepath.Join(opt.BackupLocation, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.WriteFile(p, body, 0600); err != nil {
+		return "", fmt.Errorf("failed to write backup file: %w", err)
+	}
+	return p, nil
+}
+
+func (app *App) readBackup(ctx context.Context, opt BackupOption, location string) ([]byte, error) {
+	u, ok := parseS3URL(location)
+	if !ok {
+		bs, err := os.ReadFile(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read backup file: %w", err)
+		}
+		return bs, nil
+	}
+	output, err := app.s3Client(opt).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(u.Host),
+		Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup object: %w", err)
+	}
+	defer output.Body.Close()
+	return io.ReadAll(output.Body)
+}
+
+func (app *App) s3Client(opt BackupOption) *s3.Client {
+	return s3.NewFromConfig(app.awsCfg, func(o *s3.Options) {
+		if opt.BackupS3Endpoint != "" {
+			o.BaseEndpoint = aws.String(opt.BackupS3Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+}
+
+func parseS3URL(location string) (*url.URL, bool) {
+	if !strings.HasPrefix(location, "s3://") {
+		return nil, false
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, false
+	}
+	return u, true
+}
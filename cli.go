@@ -16,15 +16,24 @@ type CLI struct {
 	AWSAccountID string `help:"QuickSight aws account id"`
 	Region       string `help:"AWS region" short:"r" env:"AWS_REGION"`
 	LogLevel     string `help:"output log level" env:"LOG_LEVEL" default:"info"`
+	Config       string `help:"project configuration file, default .redshift-data-set-annotator.yaml in the working directory" type:"path"`
+	Profile      string `help:"profile of the configuration used as the default profile" env:"RSDSA_PROFILE"`
 
 	Configure *ConfigureOption `cmd:"" help:"Create a configuration file of redshift-data-set-annotator"`
 	Annotate  *AnnotateOption  `cmd:"" help:"Annotate a QuickSight dataset with Redshift as the data source"`
+	Restore   *RestoreOption   `cmd:"" help:"Restore a QuickSight dataset from a backup"`
+	Doctor    *DoctorOption    `cmd:"" help:"Validate the configuration and the connectivity to QuickSight and Redshift"`
+	Impact    *ImpactOption    `cmd:"" help:"Show the data sets, analyses and dashboards using a column of Redshift"`
+	Report    *ReportOption    `cmd:"" help:"Render a data dictionary of QuickSight datasets as Markdown and HTML"`
+	Export    *ExportOption    `cmd:"" help:"Export the field metadata of QuickSight datasets as YAML"`
+	Apply     *ApplyOption     `cmd:"" help:"Converge QuickSight datasets to the declarative spec files"`
+	Sync      *SyncOption      `cmd:"" help:"Annotate QuickSight datasets every interval until interrupted, exposing Prometheus metrics"`
 	Version   struct{}         `cmd:"" help:"Show version"`
 }
 
 func RunCLI(ctx context.Context, args []string) error {
 	var cli CLI
-	parser, err := kong.New(&cli, kong.Vars{"version": Version})
+	parser, err := kong.New(&cli, kong.Vars{"version": Version, "backup_location": defaultBackupLocation()})
 	if err != nil {
 		return err
 	}
@@ -45,11 +54,15 @@ func RunCLI(ctx context.Context, args []string) error {
 		Writer:   os.Stderr,
 	}
 	log.SetOutput(filter)
-	app, err := New(ctx, cli.AWSAccountID)
+	cmd := strings.Fields(kctx.Command())[0]
+	opts := []Option{WithConfigFile(cli.Config), WithProfile(cli.Profile)}
+	if cmd == "doctor" {
+		opts = append(opts, WithDeferredConfigErrors())
+	}
+	app, err := New(ctx, cli.AWSAccountID, opts...)
 	if err != nil {
 		return err
 	}
-	cmd := strings.Fields(kctx.Command())[0]
 	return app.Dispatch(ctx, cmd, &cli)
 }
 
@@ -59,6 +72,20 @@ func (app *App) Dispatch(ctx context.Context, command string, cli *CLI) error {
 		return app.RunConfigure(ctx, cli.Configure)
 	case "annotate":
 		return app.RunAnnotate(ctx, cli.Annotate)
+	case "restore":
+		return app.RunRestore(ctx, cli.Restore)
+	case "doctor":
+		return app.RunDoctor(ctx, cli.Doctor)
+	case "impact":
+		return app.RunImpact(ctx, cli.Impact)
+	case "report":
+		return app.RunReport(ctx, cli.Report)
+	case "export":
+		return app.RunExport(ctx, cli.Export)
+	case "apply":
+		return app.RunApply(ctx, cli.Apply)
+	case "sync":
+		return app.RunSync(ctx, cli.Sync)
 	case "version":
 		fmt.Printf("redshift-data-set-annotator %s\n", Version)
 		return nil
@@ -0,0 +1,127 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftserverless"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// QuickSightClient is the subset of the QuickSight API used by redshift-data-set-annotator.
+// *quicksight.Client satisfies this interface, and quicksighttest.Client is an in-memory fake of it.
+type QuickSightClient interface {
+	DescribeDataSet(ctx context.Context, params *quicksight.DescribeDataSetInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDataSetOutput, error)
+	DescribeDataSource(ctx context.Context, params *quicksight.DescribeDataSourceInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDataSourceOutput, error)
+	UpdateDataSet(ctx context.Context, params *quicksight.UpdateDataSetInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDataSetOutput, error)
+	ListDataSets(ctx context.Context, params *quicksight.ListDataSetsInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDataSetsOutput, error)
+	ListDataSources(ctx context.Context, params *quicksight.ListDataSourcesInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDataSourcesOutput, error)
+	ListAnalyses(ctx context.Context, params *quicksight.ListAnalysesInput, optFns ...func(*quicksight.Options)) (*quicksight.ListAnalysesOutput, error)
+	DescribeAnalysis(ctx context.Context, params *quicksight.DescribeAnalysisInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeAnalysisOutput, error)
+	DescribeAnalysisDefinition(ctx context.Context, params *quicksight.DescribeAnalysisDefinitionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeAnalysisDefinitionOutput, error)
+	ListDashboards(ctx context.Context, params *quicksight.ListDashboardsInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDashboardsOutput, error)
+	DescribeDashboard(ctx context.Context, params *quicksight.DescribeDashboardInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDashboardOutput, error)
+	DescribeDashboardDefinition(ctx context.Context, params *quicksight.DescribeDashboardDefinitionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDashboardDefinitionOutput, error)
+	UpdateAnalysis(ctx context.Context, params *quicksight.UpdateAnalysisInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateAnalysisOutput, error)
+	UpdateDashboard(ctx context.Context, params *quicksight.UpdateDashboardInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDashboardOutput, error)
+	UpdateDashboardPublishedVersion(ctx context.Context, params *quicksight.UpdateDashboardPublishedVersionInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDashboardPublishedVersionOutput, error)
+	DescribeIngestion(ctx context.Context, params *quicksight.DescribeIngestionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeIngestionOutput, error)
+	CancelIngestion(ctx context.Context, params *quicksight.CancelIngestionInput, optFns ...func(*quicksight.Options)) (*quicksight.CancelIngestionOutput, error)
+}
+
+// STSClient is the subset of the STS API used by redshift-data-set-annotator.
+type STSClient interface {
+	GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// redshiftCredentialsClient, redshiftServerlessCredentialsClient and secretsManagerClient get the credentials of the database
+// with the AWS config of the profile, for the `postgres` connection.
+type redshiftCredentialsClient interface {
+	GetClusterCredentials(ctx context.Context, params *redshift.GetClusterCredentialsInput, optFns ...func(*redshift.Options)) (*redshift.GetClusterCredentialsOutput, error)
+}
+
+type redshiftServerlessCredentialsClient interface {
+	GetCredentials(ctx context.Context, params *redshiftserverless.GetCredentialsInput, optFns ...func(*redshiftserverless.Options)) (*redshiftserverless.GetCredentialsOutput, error)
+}
+
+type secretsManagerClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// credentialsClients creates the clients of the database credentials, replaced in tests.
+type credentialsClients struct {
+	redshift           func(aws.Config) redshiftCredentialsClient
+	redshiftServerless func(aws.Config) redshiftServerlessCredentialsClient
+	secretsManager     func(aws.Config) secretsManagerClient
+}
+
+var defaultCredentialsClients = credentialsClients{
+	redshift: func(awsCfg aws.Config) redshiftCredentialsClient {
+		return redshift.NewFromConfig(awsCfg)
+	},
+	redshiftServerless: func(awsCfg aws.Config) redshiftServerlessCredentialsClient {
+		return redshiftserverless.NewFromConfig(awsCfg)
+	},
+	secretsManager: func(awsCfg aws.Config) secretsManagerClient {
+		return secretsmanager.NewFromConfig(awsCfg)
+	},
+}
+
+// Option configures the App created by New.
+type Option func(*App)
+
+// WithQuickSightClient replaces the QuickSight client, e.g. with quicksighttest.Client.
+func WithQuickSightClient(client QuickSightClient) Option {
+	return func(app *App) {
+		app.client = client
+	}
+}
+
+// WithSTSClient replaces the STS client.
+func WithSTSClient(client STSClient) Option {
+	return func(app *App) {
+		app.stsClient = client
+	}
+}
+
+// WithConfig uses cfg instead of the configuration file.
+func WithConfig(cfg Config) Option {
+	return func(app *App) {
+		app.cfg = cfg
+	}
+}
+
+// WithConfigFile layers the project configuration file of path over the user configuration file.
+// If path is empty, .redshift-data-set-annotator.yaml in the working directory is used if exists.
+func WithConfigFile(path string) Option {
+	return func(app *App) {
+		app.cfgFile = path
+	}
+}
+
+// WithProfile selects the profile of the configuration used instead of the default profile,
+// e.g. for the QuickSight account and region.
+func WithProfile(name string) Option {
+	return func(app *App) {
+		app.profileName = name
+	}
+}
+
+// WithDeferredConfigErrors keeps New from failing on a malformed configuration file, invalid RSDSA_* environment variables
+// or an unknown profile. The error is reported by doctor, and the empty configuration is used instead.
+func WithDeferredConfigErrors() Option {
+	return func(app *App) {
+		app.deferConfigErrors = true
+	}
+}
+
+// WithWriter replaces the output of the commands, the default is os.Stdout.
+func WithWriter(w io.Writer) Option {
+	return func(app *App) {
+		app.w = w
+	}
+}
@@ -6,17 +6,153 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
 	"github.com/jmoiron/sqlx"
 	redshiftdatasqldriver "github.com/mashiike/redshift-data-sql-driver"
+	"github.com/samber/lo"
 )
 
 type ColumnAnnotation struct {
-	CoumnName   string  `db:"column_name"`
-	Name        *string `db:"name"`
-	Description *string `db:"description"`
+	CoumnName   string            `db:"column_name"`
+	Name        *string           `db:"name"`
+	Description *string           `db:"description"`
+	DataType    *string           `db:"data_type"`
+	Hints       map[string]string `db:"-"`
+}
+
+// hintKeys are the keys of the hints, `@key: value` lines with other keys are left in the description.
+var hintKeys = []string{
+	"geographic_role", "geo", "geo_hierarchy", "geo_country",
+	"hidden", "restricted", "pii", "folder", "cast",
+}
+
+// parseComment splits the comment read as the name and description in the comment format.
+func (annotation *ColumnAnnotation) parseComment(format commentFormat) {
+	if !aws.ToBool(format.NameLine) && annotation.Name != nil {
+		// the first line is a part of the description
+		lines := []string{*annotation.Name}
+		if annotation.Description != nil {
+			lines = append(lines, *annotation.Description)
+		}
+		annotation.Name = nil
+		annotation.Description = nillif(strings.Join(lines, "\n"), "")
+	}
+	annotation.parseHints(format.HintPrefix)
+}
+
+// parseHints extracts `@key: value` lines of the known hint keys from the description into Hints.
+// prefix is `@` by default, and configured by comment_format of the project configuration file.
+func (annotation *ColumnAnnotation) parseHints(prefix string) {
+	annotation.Hints = make(map[string]string)
+	if annotation.Description == nil {
+		return
+	}
+	lines := strings.Split(*annotation.Description, "\n")
+	descriptionLines := make([]string, 0, len(lines))
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, prefix) {
+			descriptionLines = append(descriptionLines, line)
+			continue
+		}
+		key, value, _ := strings.Cut(strings.TrimPrefix(trimmed, prefix), ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !lo.Contains(hintKeys, key) {
+			descriptionLines = append(descriptionLines, line)
+			continue
+		}
+		annotation.Hints[key] = strings.TrimSpace(value)
+	}
+	annotation.Description = nillif(strings.TrimSpace(strings.Join(descriptionLines, "\n")), "")
+}
+
+// Hint returns the value of the first hint found in keys.
+func (annotation *ColumnAnnotation) Hint(keys ...string) (string, bool) {
+	for _, key := range keys {
+		if value, ok := annotation.Hints[key]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// GeographicRole returns the geographic role specified by the `@geographic_role` (or `@geo`) hint.
+func (annotation *ColumnAnnotation) GeographicRole() (types.GeoSpatialDataRole, error) {
+	value, ok := annotation.Hint("geographic_role", "geo")
+	if !ok {
+		return "", nil
+	}
+	return parseGeographicRole(value)
+}
+
+// Hidden reports whether the `@hidden` hint is specified.
+func (annotation *ColumnAnnotation) Hidden() bool {
+	_, ok := annotation.Hint("hidden")
+	return ok
+}
+
+// Restricted returns the classification specified by the `@restricted` hint.
+// The `@pii` hint is a shorthand of `@restricted: pii`.
+func (annotation *ColumnAnnotation) Restricted() (string, bool) {
+	if value, ok := annotation.Hint("restricted"); ok && value != "" {
+		return strings.ToLower(value), true
+	}
+	if _, ok := annotation.Hint("pii"); ok {
+		return "pii", true
+	}
+	return "", false
+}
+
+// Folder returns the field folder path specified by the `@folder` hint.
+func (annotation *ColumnAnnotation) Folder() (string, bool) {
+	value, ok := annotation.Hint("folder")
+	if !ok {
+		return "", false
+	}
+	folder := normalizeFolderPath(value)
+	return folder, folder != ""
+}
+
+// GeoHierarchy returns the geographic hierarchy name and country code specified by the `@geo_hierarchy` and `@geo_country` hints.
+func (annotation *ColumnAnnotation) GeoHierarchy() (string, types.GeoSpatialCountryCode, error) {
+	name, ok := annotation.Hint("geo_hierarchy")
+	if !ok || name == "" {
+		return "", "", nil
+	}
+	value, ok := annotation.Hint("geo_country")
+	if !ok {
+		return name, "", nil
+	}
+	countryCode, err := parseGeoSpatialCountryCode(value)
+	if err != nil {
+		return "", "", err
+	}
+	return name, countryCode, nil
+}
+
+// CastType returns the data type of the field specified by the `@cast` hint.
+func (annotation *ColumnAnnotation) CastType() (types.ColumnDataType, error) {
+	value, ok := annotation.Hint("cast")
+	if !ok {
+		return "", nil
+	}
+	castType := types.ColumnDataType(strings.ToUpper(strings.TrimSpace(value)))
+	if !lo.Contains(castType.Values(), castType) {
+		return "", fmt.Errorf("unknown cast type `%s`", value)
+	}
+	return castType, nil
+}
+
+func parseGeographicRole(str string) (types.GeoSpatialDataRole, error) {
+	role := types.GeoSpatialDataRole(strings.ToUpper(strings.TrimSpace(str)))
+	if !lo.Contains(role.Values(), role) {
+		return "", fmt.Errorf("unknown geographic role `%s`", str)
+	}
+	return role, nil
 }
 
 type ColumnAnnotations map[string]*ColumnAnnotation
@@ -27,35 +163,124 @@ with comments as (
         schemaname
         ,relname as tablename
         ,attname as columnname
-        ,trim('\n' from description) as comment
+        ,format_type(atttypid, atttypmod) as datatype
+        ,trim(chr(10) from description) as comment
     from pg_stat_user_tables, pg_attribute
     left join pg_description colcom ON pg_attribute.attnum = colcom.objsubid and pg_attribute.attrelid = colcom.objoid
     where pg_attribute.attrelid = pg_stat_user_tables.relid
 )
 select
     columnname as column_name
-    ,trim(split_part(comment,'\n',1)) as name
-    ,case when strpos(comment,'\n') > 0 then nullif(trim(substring(comment from strpos(comment,'\n')+1 )),'') end as description
+    ,trim(split_part(comment,chr(10),1)) as name
+    ,case when strpos(comment,chr(10)) > 0 then nullif(trim(substring(comment from strpos(comment,chr(10))+1 )),'') end as description
+    ,datatype as data_type
 from comments
 where schemaname = :schema
     and tablename = :table
 `
 
+const tableCommentStatement = `
+select
+    trim(chr(10) from description) as comment
+from pg_stat_user_tables
+join pg_description on pg_description.objoid = pg_stat_user_tables.relid and pg_description.objsubid = 0
+where schemaname = :schema
+    and relname = :table
+`
+
 func (app *App) GetColumnAnnotations(ctx context.Context, ds *types.DataSource, table types.RelationalTable) (ColumnAnnotations, error) {
-	parameters, ok := ds.DataSourceParameters.(*types.DataSourceParametersMemberRedshiftParameters)
-	if !ok {
-		return nil, errors.New("data source is not redshift")
-	}
-	dsn, err := app.GetDSN(parameters.Value)
+	catalog, err := app.getRelationCatalog(ctx, ds, table, false)
 	if err != nil {
 		return nil, err
 	}
-	db, err := sqlx.Open("redshift-data", dsn)
+	return catalog.Columns, nil
+}
+
+// relationCatalog is the comments and types of a relation read from the catalog of Redshift.
+type relationCatalog struct {
+	Comment *string
+	Columns ColumnAnnotations
+}
+
+// getRelationCatalog reads the column annotations of the relation through the catalog cache,
+// and the table comment on the same connection if withComment.
+func (app *App) getRelationCatalog(ctx context.Context, ds *types.DataSource, table types.RelationalTable, withComment bool) (*relationCatalog, error) {
+	key := fmt.Sprintf("%s/%s.%s", coalesce(ds.Arn), coalesce(table.Schema), coalesce(table.Name))
+	if app.catalog != nil {
+		if columnAnnotations, ok := app.catalog.columnAnnotations[key]; ok {
+			comment, commented := app.catalog.tableComments[key]
+			if !withComment || commented {
+				log.Printf("[debug] column annotations of `%s.%s` from the catalog cache", *table.Schema, *table.Name)
+				return &relationCatalog{Comment: comment, Columns: columnAnnotations}, nil
+			}
+		}
+	}
+	db, err := app.openRedshift(ctx, ds)
 	if err != nil {
 		return nil, err
 	}
 	defer db.Close()
-	rows, err := db.QueryxContext(ctx, queryStatement, sql.Named("schema", *table.Schema), sql.Named("table", *table.Name))
+	start := time.Now()
+	columnAnnotations, err := queryColumnAnnotations(ctx, db, *table.Schema, *table.Name, app.settings.format())
+	if err != nil {
+		return nil, err
+	}
+	for columnName := range columnAnnotations {
+		if app.settings.ignoreColumn(*table.Schema, *table.Name, columnName) {
+			log.Printf("[debug] ignore the comment of `%s.%s.%s` by the project configuration", *table.Schema, *table.Name, columnName)
+			delete(columnAnnotations, columnName)
+		}
+	}
+	catalog := &relationCatalog{Columns: columnAnnotations}
+	if withComment {
+		catalog.Comment, err = QueryTableComment(ctx, db, *table.Schema, *table.Name)
+		if err != nil {
+			return nil, fmt.Errorf("QueryTableComment: %w", err)
+		}
+	}
+	if app.catalog != nil {
+		app.catalog.observe(time.Since(start))
+		app.catalog.columnAnnotations[key] = columnAnnotations
+		if withComment {
+			app.catalog.tableComments[key] = catalog.Comment
+		}
+	}
+	return catalog, nil
+}
+
+func (app *App) openRedshift(ctx context.Context, ds *types.DataSource) (*sqlx.DB, error) {
+	profile, target, err := app.redshiftProfile(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	switch connection := coalesce(profile.Connection, aws.String(connectionDataAPI)); connection {
+	case connectionDataAPI:
+		dsn, err := app.GetDSN(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+		return openRedshiftData(dsn, newRedshiftDataClient)
+	case connectionPostgres:
+		dsn, err := app.GetPostgresDSN(ctx, ds)
+		if err != nil {
+			return nil, err
+		}
+		return sqlx.Open("postgres", dsn)
+	default:
+		return nil, fmt.Errorf("unknown connection `%s` for %s", connection, target)
+	}
+}
+
+// QueryColumnAnnotations reads the column comments of the relation.
+// db is opened with the redshift-data driver or a PostgreSQL driver,
+// so the query can be tested against a local PostgreSQL with `COMMENT ON COLUMN`.
+func QueryColumnAnnotations(ctx context.Context, db *sqlx.DB, schema string, table string) (ColumnAnnotations, error) {
+	return queryColumnAnnotations(ctx, db, schema, table, projectSettings{}.format())
+}
+
+// queryColumnAnnotations reads the column comments of the relation in the comment format.
+func queryColumnAnnotations(ctx context.Context, db *sqlx.DB, schema string, table string, format commentFormat) (ColumnAnnotations, error) {
+	rows, err := queryRelation(ctx, db, queryStatement, schema, table)
 	if err != nil {
 		return nil, err
 	}
@@ -66,40 +291,109 @@ func (app *App) GetColumnAnnotations(ctx context.Context, ds *types.DataSource,
 		if err := rows.StructScan(&annotation); err != nil {
 			return nil, err
 		}
+		annotation.parseComment(format)
 		annotations[annotation.CoumnName] = &annotation
 	}
-	return annotations, nil
+	return annotations, rows.Err()
 }
 
-func (app *App) GetDSN(params types.RedshiftParameters) (string, error) {
+// GetDSN returns the DSN of the redshift-data driver.
+// The credentials are, in order of precedence, the secret_arn of the profile, the IAM identity (serverless),
+// the db_user of the profile (temporary credentials of provisioned clusters) and the secret of the data source.
+func (app *App) GetDSN(ctx context.Context, ds *types.DataSource) (string, error) {
+	parameters, ok := ds.DataSourceParameters.(*types.DataSourceParametersMemberRedshiftParameters)
+	if !ok {
+		return "", errors.New("data source is not redshift")
+	}
+	params := parameters.Value
 	log.Printf("[debug] connect to redshift host=%s database=%s ",
 		coalesce(params.Host),
 		coalesce(params.Database),
 	)
-	host := coalesce(params.Host)
+	profile, target, err := app.redshiftProfile(ctx, ds)
+	if err != nil {
+		return "", err
+	}
 	cfg := &redshiftdatasqldriver.RedshiftDataConfig{
-		Database: aws.String(coalesce(params.Database)),
+		Database: aws.String(coalesce(profile.Database, params.Database)),
 	}
-
-	if isServeless(host) {
-		cfg.WorkgroupName = aws.String(getWorkgroupName(host))
-		return cfg.String(), nil
+	if profile.AWSProfile != nil {
+		setDSNParam(cfg, dsnParamAWSProfile, *profile.AWSProfile)
 	}
-	profile, ok := app.cfg.Get(host)
-	if !ok {
-		profile = app.cfg.GetDefault()
+	if profile.AWSRegion != nil {
+		cfg = cfg.WithRegion(*profile.AWSRegion)
+	}
+	if profile.RoleArn != nil {
+		setDSNParam(cfg, dsnParamRoleArn, *profile.RoleArn)
+	}
+	if profile.SecretArn != nil {
+		return getSecretDSN(cfg, target, profile, *profile.SecretArn)
+	}
+	if target.WorkgroupName != "" {
+		cfg.WorkgroupName = aws.String(target.WorkgroupName)
+		return cfg.String(), nil
 	}
 	cfg.DbUser = profile.DBUser
 	if cfg.DbUser == nil {
-		return "", fmt.Errorf("redshift db user not configured for %s, please execute `redshift-data-set-annotator configure`", host)
+		if ds.SecretArn != nil {
+			log.Printf("[debug] use the secret of the data source %s", *ds.SecretArn)
+			return getSecretDSN(cfg, target, profile, *ds.SecretArn)
+		}
+		return "", fmt.Errorf("redshift db user not configured for %s, please execute `redshift-data-set-annotator configure`", target)
 	}
-	if isProvisoned(host) {
-		cfg.ClusterIdentifier = aws.String(getCluseterID(host))
-	} else {
-		cfg.ClusterIdentifier = profile.ClusterIdentifier
+	cfg.ClusterIdentifier = profile.ClusterIdentifier
+	if target.ClusterIdentifier != "" {
+		cfg.ClusterIdentifier = aws.String(target.ClusterIdentifier)
 	}
 	if cfg.ClusterIdentifier == nil {
-		return "", fmt.Errorf("redshift cluster idnetifier not configured for %s, please execute `redshift-data-set-annotator configure`", host)
+		return "", fmt.Errorf("redshift cluster idnetifier not configured for %s, please execute `redshift-data-set-annotator configure`", target)
 	}
 	return cfg.String(), nil
 }
+
+func getSecretDSN(cfg *redshiftdatasqldriver.RedshiftDataConfig, target *redshiftTarget, profile *ProfileConfig, secretArn string) (string, error) {
+	cfg.SecretsARN = aws.String(secretArn)
+	setDSNParam(cfg, dsnParamDatabase, *cfg.Database)
+	switch {
+	case target.WorkgroupName != "":
+		setDSNParam(cfg, dsnParamWorkgroupName, target.WorkgroupName)
+	case target.ClusterIdentifier != "":
+		setDSNParam(cfg, dsnParamClusterIdentifier, target.ClusterIdentifier)
+	case profile.ClusterIdentifier != nil:
+		setDSNParam(cfg, dsnParamClusterIdentifier, *profile.ClusterIdentifier)
+	case profile.WorkgroupName != nil:
+		setDSNParam(cfg, dsnParamWorkgroupName, *profile.WorkgroupName)
+	default:
+		return "", fmt.Errorf("redshift cluster idnetifier not configured for %s, please execute `redshift-data-set-annotator configure`", target)
+	}
+	return cfg.String(), nil
+}
+
+// QueryTableComment reads the comment of the relation. It returns nil if the relation has no comment.
+func QueryTableComment(ctx context.Context, db *sqlx.DB, schema string, table string) (*string, error) {
+	rows, err := queryRelation(ctx, db, tableCommentStatement, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var comment *string
+	for rows.Next() {
+		if err := rows.Scan(&comment); err != nil {
+			return nil, err
+		}
+	}
+	return comment, rows.Err()
+}
+
+// queryRelation runs the statement with the named parameters :schema and :table.
+// The redshift-data driver binds named parameters by itself, and the others need positional parameters.
+func queryRelation(ctx context.Context, db *sqlx.DB, statement string, schema string, table string) (*sqlx.Rows, error) {
+	if db.DriverName() == "redshift-data" {
+		return db.QueryxContext(ctx, statement, sql.Named("schema", schema), sql.Named("table", table))
+	}
+	query, args, err := sqlx.Named(statement, map[string]interface{}{"schema": schema, "table": table})
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryxContext(ctx, db.Rebind(query), args...)
+}
@@ -0,0 +1,199 @@
+package redshiftdatasetannotator
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// geographicRoleRank is the order of the columns in a geographic hierarchy.
+var geographicRoleRank = map[types.GeoSpatialDataRole]int{
+	types.GeoSpatialDataRoleCountry:  0,
+	types.GeoSpatialDataRoleState:    1,
+	types.GeoSpatialDataRoleCounty:   2,
+	types.GeoSpatialDataRoleCity:     3,
+	types.GeoSpatialDataRolePostcode: 4,
+}
+
+type geoHierarchyMember struct {
+	ColumnName string
+	Role       types.GeoSpatialDataRole
+}
+
+type geoHierarchy struct {
+	Name        string
+	CountryCode types.GeoSpatialCountryCode
+	Members     []geoHierarchyMember
+}
+
+func (h *geoHierarchy) add(columnName string, role types.GeoSpatialDataRole, countryCode types.GeoSpatialCountryCode) error {
+	if _, ok := geographicRoleRank[role]; !ok {
+		return fmt.Errorf("geographic hierarchy `%s`: column `%s` has geographic role `%s`, that can not be a member of hierarchy", h.Name, columnName, role)
+	}
+	for _, member := range h.Members {
+		if member.Role == role {
+			return fmt.Errorf("geographic hierarchy `%s`: columns `%s` and `%s` have the same geographic role `%s`", h.Name, member.ColumnName, columnName, role)
+		}
+	}
+	if countryCode != "" {
+		if h.CountryCode != "" && h.CountryCode != countryCode {
+			return fmt.Errorf("geographic hierarchy `%s`: country code mismatch `%s` and `%s`", h.Name, h.CountryCode, countryCode)
+		}
+		h.CountryCode = countryCode
+	}
+	h.Members = append(h.Members, geoHierarchyMember{ColumnName: columnName, Role: role})
+	return nil
+}
+
+// Columns returns the member columns ordered from country to postcode.
+func (h *geoHierarchy) Columns() []string {
+	members := cloneSlice(h.Members)
+	sort.SliceStable(members, func(i, j int) bool {
+		return geographicRoleRank[members[i].Role] < geographicRoleRank[members[j].Role]
+	})
+	return lo.Map(members, func(member geoHierarchyMember, _ int) string {
+		return member.ColumnName
+	})
+}
+
+func parseGeoSpatialCountryCode(str string) (types.GeoSpatialCountryCode, error) {
+	code := types.GeoSpatialCountryCode(strings.ToUpper(strings.TrimSpace(str)))
+	if !lo.Contains(code.Values(), code) {
+		return "", fmt.Errorf("unknown geographic country code `%s`", str)
+	}
+	return code, nil
+}
+
+// columnGeographicRoles returns the geographic role of each column tagged in the logical tables.
+func columnGeographicRoles(logicalTableMap map[string]types.LogicalTable) map[string]types.GeoSpatialDataRole {
+	roles := make(map[string]types.GeoSpatialDataRole)
+	for _, logicalTable := range logicalTableMap {
+		for _, transform := range logicalTable.DataTransforms {
+			op, ok := transform.(*types.TransformOperationMemberTagColumnOperation)
+			if !ok {
+				continue
+			}
+			for _, tag := range op.Value.Tags {
+				if tag.ColumnGeographicRole != "" {
+					roles[coalesce(op.Value.ColumnName)] = tag.ColumnGeographicRole
+				}
+			}
+		}
+	}
+	return roles
+}
+
+// mergeColumns returns the columns of the hierarchy merged with the current members of the column group.
+// A current member is kept unless an annotated column takes over its geographic role;
+// the columns are ordered from country to postcode, members of unknown role last.
+func (h *geoHierarchy) mergeColumns(current []string, roles map[string]types.GeoSpatialDataRole) []string {
+	members := cloneSlice(h.Members)
+	for _, columnName := range current {
+		if lo.ContainsBy(members, func(member geoHierarchyMember) bool { return member.ColumnName == columnName }) {
+			continue
+		}
+		role := roles[columnName]
+		if role != "" && lo.ContainsBy(h.Members, func(member geoHierarchyMember) bool { return member.Role == role }) {
+			log.Printf("[debug] geospatial column group `%s`: column `%s` is replaced by the annotated column of geographic role `%s`", h.Name, columnName, role)
+			continue
+		}
+		members = append(members, geoHierarchyMember{ColumnName: columnName, Role: role})
+	}
+	rank := func(role types.GeoSpatialDataRole) int {
+		if r, ok := geographicRoleRank[role]; ok {
+			return r
+		}
+		return len(geographicRoleRank)
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return rank(members[i].Role) < rank(members[j].Role)
+	})
+	return lo.Map(members, func(member geoHierarchyMember, _ int) string {
+		return member.ColumnName
+	})
+}
+
+// setGeoSpatialColumnGroup creates or rewrites the geospatial column group of the hierarchy.
+// The annotated columns are merged into the current members of the group, roles are the geographic roles of the data set columns.
+// A new group requires the country code of the hierarchy.
+// Reports whether the column groups have been changed.
+func setGeoSpatialColumnGroup(columnGroups []types.ColumnGroup, h *geoHierarchy, roles map[string]types.GeoSpatialDataRole) ([]types.ColumnGroup, bool, error) {
+	for i, group := range columnGroups {
+		if group.GeoSpatialColumnGroup == nil || coalesce(group.GeoSpatialColumnGroup.Name) != h.Name {
+			continue
+		}
+		columns := h.mergeColumns(group.GeoSpatialColumnGroup.Columns, roles)
+		countryCode := group.GeoSpatialColumnGroup.CountryCode
+		if h.CountryCode != "" {
+			countryCode = h.CountryCode
+		}
+		if countryCode == group.GeoSpatialColumnGroup.CountryCode &&
+			strings.Join(group.GeoSpatialColumnGroup.Columns, ",") == strings.Join(columns, ",") {
+			return columnGroups, false, nil
+		}
+		columnGroups[i] = types.ColumnGroup{
+			GeoSpatialColumnGroup: &types.GeoSpatialColumnGroup{
+				Name:        aws.String(h.Name),
+				Columns:     columns,
+				CountryCode: countryCode,
+			},
+		}
+		log.Printf("[debug] rewrite geospatial column group `%s` columns=%v", h.Name, columns)
+		return columnGroups, true, nil
+	}
+	if h.CountryCode == "" {
+		return nil, false, fmt.Errorf("geographic hierarchy `%s`: country code is required to create the hierarchy, add `@geo_country` hint to one of the columns", h.Name)
+	}
+	columns := h.Columns()
+	columnGroups = append(columnGroups, types.ColumnGroup{
+		GeoSpatialColumnGroup: &types.GeoSpatialColumnGroup{
+			Name:        aws.String(h.Name),
+			Columns:     columns,
+			CountryCode: h.CountryCode,
+		},
+	})
+	log.Printf("[debug] new geospatial column group `%s` columns=%v", h.Name, columns)
+	return columnGroups, true, nil
+}
+
+// renameColumnGroupColumns rewrites the column name referenced by column groups.
+// Reports whether the column groups have been changed.
+func renameColumnGroupColumns(columnGroups []types.ColumnGroup, oldColumnName, newColumnName string) bool {
+	var changed bool
+	for i, group := range columnGroups {
+		if group.GeoSpatialColumnGroup == nil || !lo.Contains(group.GeoSpatialColumnGroup.Columns, oldColumnName) {
+			continue
+		}
+		cloned := *group.GeoSpatialColumnGroup
+		cloned.Columns = lo.Map(cloned.Columns, func(columnName string, _ int) string {
+			if columnName == oldColumnName {
+				return newColumnName
+			}
+			return columnName
+		})
+		columnGroups[i] = types.ColumnGroup{GeoSpatialColumnGroup: &cloned}
+		log.Printf("[debug] change geospatial column group `%s` column `%s` to `%s`", coalesce(cloned.Name), oldColumnName, newColumnName)
+		changed = true
+	}
+	return changed
+}
+
+// validateColumnGroups checks that every column referenced by column groups exists in the data set.
+func validateColumnGroups(columnGroups []types.ColumnGroup, columnNames []string) error {
+	for _, group := range columnGroups {
+		if group.GeoSpatialColumnGroup == nil {
+			continue
+		}
+		for _, columnName := range group.GeoSpatialColumnGroup.Columns {
+			if !lo.Contains(columnNames, columnName) {
+				return fmt.Errorf("geospatial column group `%s` references column `%s`, that does not exist in data set", coalesce(group.GeoSpatialColumnGroup.Name), columnName)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package redshiftdatasetannotator
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+func TestSetGeoSpatialColumnGroupMergesMembers(t *testing.T) {
+	columnGroups := []types.ColumnGroup{
+		{GeoSpatialColumnGroup: &types.GeoSpatialColumnGroup{
+			Name:        aws.String("region"),
+			Columns:     []string{"country", "city"},
+			CountryCode: types.GeoSpatialCountryCodeUs,
+		}},
+	}
+	h := &geoHierarchy{Name: "region"}
+	if err := h.add("state", types.GeoSpatialDataRoleState, ""); err != nil {
+		t.Fatal(err)
+	}
+	roles := map[string]types.GeoSpatialDataRole{
+		"country": types.GeoSpatialDataRoleCountry,
+		"city":    types.GeoSpatialDataRoleCity,
+	}
+	columnGroups, changed, err := setGeoSpatialColumnGroup(columnGroups, h, roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatal("column groups are not changed")
+	}
+	group := columnGroups[0].GeoSpatialColumnGroup
+	if want := []string{"country", "state", "city"}; !reflect.DeepEqual(group.Columns, want) {
+		t.Errorf("columns = %v, want %v", group.Columns, want)
+	}
+	if group.CountryCode != types.GeoSpatialCountryCodeUs {
+		t.Errorf("country code = %s, want US", group.CountryCode)
+	}
+}
+
+func TestSetGeoSpatialColumnGroupRequiresCountryCode(t *testing.T) {
+	h := &geoHierarchy{Name: "region"}
+	if err := h.add("state", types.GeoSpatialDataRoleState, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := setGeoSpatialColumnGroup(nil, h, nil); err == nil {
+		t.Error("new geospatial column group without country code succeeded, want error")
+	}
+	if err := h.add("city", types.GeoSpatialDataRoleCity, types.GeoSpatialCountryCodeUs); err != nil {
+		t.Fatal(err)
+	}
+	columnGroups, _, err := setGeoSpatialColumnGroup(nil, h, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := columnGroups[0].GeoSpatialColumnGroup.CountryCode; got != types.GeoSpatialCountryCodeUs {
+		t.Errorf("country code = %s, want US", got)
+	}
+}
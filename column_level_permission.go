@@ -0,0 +1,127 @@
+package redshiftdatasetannotator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// columnLevelPermissionPlan collects the columns to be restricted, grouped by the principals allowed to access them.
+type columnLevelPermissionPlan struct {
+	rules map[string]*types.ColumnLevelPermissionRule
+	keys  []string
+}
+
+func newColumnLevelPermissionPlan() *columnLevelPermissionPlan {
+	return &columnLevelPermissionPlan{
+		rules: make(map[string]*types.ColumnLevelPermissionRule),
+	}
+}
+
+func principalsKey(principals []string) string {
+	sorted := cloneSlice(principals)
+	sort.Strings(sorted)
+	return strings.Join(lo.Uniq(sorted), ",")
+}
+
+// Add restricts the column to the principals configured for the classification.
+func (plan *columnLevelPermissionPlan) Add(profile *ProfileConfig, classification string, columnName string) error {
+	var principals []string
+	for key, value := range profile.ColumnLevelPermissions {
+		if strings.EqualFold(key, classification) {
+			principals = value
+			break
+		}
+	}
+	if len(principals) == 0 {
+		return fmt.Errorf("column `%s`: principals for restricted classification `%s` are not configured", columnName, classification)
+	}
+	key := principalsKey(principals)
+	rule, ok := plan.rules[key]
+	if !ok {
+		rule = &types.ColumnLevelPermissionRule{
+			Principals: cloneSlice(principals),
+		}
+		plan.rules[key] = rule
+		plan.keys = append(plan.keys, key)
+	}
+	if !lo.Contains(rule.ColumnNames, columnName) {
+		rule.ColumnNames = append(rule.ColumnNames, columnName)
+	}
+	return nil
+}
+
+// Apply extends the rules with the same principals, or appends new rules.
+// Columns are never removed from existing rules.
+// Returns the new rules and the human readable changes.
+// Because the rules restricting a column are combined as a union of the principals, a column restricted by
+// a rule of other principals is not added, as it widens the access to the column. Such columns are reported
+// in the changes and as an error.
+func (plan *columnLevelPermissionPlan) Apply(current []types.ColumnLevelPermissionRule) ([]types.ColumnLevelPermissionRule, []string, error) {
+	rules := make([]types.ColumnLevelPermissionRule, 0, len(current)+len(plan.keys))
+	for _, rule := range current {
+		rules = append(rules, types.ColumnLevelPermissionRule{
+			ColumnNames: cloneSlice(rule.ColumnNames),
+			Principals:  cloneSlice(rule.Principals),
+		})
+	}
+	changes := make([]string, 0)
+	widened := make([]string, 0)
+	for _, key := range plan.keys {
+		planned := plan.rules[key]
+		columnNames := make([]string, 0, len(planned.ColumnNames))
+		for _, columnName := range planned.ColumnNames {
+			var conflicted bool
+			for i, rule := range current {
+				if principalsKey(rule.Principals) == key || !lo.Contains(rule.ColumnNames, columnName) {
+					continue
+				}
+				changes = append(changes, fmt.Sprintf("! ColumnLevelPermissionRules[%d] principals=%v already restricts column `%s`, adding principals=%v widens the access", i, rule.Principals, columnName, planned.Principals))
+				conflicted = true
+			}
+			if conflicted {
+				widened = append(widened, columnName)
+				continue
+			}
+			columnNames = append(columnNames, columnName)
+		}
+		if len(columnNames) == 0 {
+			continue
+		}
+		index := -1
+		for i, rule := range rules {
+			if principalsKey(rule.Principals) == key {
+				index = i
+				break
+			}
+		}
+		if index < 0 {
+			rules = append(rules, types.ColumnLevelPermissionRule{
+				ColumnNames: columnNames,
+				Principals:  cloneSlice(planned.Principals),
+			})
+			changes = append(changes, fmt.Sprintf("+ ColumnLevelPermissionRules[%d] principals=%v columns=%v", len(rules)-1, planned.Principals, columnNames))
+			continue
+		}
+		added := lo.Without(columnNames, rules[index].ColumnNames...)
+		if len(added) == 0 {
+			continue
+		}
+		rules[index].ColumnNames = append(rules[index].ColumnNames, added...)
+		changes = append(changes, fmt.Sprintf("~ ColumnLevelPermissionRules[%d] principals=%v add columns=%v", index, rules[index].Principals, added))
+	}
+	if len(widened) > 0 {
+		return rules, changes, fmt.Errorf("columns %v are restricted by ColumnLevelPermissionRules of other principals, adding them widens the access", widened)
+	}
+	return rules, changes, nil
+}
+
+func printColumnLevelPermissionChanges(w io.Writer, changes []string) {
+	for _, change := range changes {
+		fmt.Fprintln(w, change)
+	}
+}
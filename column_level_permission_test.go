@@ -0,0 +1,112 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+const (
+	testPIIReaders   = "arn:aws:quicksight:ap-northeast-1:123456789012:group/default/pii-readers"
+	testAdminReaders = "arn:aws:quicksight:ap-northeast-1:123456789012:group/default/admins"
+)
+
+// runTestColumnLevelPermission annotates the data set users, whose pref_code column has the `@pii` hint,
+// with the column level permissions of the classifications, and returns the ColumnLevelPermissionRules.
+func runTestColumnLevelPermission(t *testing.T, current []types.ColumnLevelPermissionRule, columnLevelPermissions map[string][]string) ([]types.ColumnLevelPermissionRule, string, error) {
+	t.Helper()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	dataSet := testDataSet("users")
+	dataSet.ColumnLevelPermissionRules = current
+	client.PutDataSet(dataSet)
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	app.cfg = Config{
+		defaultProfileName: &ProfileConfig{ColumnLevelPermissions: columnLevelPermissions},
+	}
+	key := testArn("datasource/warehouse") + "/public.users"
+	app.catalog = &catalogCache{
+		columnAnnotations: map[string]ColumnAnnotations{
+			key: {"pref_code": &ColumnAnnotation{CoumnName: "pref_code", Hints: map[string]string{"pii": ""}}},
+		},
+		tableComments: make(map[string]*string),
+		observe:       func(time.Duration) { t.Error("Redshift is queried") },
+	}
+	err := app.RunAnnotate(context.Background(), &AnnotateOption{
+		DataSetID:                  "users",
+		ApplyColumnLevelPermission: true,
+		OnConflict:                 "abort",
+		BackupOption:               BackupOption{NoBackup: true},
+		IngestionOption:            IngestionOption{SpiceRefresh: "allow"},
+	})
+	updated, _ := client.DataSet(testAWSAccountID, "users")
+	return updated.ColumnLevelPermissionRules, buf.String(), err
+}
+
+func TestColumnLevelPermissionNewRule(t *testing.T) {
+	rules, plan, err := runTestColumnLevelPermission(t, nil, map[string][]string{"pii": {testPIIReaders}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.ColumnLevelPermissionRule{
+		{ColumnNames: []string{"pref_code"}, Principals: []string{testPIIReaders}},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+	if !strings.Contains(plan, "+ ColumnLevelPermissionRules[0]") {
+		t.Errorf("plan = %q, want the new rule", plan)
+	}
+}
+
+func TestColumnLevelPermissionAppendToRule(t *testing.T) {
+	current := []types.ColumnLevelPermissionRule{
+		{ColumnNames: []string{"id"}, Principals: []string{testPIIReaders}},
+	}
+	rules, plan, err := runTestColumnLevelPermission(t, current, map[string][]string{"pii": {testPIIReaders}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.ColumnLevelPermissionRule{
+		{ColumnNames: []string{"id", "pref_code"}, Principals: []string{testPIIReaders}},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("rules = %+v, want %+v", rules, want)
+	}
+	if !strings.Contains(plan, "~ ColumnLevelPermissionRules[0]") {
+		t.Errorf("plan = %q, want the extended rule", plan)
+	}
+}
+
+func TestColumnLevelPermissionClassificationNotConfigured(t *testing.T) {
+	rules, _, err := runTestColumnLevelPermission(t, nil, map[string][]string{"finance": {testAdminReaders}})
+	if err == nil || !strings.Contains(err.Error(), "principals for restricted classification `pii` are not configured") {
+		t.Errorf("error = %v, want the classification is not configured", err)
+	}
+	if len(rules) != 0 {
+		t.Errorf("rules = %+v, want not updated", rules)
+	}
+}
+
+func TestColumnLevelPermissionWidening(t *testing.T) {
+	current := []types.ColumnLevelPermissionRule{
+		{ColumnNames: []string{"pref_code"}, Principals: []string{testAdminReaders}},
+	}
+	rules, plan, err := runTestColumnLevelPermission(t, current, map[string][]string{"pii": {testPIIReaders}})
+	if err == nil || !strings.Contains(err.Error(), "widens the access") {
+		t.Errorf("error = %v, want the access is widened", err)
+	}
+	if !reflect.DeepEqual(rules, current) {
+		t.Errorf("rules = %+v, want not updated", rules)
+	}
+	if !strings.Contains(plan, "! ColumnLevelPermissionRules[0] principals=["+testAdminReaders+"] already restricts column `pref_code`") {
+		t.Errorf("plan = %q, want the widening", plan)
+	}
+}
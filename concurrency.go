@@ -0,0 +1,58 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+// ErrConcurrentUpdate is returned when the data set has been updated between describe and update.
+var ErrConcurrentUpdate = errors.New("data set has been updated concurrently")
+
+// DataSetFingerprint returns a hash of the fields of the data set that can be changed by UpdateDataSet.
+func DataSetFingerprint(dataSet *types.DataSet) (string, error) {
+	cloned := *dataSet
+	cloned.CreatedTime = nil
+	cloned.LastUpdatedTime = nil
+	cloned.ConsumedSpiceCapacityInBytes = 0
+	cloned.OutputColumns = nil
+	bs, err := MarshalDataSetJSON(&cloned)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal data set: %w", err)
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checkConcurrentUpdate re-describes the data set right before update,
+// and returns ErrConcurrentUpdate if the data set has been changed since it was described.
+func (app *App) checkConcurrentUpdate(ctx context.Context, described *types.DataSet, fingerprint string) (*quicksight.DescribeDataSetOutput, error) {
+	arnObj, err := arn.Parse(coalesce(described.Arn))
+	if err != nil {
+		return nil, err
+	}
+	latest, err := app.describeDataSet(ctx, &arnObj.AccountID, coalesce(described.DataSetId))
+	if err != nil {
+		return nil, err
+	}
+	if described.LastUpdatedTime != nil && latest.DataSet.LastUpdatedTime != nil &&
+		!described.LastUpdatedTime.Equal(*latest.DataSet.LastUpdatedTime) {
+		return nil, fmt.Errorf("%w: last updated time changed from %s to %s", ErrConcurrentUpdate, described.LastUpdatedTime, latest.DataSet.LastUpdatedTime)
+	}
+	latestFingerprint, err := DataSetFingerprint(latest.DataSet)
+	if err != nil {
+		return nil, err
+	}
+	if latestFingerprint != fingerprint {
+		return nil, fmt.Errorf("%w: data set definition changed", ErrConcurrentUpdate)
+	}
+	log.Printf("[debug] data set %s is not changed since described, fingerprint=%s", coalesce(described.DataSetId), fingerprint)
+	return latest, nil
+}
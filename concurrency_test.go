@@ -0,0 +1,68 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestAnnotateConcurrentUpdate(t *testing.T) {
+	for _, onConflict := range []string{"abort", "replan"} {
+		t.Run(onConflict, func(t *testing.T) {
+			client := quicksighttest.NewClient()
+			client.PutDataSource(testDataSource("warehouse"))
+			client.PutDataSet(testDataSet("users"))
+			// the data set is renamed in the console right after annotate describes it to plan
+			client.UpdateAfterDescribe(testAWSAccountID, "users", 1, func(dataSet *types.DataSet) {
+				dataSet.Name = aws.String("renamed in the console")
+			})
+			app := newTestApp(t, client, io.Discard)
+			annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+			export := &DataSetExport{
+				DataSetID: "users",
+				Fields: []*FieldExport{
+					{Name: "pref_code", Source: "public.users.pref_code", Description: "Prefecture code"},
+				},
+			}
+			if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := app.RunAnnotate(context.Background(), &AnnotateOption{
+				DataSetID:       "users",
+				AnnotationsFile: annotationsFile,
+				OnConflict:      onConflict,
+				MaxReplan:       3,
+				BackupOption:    BackupOption{NoBackup: true},
+				IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+			})
+			updated, _ := client.DataSet(testAWSAccountID, "users")
+			switch onConflict {
+			case "abort":
+				if !errors.Is(err, ErrConcurrentUpdate) {
+					t.Errorf("error = %v, want ErrConcurrentUpdate", err)
+				}
+				if n := len(client.Updates()); n != 0 {
+					t.Errorf("UpdateDataSet called %d times, want 0", n)
+				}
+			case "replan":
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := len(client.Updates()); n != 1 {
+					t.Errorf("UpdateDataSet called %d times, want 1", n)
+				}
+				// the plan is made again from the latest definition, so the change in the console is kept
+				if got := aws.ToString(updated.Name); got != "renamed in the console" {
+					t.Errorf("name = %s, want the change in the console", got)
+				}
+			}
+		})
+	}
+}
@@ -1,14 +1,24 @@
 package redshiftdatasetannotator
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/Songmu/prompter"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
 )
 
 type Config map[string]*ProfileConfig
@@ -17,8 +27,43 @@ type ProfileConfig struct {
 	ClusterIdentifier *string `json:"cluster_identifier,omitempty"`
 	WorkgroupName     *string `json:"workgroup_name,omitempty"`
 	DBUser            *string `json:"db_user,omitempty"`
+
+	// SecretArn is the ARN of the Secrets Manager secret of the database user and password.
+	// If not configured, the secret of the data source is used when db_user is not configured either.
+	SecretArn *string `json:"secret_arn,omitempty"`
+
+	// AWS settings to access Redshift: the Data API, the credential APIs, Secrets Manager and the endpoint resolution.
+	// AWSProfile is the named profile of the AWS shared config, and RoleArn is the IAM role assumed.
+	AWSProfile *string `json:"aws_profile,omitempty"`
+	AWSRegion  *string `json:"aws_region,omitempty"`
+	RoleArn    *string `json:"role_arn,omitempty"`
+
+	// AWS settings of QuickSight, used in the default profile (or the profile selected by --profile).
+	QuickSightAWSAccountID *string `json:"quicksight_aws_account_id,omitempty"`
+	QuickSightAWSProfile   *string `json:"quicksight_aws_profile,omitempty"`
+	QuickSightAWSRegion    *string `json:"quicksight_aws_region,omitempty"`
+	QuickSightRoleArn      *string `json:"quicksight_role_arn,omitempty"`
+
+	// Connection is the way to connect to Redshift, `data-api` (default) or `postgres`.
+	// The following fields are used with `postgres`. The password is not stored in the profile,
+	// it is read from RSDSA_PASSWORD, or given by secret_arn or iam_auth.
+	Connection *string `json:"connection,omitempty"`
+	Host       *string `json:"host,omitempty"`
+	Port       *int32  `json:"port,omitempty"`
+	Database   *string `json:"database,omitempty"` // also used with `data-api`
+	User       *string `json:"user,omitempty"`
+	IAMAuth    bool    `json:"iam_auth,omitempty"`
+	SSLMode    *string `json:"sslmode,omitempty"`
+
+	// HiddenColumns is a list of glob patterns of column names that are removed from the data set fields.
+	HiddenColumns []string `json:"hidden_columns,omitempty"`
+
+	// ColumnLevelPermissions maps a restricted classification (`@restricted` hint) to the principal ARNs allowed to access the columns.
+	ColumnLevelPermissions map[string][]string `json:"column_level_permissions,omitempty"`
 }
 
+// String returns the configuration as JSON, e.g. for `configure --show`.
+// The profiles hold no secrets, the password is read from RSDSA_PASSWORD and never stored in the configuration.
 func (cfg Config) String() string {
 	b, _ := json.MarshalIndent(cfg, "", "  ")
 	return string(b)
@@ -33,10 +78,190 @@ func (cfg Config) Get(host string) (*ProfileConfig, bool) {
 	return profile, ok
 }
 
+// Profile names other than hosts.
+const (
+	profileNameDataSource = "datasource:"
+	profileNameCluster    = "cluster:"
+	profileNameWorkgroup  = "workgroup:"
+	profileNameRegexp     = "regexp:"
+)
+
+// Lookup returns the profile of the host, or the default profile if not configured.
+// The fields are overridden by RSDSA_* environment variables.
+func (cfg Config) Lookup(host string) *ProfileConfig {
+	return cfg.lookupTarget(&redshiftTarget{Host: host})
+}
+
+func (cfg Config) lookupTarget(target *redshiftTarget) *ProfileConfig {
+	_, profile := cfg.lookup(target)
+	merged, err := profile.withEnv()
+	if err != nil {
+		log.Printf("[warn] %s", err)
+		return profile
+	}
+	return merged
+}
+
+// lookup returns the first matched profile of the data source (ARN or `datasource:<id>`), the host,
+// the cluster (`cluster:<identifier>`) or workgroup (`workgroup:<name>`),
+// the host patterns (glob or `regexp:<pattern>`, in the order of the names) and the default profile.
+// The name is empty if no profile is matched.
+func (cfg Config) lookup(target *redshiftTarget) (string, *ProfileConfig) {
+	var names []string
+	if target.DataSourceArn != "" {
+		names = append(names, target.DataSourceArn)
+	}
+	if target.DataSourceID != "" {
+		names = append(names, profileNameDataSource+target.DataSourceID)
+	}
+	if target.Host != "" {
+		names = append(names, target.Host)
+	}
+	if target.ClusterIdentifier != "" {
+		names = append(names, profileNameCluster+target.ClusterIdentifier)
+	}
+	if target.WorkgroupName != "" {
+		names = append(names, profileNameWorkgroup+target.WorkgroupName)
+	}
+	for _, name := range names {
+		if profile, ok := cfg.Get(name); ok && profile != nil {
+			return name, profile
+		}
+	}
+	if target.Host != "" {
+		patterns := lo.Keys(cfg)
+		sort.Strings(patterns)
+		for _, name := range patterns {
+			if ok, _ := matchProfilePattern(name, target.Host); ok && cfg[name] != nil {
+				log.Printf("[debug] profile `%s` matches %s", name, target.Host)
+				return name, cfg[name]
+			}
+		}
+	}
+	if profile := cfg.GetDefault(); profile != nil {
+		return defaultProfileName, profile
+	}
+	return "", &ProfileConfig{}
+}
+
+// matchProfilePattern reports whether the profile name is a pattern (glob or `regexp:<pattern>`) matching the host.
+func matchProfilePattern(name string, host string) (bool, error) {
+	if pattern, ok := strings.CutPrefix(name, profileNameRegexp); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("profile `%s`: %w", name, err)
+		}
+		return re.MatchString(host), nil
+	}
+	if name == defaultProfileName || !strings.ContainsAny(name, "*?[") {
+		return false, nil
+	}
+	ok, err := path.Match(strings.ToLower(name), strings.ToLower(host))
+	if err != nil {
+		return false, fmt.Errorf("profile `%s`: %w", name, err)
+	}
+	return ok, nil
+}
+
+// validate checks the patterns of the profile names.
+func (cfg Config) validate() error {
+	for name := range cfg {
+		if _, err := matchProfilePattern(name, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withDefault returns the configuration with the profile layered over the default profile.
+func (cfg Config) withDefault(profile *ProfileConfig) Config {
+	defaultProfile := cfg.GetDefault()
+	if defaultProfile == nil {
+		defaultProfile = &ProfileConfig{}
+	}
+	return cfg.merge(Config{defaultProfileName: defaultProfile.overlay(profile)})
+}
+
+// overlay returns a copy of the profile with the non-zero fields of override.
+func (cfg *ProfileConfig) overlay(override *ProfileConfig) *ProfileConfig {
+	merged := *cfg
+	dst := reflect.ValueOf(&merged).Elem()
+	src := reflect.ValueOf(override).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		if !src.Field(i).IsZero() {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	return &merged
+}
+
+const envPrefix = "RSDSA_"
+
+// envPassword is the password of the database user with `connection: postgres`.
+const envPassword = envPrefix + "PASSWORD"
+
+// envProfile returns the profile fields set by environment variables.
+func envProfile() (*ProfileConfig, error) {
+	return (&ProfileConfig{}).withEnv()
+}
+
+// withEnv returns a copy of the profile with the fields set by environment variables.
+// The name of the variable is RSDSA_ and the upper-cased json key, e.g. RSDSA_DB_USER.
+// Unlike overlay, the zero values are also set, e.g. RSDSA_IAM_AUTH=false disables iam_auth of the profile.
+func (cfg *ProfileConfig) withEnv() (*ProfileConfig, error) {
+	profile := *cfg
+	v := reflect.ValueOf(&profile).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		key := envPrefix + strings.ToUpper(name)
+		value, ok := os.LookupEnv(key)
+		if !ok || value == "" {
+			continue
+		}
+		if err := setEnvValue(v.Field(i), value); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", key, err)
+		}
+	}
+	return &profile, nil
+}
+
+// setEnvValue sets the field from the environment variable value.
+// Strings are set as is, lists are comma separated (or JSON), and others are parsed as JSON.
+func setEnvValue(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case *string:
+		field.Set(reflect.ValueOf(aws.String(value)))
+		return nil
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+		return nil
+	case []string:
+		if !strings.HasPrefix(strings.TrimSpace(value), "[") {
+			values := strings.Split(value, ",")
+			for i := range values {
+				values[i] = strings.TrimSpace(values[i])
+			}
+			field.Set(reflect.ValueOf(values))
+			return nil
+		}
+	}
+	// decode into a new value, not to write through the pointers and maps shared with the configuration
+	v := reflect.New(field.Type())
+	if err := json.Unmarshal([]byte(value), v.Interface()); err != nil {
+		return err
+	}
+	field.Set(v.Elem())
+	return nil
+}
+
 const defaultProfileName = "[default]"
 
-func (cfg Config) reConfigure(host string) error {
-	profileName := host
+func (cfg Config) reConfigure(opt *ConfigureOption) error {
+	profileName := opt.Host
 	if profileName == "" {
 		profileName = defaultProfileName
 	}
@@ -44,11 +269,58 @@ func (cfg Config) reConfigure(host string) error {
 	if !ok {
 		profile = &ProfileConfig{}
 	}
-	profile.reConfigure(host)
+	if err := profile.setFlags(opt); err != nil {
+		return err
+	}
+	if opt.NonInteractive {
+		profile.setDefaults(opt.Host)
+	} else {
+		profile.reConfigure(opt.Host)
+	}
 	cfg[profileName] = profile
 	return saveConfig(cfg)
 }
 
+// setFlags sets the fields specified by the flags of configure.
+// In interactive mode, they are the default values of the prompts.
+func (cfg *ProfileConfig) setFlags(opt *ConfigureOption) error {
+	if opt.ClusterIdentifier != "" && opt.WorkgroupName != "" {
+		return errors.New("--cluster-identifier and --workgroup-name can not be used together, a profile is either a provisioned cluster or a serverless workgroup")
+	}
+	if opt.ClusterIdentifier != "" {
+		cfg.ClusterIdentifier = aws.String(opt.ClusterIdentifier)
+		cfg.WorkgroupName = nil
+	}
+	if opt.WorkgroupName != "" {
+		cfg.WorkgroupName = aws.String(opt.WorkgroupName)
+		cfg.ClusterIdentifier = nil
+		cfg.DBUser = nil
+	}
+	if opt.DBUser != "" {
+		cfg.DBUser = aws.String(opt.DBUser)
+	}
+	if opt.Database != "" {
+		cfg.Database = aws.String(opt.Database)
+	}
+	if opt.SecretArn != "" {
+		cfg.SecretArn = aws.String(opt.SecretArn)
+	}
+	if opt.RoleArn != "" {
+		cfg.RoleArn = aws.String(opt.RoleArn)
+	}
+	return nil
+}
+
+// setDefaults fills the cluster identifier or workgroup name from the host without prompts.
+func (cfg *ProfileConfig) setDefaults(host string) {
+	if isServeless(host) && cfg.WorkgroupName == nil {
+		cfg.WorkgroupName = aws.String(getWorkgroupName(host))
+	}
+	if isProvisoned(host) && cfg.ClusterIdentifier == nil {
+		cfg.ClusterIdentifier = aws.String(getCluseterID(host))
+	}
+}
+
 func (cfg *ProfileConfig) reConfigure(host string) {
 	isP := isProvisoned(host)
 	isS := isServeless(host)
@@ -131,14 +403,131 @@ func loadConfigFile() (Config, error) {
 	if err := json.Unmarshal([]byte(jsonStr), &cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal %s: %w", p, err)
 	}
+	for _, name := range passwordProfiles(jsonStr) {
+		log.Printf("[warn] %s: the password of the profile `%s` is ignored, set %s, secret_arn or iam_auth instead (the password is removed by `redshift-data-set-annotator configure`)", p, name, envPassword)
+	}
 	return cfg, nil
 }
 
+// passwordProfiles returns the names of the profiles with the `password` key, that was stored by older versions.
+func passwordProfiles(jsonStr []byte) []string {
+	var profiles map[string]*struct {
+		Password *string `json:"password"`
+	}
+	if err := json.Unmarshal(jsonStr, &profiles); err != nil {
+		return nil
+	}
+	var names []string
+	for name, profile := range profiles {
+		if profile != nil && profile.Password != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+const projectConfigFileName = ".redshift-data-set-annotator.yaml"
+
+// projectConfig is the project configuration file, committed alongside SQL or dbt projects.
+// It has the profiles layered over the user configuration file, and the settings of the commands (see projectSettings).
+//
+//	profiles:
+//	  "[default]":
+//	    workgroup_name: analytics
+//	    hidden_columns: ["_*"]
+type projectConfig struct {
+	Profiles Config `json:"profiles,omitempty"`
+	projectSettings
+}
+
+// loadConfig loads the user configuration file and layers the project configuration file over it.
+// It returns the merged configuration, the settings of the project configuration file and the loaded files.
+func loadConfig(path string) (Config, projectSettings, []string, error) {
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return nil, projectSettings{}, nil, err
+	}
+	files := []string{configFilePath()}
+	if path == "" {
+		if _, err := os.Stat(projectConfigFileName); err != nil {
+			return cfg, projectSettings{}, files, cfg.validate()
+		}
+		path = projectConfigFileName
+	}
+	project, err := loadProjectConfigFile(path)
+	if err != nil {
+		return nil, projectSettings{}, nil, err
+	}
+	log.Printf("[debug] load project config file: %s", path)
+	cfg = cfg.merge(project.Profiles)
+	if err := cfg.validate(); err != nil {
+		return nil, projectSettings{}, nil, err
+	}
+	return cfg, project.projectSettings, append(files, path), nil
+}
+
+func loadProjectConfigFile(path string) (*projectConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	// decode YAML through JSON to share the json tags of ProfileConfig
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	jsonStr, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(jsonStr, &sections); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	if names := passwordProfiles(sections["profiles"]); len(names) > 0 {
+		return nil, fmt.Errorf("%s: profile `%s` has a password, that is not read from the configuration file, set %s, secret_arn or iam_auth instead", path, names[0], envPassword)
+	}
+	var project projectConfig
+	dec := json.NewDecoder(bytes.NewReader(jsonStr))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&project); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	if err := project.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	// the annotations file is relative to the project configuration file, not to the working directory
+	if sources := project.AnnotationSources; sources != nil && sources.AnnotationsFile != "" && !filepath.IsAbs(sources.AnnotationsFile) {
+		sources.AnnotationsFile = filepath.Join(filepath.Dir(path), sources.AnnotationsFile)
+	}
+	return &project, nil
+}
+
+// merge returns the configuration with the profiles of other layered over cfg field by field.
+func (cfg Config) merge(other Config) Config {
+	merged := make(Config, len(cfg)+len(other))
+	for name, profile := range cfg {
+		merged[name] = profile
+	}
+	for name, profile := range other {
+		if profile == nil {
+			continue
+		}
+		if base, ok := merged[name]; ok && base != nil {
+			merged[name] = base.overlay(profile)
+		} else {
+			merged[name] = profile
+		}
+	}
+	return merged
+}
+
 func saveConfig(cfg Config) error {
 	p := configFilePath()
 	if _, err := os.Stat(configDir); err != nil {
 		if os.IsNotExist(err) {
-			if err := os.MkdirAll(configDir, 0755); err != nil {
+			if err := os.MkdirAll(configDir, 0700); err != nil {
 				return fmt.Errorf("failed to create config directory: %w", err)
 			}
 		} else {
@@ -149,12 +538,16 @@ func saveConfig(cfg Config) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
+	// the backup may have the password stored by older versions
 	if _, err := os.Stat(p); err == nil {
 		if err := os.Rename(p, p+".bak"); err != nil {
 			return fmt.Errorf("failed to backup config: %w", err)
 		}
+		if err := os.Chmod(p+".bak", 0600); err != nil {
+			return fmt.Errorf("failed to backup config: %w", err)
+		}
 	}
-	if err := os.WriteFile(p, b, 0644); err != nil {
+	if err := os.WriteFile(p, b, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 	log.Println("[info] Saved configuration file:", configFilePath())
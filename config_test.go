@@ -0,0 +1,437 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+	"github.com/samber/lo"
+)
+
+func TestConfigLookupEnvOverride(t *testing.T) {
+	host := "example.123456789012.ap-northeast-1.redshift.amazonaws.com"
+	cfg := Config{
+		host: &ProfileConfig{
+			ClusterIdentifier: aws.String("example"),
+			DBUser:            aws.String("admin"),
+		},
+	}
+	t.Setenv("RSDSA_DB_USER", "ci")
+	t.Setenv("RSDSA_PORT", "15439")
+	t.Setenv("RSDSA_IAM_AUTH", "true")
+	t.Setenv("RSDSA_HIDDEN_COLUMNS", "_*, *_id")
+	profile := cfg.Lookup(host)
+	if got := coalesce(profile.ClusterIdentifier); got != "example" {
+		t.Errorf("cluster_identifier = %q, want example", got)
+	}
+	if got := coalesce(profile.DBUser); got != "ci" {
+		t.Errorf("db_user = %q, want ci", got)
+	}
+	if got := coalesce(profile.Port); got != 15439 {
+		t.Errorf("port = %d, want 15439", got)
+	}
+	if !profile.IAMAuth {
+		t.Error("iam_auth = false, want true")
+	}
+	if want := []string{"_*", "*_id"}; !reflect.DeepEqual(profile.HiddenColumns, want) {
+		t.Errorf("hidden_columns = %v, want %v", profile.HiddenColumns, want)
+	}
+	if got := coalesce(cfg[host].DBUser); got != "admin" {
+		t.Errorf("config is modified: db_user = %q, want admin", got)
+	}
+
+	t.Setenv("RSDSA_PORT", "not a number")
+	if _, err := envProfile(); err == nil {
+		t.Error("envProfile() with invalid RSDSA_PORT succeeded, want error")
+	}
+}
+
+func TestConfigLookupEnvOverrideZero(t *testing.T) {
+	cfg := Config{
+		"localhost": &ProfileConfig{
+			IAMAuth:                true,
+			Port:                   aws.Int32(5439),
+			ColumnLevelPermissions: map[string][]string{"pii": {"arn:aws:quicksight:ap-northeast-1:123456789012:group/default/pii"}},
+		},
+	}
+	t.Setenv("RSDSA_IAM_AUTH", "false")
+	t.Setenv("RSDSA_PORT", "15439")
+	t.Setenv("RSDSA_COLUMN_LEVEL_PERMISSIONS", `{"finance": ["arn:aws:quicksight:ap-northeast-1:123456789012:group/default/finance"]}`)
+	profile := cfg.Lookup("localhost")
+	if profile.IAMAuth {
+		t.Error("iam_auth = true, want false by RSDSA_IAM_AUTH=false")
+	}
+	if got := coalesce(profile.Port); got != 15439 {
+		t.Errorf("port = %d, want 15439", got)
+	}
+	if _, ok := profile.ColumnLevelPermissions["pii"]; ok {
+		t.Errorf("column_level_permissions = %v, want replaced by RSDSA_COLUMN_LEVEL_PERMISSIONS", profile.ColumnLevelPermissions)
+	}
+	// the configuration is not modified through the shared pointers and maps
+	if original := cfg["localhost"]; !original.IAMAuth || coalesce(original.Port) != 5439 || len(original.ColumnLevelPermissions) != 1 {
+		t.Errorf("config is modified: %+v", original)
+	}
+}
+
+func TestProfileConfigSetFlags(t *testing.T) {
+	profile := &ProfileConfig{ClusterIdentifier: aws.String("warehouse"), DBUser: aws.String("admin")}
+	err := profile.setFlags(&ConfigureOption{ClusterIdentifier: "warehouse", WorkgroupName: "analytics"})
+	if err == nil || !strings.Contains(err.Error(), "can not be used together") {
+		t.Errorf("error = %v, want the flags conflict", err)
+	}
+	if err := profile.setFlags(&ConfigureOption{WorkgroupName: "analytics"}); err != nil {
+		t.Fatal(err)
+	}
+	if coalesce(profile.WorkgroupName) != "analytics" || profile.ClusterIdentifier != nil || profile.DBUser != nil {
+		t.Errorf("profile = %+v, want the workgroup analytics without the cluster", profile)
+	}
+}
+
+func TestLoadProjectConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), projectConfigFileName)
+	content := `profiles:
+  "[default]":
+    database: analytics
+    hidden_columns: ["_*"]
+  localhost:
+    connection: postgres
+    port: 15439
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := loadProjectConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{
+		defaultProfileName: &ProfileConfig{
+			WorkgroupName: aws.String("default"),
+			Database:      aws.String("dev"),
+		},
+	}.merge(project.Profiles)
+	defaultProfile := cfg.GetDefault()
+	if got := coalesce(defaultProfile.WorkgroupName); got != "default" {
+		t.Errorf("workgroup_name = %q, want default", got)
+	}
+	if got := coalesce(defaultProfile.Database); got != "analytics" {
+		t.Errorf("database = %q, want analytics", got)
+	}
+	if want := []string{"_*"}; !reflect.DeepEqual(defaultProfile.HiddenColumns, want) {
+		t.Errorf("hidden_columns = %v, want %v", defaultProfile.HiddenColumns, want)
+	}
+	if got := coalesce(cfg["localhost"].Port); got != 15439 {
+		t.Errorf("port = %d, want 15439", got)
+	}
+
+	if err := os.WriteFile(path, []byte("profiles:\n  localhost:\n    hiden_columns: [\"_*\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProjectConfigFile(path); err == nil {
+		t.Error("loadProjectConfigFile with unknown key succeeded, want error")
+	}
+
+	if err := os.WriteFile(path, []byte("profiles: {}\nannotate:\n  infer_geographic_role: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProjectConfigFile(path); err == nil || !strings.Contains(err.Error(), `unknown field "annotate"`) {
+		t.Errorf("loadProjectConfigFile with annotate section = %v, want unknown field error", err)
+	}
+}
+
+func TestLoadProjectConfigFileSettings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, projectConfigFileName)
+	content := `annotation_sources:
+  annotations_file: annotations/users.yaml
+  infer_geographic_role: true
+  geographic_role_patterns:
+    "*_pref": STATE
+comment_format:
+  name_line: false
+  hint_prefix: "#"
+ignore:
+  data_sets: ["tmp_*"]
+  columns: ["public.users.dw_*"]
+data_sets:
+  data_source_id: warehouse
+  schema: public
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project, err := loadProjectConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := project.projectSettings
+	if got, want := settings.AnnotationSources.AnnotationsFile, filepath.Join(dir, "annotations", "users.yaml"); got != want {
+		t.Errorf("annotations_file = %s, want %s relative to the project configuration file", got, want)
+	}
+	if format := settings.format(); aws.ToBool(format.NameLine) || format.HintPrefix != "#" {
+		t.Errorf("comment format = name_line:%v hint_prefix:%s, want false and #", aws.ToBool(format.NameLine), format.HintPrefix)
+	}
+	if !settings.ignoreDataSet("tmp_users") || settings.ignoreDataSet("users") {
+		t.Error("ignore data sets, want tmp_users ignored and users not")
+	}
+	if !settings.ignoreColumn("public", "users", "dw_hash") || settings.ignoreColumn("sales", "users", "dw_hash") {
+		t.Error("ignore columns, want public.users.dw_hash ignored and sales.users.dw_hash not")
+	}
+	if got := settings.DataSets.DataSourceID; got != "warehouse" {
+		t.Errorf("data_sets.data_source_id = %s, want warehouse", got)
+	}
+
+	invalid := map[string]string{
+		"data_sets:\n  schema: public\n":                                          "data_source_id is required",
+		"annotation_sources:\n  geographic_role_patterns:\n    \"*_x\": PLANET\n": "unknown geographic role",
+		"ignore:\n  columns: [\"[\"]\n":                                           "ignore pattern `[`",
+	}
+	for content, want := range invalid {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadProjectConfigFile(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadProjectConfigFile(%q) = %v, want %q", content, err, want)
+		}
+	}
+}
+
+func TestProjectSettingsAnnotateOption(t *testing.T) {
+	settings := projectSettings{
+		AnnotationSources: &annotationSources{
+			AnnotationsFile:        "project.yaml",
+			InferGeographicRole:    true,
+			GeographicRolePatterns: map[string]string{"*_pref": "STATE", "*_city": "CITY"},
+		},
+		DataSets: &dataSetSelector{DataSourceID: "warehouse", Schema: "public"},
+	}
+	opt := &AnnotateOption{GeographicRolePattern: map[string]string{"*_pref": "COUNTY"}, Table: "users"}
+	merged := settings.annotateOption(opt)
+	if merged.AnnotationsFile != "project.yaml" || !merged.InferGeographicRole {
+		t.Errorf("annotations file and infer geographic role = %s, %v, want project.yaml, true", merged.AnnotationsFile, merged.InferGeographicRole)
+	}
+	if want := map[string]string{"*_pref": "COUNTY", "*_city": "CITY"}; !reflect.DeepEqual(merged.GeographicRolePattern, want) {
+		t.Errorf("geographic role patterns = %v, want %v", merged.GeographicRolePattern, want)
+	}
+	if merged.DataSourceID != "warehouse" || merged.Schema != "public" || merged.Table != "users" {
+		t.Errorf("data source, schema and table = %s, %s, %s, want warehouse, public, users", merged.DataSourceID, merged.Schema, merged.Table)
+	}
+	if opt.AnnotationsFile != "" || opt.DataSourceID != "" || len(opt.GeographicRolePattern) != 1 {
+		t.Errorf("the option of the flags is modified: %+v", opt)
+	}
+
+	// the flags take precedence
+	merged = settings.annotateOption(&AnnotateOption{DataSetID: "users", AnnotationsFile: "flag.yaml"})
+	if merged.AnnotationsFile != "flag.yaml" || merged.DataSourceID != "" {
+		t.Errorf("annotations file and data source = %s, %s, want flag.yaml and no data source", merged.AnnotationsFile, merged.DataSourceID)
+	}
+}
+
+func TestConfigureShowProjectSettings(t *testing.T) {
+	var buf bytes.Buffer
+	app := newTestApp(t, quicksighttest.NewClient(), &buf)
+	if err := app.RunConfigure(context.Background(), &ConfigureOption{Show: true}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "profiles") {
+		t.Errorf("configure --show without settings = %s, want only the profiles", buf.String())
+	}
+	buf.Reset()
+	app.settings = projectSettings{Ignore: &ignoreList{DataSets: []string{"tmp_*"}}}
+	if err := app.RunConfigure(context.Background(), &ConfigureOption{Show: true}); err != nil {
+		t.Fatal(err)
+	}
+	var shown map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &shown); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shown["profiles"]; !ok {
+		t.Errorf("configure --show = %s, want profiles", buf.String())
+	}
+	if _, ok := shown["ignore"]; !ok {
+		t.Errorf("configure --show = %s, want ignore", buf.String())
+	}
+}
+
+func TestConfigPassword(t *testing.T) {
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = t.TempDir()
+	// the password stored by older versions is ignored and removed by saveConfig
+	legacy := `{"localhost": {"connection": "postgres", "user": "admin", "password": "s3cr3t"}}`
+	if err := os.WriteFile(configFilePath(), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(cfg.String(), "s3cr3t") {
+		t.Errorf("String() = %s, want without the password", cfg)
+	}
+	if err := saveConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{configFilePath(), configFilePath() + ".bak"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Errorf("permission of %s = %o, want 600", filepath.Base(p), perm)
+		}
+	}
+	b, err := os.ReadFile(configFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "s3cr3t") {
+		t.Errorf("saved config = %s, want without the password", b)
+	}
+
+	path := filepath.Join(t.TempDir(), projectConfigFileName)
+	if err := os.WriteFile(path, []byte("profiles:\n  localhost:\n    password: s3cr3t\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProjectConfigFile(path); err == nil || !strings.Contains(err.Error(), "set RSDSA_PASSWORD") {
+		t.Errorf("loadProjectConfigFile with password = %v, want RSDSA_PASSWORD error", err)
+	}
+}
+
+func TestConfigLookupTarget(t *testing.T) {
+	cfg := Config{
+		defaultProfileName:                 &ProfileConfig{DBUser: aws.String("default")},
+		"datasource:sales":                 &ProfileConfig{DBUser: aws.String("datasource")},
+		"cluster:warehouse":                &ProfileConfig{DBUser: aws.String("cluster")},
+		"workgroup:analytics":              &ProfileConfig{DBUser: aws.String("workgroup")},
+		"*.redshift.amazonaws.com.cn":      &ProfileConfig{DBUser: aws.String("glob")},
+		`regexp:^vpce-[0-9a-z]+\.example$`: &ProfileConfig{DBUser: aws.String("regexp")},
+		"redshift.example.com":             &ProfileConfig{DBUser: aws.String("host")},
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		target *redshiftTarget
+		want   string
+	}{
+		{&redshiftTarget{Host: "redshift.example.com", DataSourceID: "sales", ClusterIdentifier: "warehouse"}, "datasource"},
+		{&redshiftTarget{Host: "redshift.example.com", ClusterIdentifier: "warehouse"}, "host"},
+		{&redshiftTarget{Host: "custom.example.com", ClusterIdentifier: "warehouse"}, "cluster"},
+		{&redshiftTarget{Host: "custom.example.com", WorkgroupName: "analytics"}, "workgroup"},
+		{&redshiftTarget{Host: "warehouse.abc123.cn-north-1.redshift.amazonaws.com.cn"}, "glob"},
+		{&redshiftTarget{Host: "vpce-0123abcd.example"}, "regexp"},
+		{&redshiftTarget{Host: "unknown.example.com"}, "default"},
+	}
+	for _, c := range cases {
+		if got := coalesce(cfg.lookupTarget(c.target).DBUser); got != c.want {
+			t.Errorf("lookup %s = %q, want %q", c.target, got, c.want)
+		}
+	}
+	if err := (Config{"regexp:[": &ProfileConfig{}}).validate(); err == nil {
+		t.Error("validate invalid regexp succeeded, want error")
+	}
+}
+
+func TestParseRedshiftHost(t *testing.T) {
+	cases := []struct {
+		host      string
+		cluster   string
+		workgroup string
+	}{
+		{"warehouse.abc123.ap-northeast-1.redshift.amazonaws.com", "warehouse", ""},
+		{"warehouse.abc123.cn-north-1.redshift.amazonaws.com.cn", "warehouse", ""},
+		{"default.123456789012.ap-northeast-1.redshift-serverless.amazonaws.com", "", "default"},
+		{"default.123456789012.cn-north-1.redshift-serverless.amazonaws.com.cn", "", "default"},
+		{"redshift.example.com", "", ""},
+	}
+	for _, c := range cases {
+		if got := getCluseterID(c.host); got != c.cluster {
+			t.Errorf("getCluseterID(%q) = %q, want %q", c.host, got, c.cluster)
+		}
+		if got := getWorkgroupName(c.host); got != c.workgroup {
+			t.Errorf("getWorkgroupName(%q) = %q, want %q", c.host, got, c.workgroup)
+		}
+	}
+}
+
+func TestNewWithProfile(t *testing.T) {
+	cfg := Config{
+		defaultProfileName: &ProfileConfig{
+			WorkgroupName:          aws.String("default"),
+			QuickSightAWSAccountID: aws.String("111111111111"),
+		},
+		"tokyo": &ProfileConfig{
+			QuickSightAWSAccountID: aws.String("222222222222"),
+			AWSRegion:              aws.String("ap-northeast-1"),
+		},
+	}
+	app, err := New(context.Background(), "", WithConfig(cfg), WithProfile("tokyo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := app.AWSAccountID(); got != "222222222222" {
+		t.Errorf("AWSAccountID() = %q, want 222222222222", got)
+	}
+	profile := app.cfg.Lookup("unknown.example.com")
+	if got := coalesce(profile.WorkgroupName); got != "default" {
+		t.Errorf("workgroup_name = %q, want default", got)
+	}
+	if got := coalesce(profile.AWSRegion); got != "ap-northeast-1" {
+		t.Errorf("aws_region = %q, want ap-northeast-1", got)
+	}
+
+	if _, err := New(context.Background(), "", WithConfig(cfg), WithProfile("osaka")); err == nil {
+		t.Error("New with unknown profile succeeded, want error")
+	}
+}
+
+func TestConfigNeedsRedshiftTarget(t *testing.T) {
+	target := &redshiftTarget{Host: "custom.example.com", DataSourceID: "sales"}
+	cases := []struct {
+		cfg  Config
+		want bool
+	}{
+		{Config{defaultProfileName: &ProfileConfig{}}, false},
+		{Config{"cluster:warehouse": &ProfileConfig{}}, true},
+		{Config{"workgroup:analytics": &ProfileConfig{}}, true},
+		{Config{"cluster:warehouse": &ProfileConfig{}, "custom.example.com": &ProfileConfig{}}, false},
+		{Config{"workgroup:analytics": &ProfileConfig{}, "datasource:sales": &ProfileConfig{}}, false},
+	}
+	for _, c := range cases {
+		if got := c.cfg.needsRedshiftTarget(target); got != c.want {
+			t.Errorf("needsRedshiftTarget() with %v = %v, want %v", lo.Keys(c.cfg), got, c.want)
+		}
+	}
+}
+
+func TestResolveRedshiftTargetSkipsLookup(t *testing.T) {
+	ds := testDataSource("sales")
+	ds.DataSourceParameters.(*types.DataSourceParametersMemberRedshiftParameters).Value.Host = aws.String("redshift.example.com")
+	// the AWS profile can not be loaded, so the lookup of the endpoint fails if attempted
+	profile := &ProfileConfig{AWSProfile: aws.String("rsdsa-test-not-exists")}
+
+	app := newTestApp(t, quicksighttest.NewClient(), io.Discard)
+	app.cfg = Config{defaultProfileName: profile}
+	target, err := app.resolveRedshiftTarget(context.Background(), ds)
+	if err != nil {
+		t.Fatalf("resolve without cluster profiles: %s", err)
+	}
+	if target.ClusterIdentifier != "" || target.WorkgroupName != "" {
+		t.Errorf("target = %+v, want not resolved", target)
+	}
+
+	app = newTestApp(t, quicksighttest.NewClient(), io.Discard)
+	app.cfg = Config{defaultProfileName: profile, "cluster:warehouse": &ProfileConfig{}}
+	if _, err := app.resolveRedshiftTarget(context.Background(), ds); err == nil {
+		t.Error("resolve with cluster profiles succeeded, want the lookup error")
+	}
+}
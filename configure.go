@@ -2,6 +2,7 @@ package redshiftdatasetannotator
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
 )
@@ -9,16 +10,41 @@ import (
 type ConfigureOption struct {
 	Host string `help:"redshift host address" default:""`
 	Show bool   `help:"show current configuration" short:"s"`
+
+	NonInteractive    bool   `help:"configure with the flags only, without prompts"`
+	ClusterIdentifier string `help:"redshift cluster identifier" default:""`
+	WorkgroupName     string `help:"redshift serverless workgroup name" default:""`
+	DBUser            string `help:"redshift db user" name:"db-user" default:""`
+	Database          string `help:"redshift database name, overrides the database of the data source" default:""`
+	SecretArn         string `help:"secrets manager secret arn of the database credentials" default:""`
+	RoleArn           string `help:"IAM role arn assumed to call the redshift data api" default:""`
 }
 
 func (app *App) RunConfigure(ctx context.Context, opt *ConfigureOption) error {
 	if opt.Show {
-		log.Println("configuration file:", configFilePath())
-		fmt.Fprintln(app.w, app.cfg.String())
+		for _, file := range app.cfgFiles {
+			log.Println("configuration file:", file)
+		}
+		fmt.Fprintln(app.w, app.showConfig())
 		return nil
 	}
-	if err := app.cfg.reConfigure(opt.Host); err != nil {
+	// the project configuration file is not written, only the user configuration file
+	cfg, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+	if err := cfg.reConfigure(opt); err != nil {
 		return err
 	}
 	return nil
 }
+
+// showConfig returns the merged profiles as JSON. If the project configuration file has the settings of the commands,
+// they are shown with the profiles, in the layout of the project configuration file.
+func (app *App) showConfig() string {
+	if app.settings.empty() {
+		return app.cfg.String()
+	}
+	b, _ := json.MarshalIndent(projectConfig{Profiles: app.cfg, projectSettings: app.settings}, "", "  ")
+	return string(b)
+}
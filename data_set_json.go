@@ -0,0 +1,239 @@
+package redshiftdatasetannotator
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+// The union types of QuickSight (PhysicalTable and TransformOperation) are serialized
+// without the member name by encoding/json, so that they can not be unmarshaled.
+// jsonDataSet shadows those fields and serializes unions as {"<MemberName>": <Value>} like the QuickSight API.
+// Members unknown to this version are serialized as {"unknown": "<Type>", "value": <Member>} so that
+// fingerprints and backups still work, but they can not be unmarshaled.
+type jsonDataSet struct {
+	*types.DataSet
+	PhysicalTableMap map[string]jsonPhysicalTable `json:",omitempty"`
+	LogicalTableMap  map[string]jsonLogicalTable  `json:",omitempty"`
+}
+
+type jsonLogicalTable struct {
+	*types.LogicalTable
+	DataTransforms []jsonTransformOperation `json:",omitempty"`
+}
+
+type jsonPhysicalTable struct {
+	types.PhysicalTable
+}
+
+type jsonTransformOperation struct {
+	types.TransformOperation
+}
+
+// MarshalDataSetJSON serializes the data set in a form that can be read by UnmarshalDataSetJSON.
+func MarshalDataSetJSON(dataSet *types.DataSet) ([]byte, error) {
+	return json.MarshalIndent(newJSONDataSet(dataSet), "", "  ")
+}
+
+// UnmarshalDataSetJSON deserializes the data set written by MarshalDataSetJSON.
+func UnmarshalDataSetJSON(data []byte) (*types.DataSet, error) {
+	var v jsonDataSet
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v.dataSet(), nil
+}
+
+func newJSONDataSet(dataSet *types.DataSet) *jsonDataSet {
+	if dataSet == nil {
+		return nil
+	}
+	v := &jsonDataSet{
+		DataSet: dataSet,
+	}
+	if dataSet.PhysicalTableMap != nil {
+		v.PhysicalTableMap = make(map[string]jsonPhysicalTable, len(dataSet.PhysicalTableMap))
+		for id, table := range dataSet.PhysicalTableMap {
+			v.PhysicalTableMap[id] = jsonPhysicalTable{PhysicalTable: table}
+		}
+	}
+	if dataSet.LogicalTableMap != nil {
+		v.LogicalTableMap = make(map[string]jsonLogicalTable, len(dataSet.LogicalTableMap))
+		for id, table := range dataSet.LogicalTableMap {
+			table := table
+			transforms := make([]jsonTransformOperation, 0, len(table.DataTransforms))
+			for _, op := range table.DataTransforms {
+				transforms = append(transforms, jsonTransformOperation{TransformOperation: op})
+			}
+			v.LogicalTableMap[id] = jsonLogicalTable{LogicalTable: &table, DataTransforms: transforms}
+		}
+	}
+	return v
+}
+
+func (v *jsonDataSet) dataSet() *types.DataSet {
+	dataSet := v.DataSet
+	if dataSet == nil {
+		dataSet = &types.DataSet{}
+	}
+	if v.PhysicalTableMap != nil {
+		dataSet.PhysicalTableMap = make(map[string]types.PhysicalTable, len(v.PhysicalTableMap))
+		for id, table := range v.PhysicalTableMap {
+			dataSet.PhysicalTableMap[id] = table.PhysicalTable
+		}
+	}
+	if v.LogicalTableMap != nil {
+		dataSet.LogicalTableMap = make(map[string]types.LogicalTable, len(v.LogicalTableMap))
+		for id, table := range v.LogicalTableMap {
+			logicalTable := types.LogicalTable{}
+			if table.LogicalTable != nil {
+				logicalTable = *table.LogicalTable
+			}
+			logicalTable.DataTransforms = nil
+			if table.DataTransforms != nil {
+				logicalTable.DataTransforms = make([]types.TransformOperation, 0, len(table.DataTransforms))
+				for _, op := range table.DataTransforms {
+					logicalTable.DataTransforms = append(logicalTable.DataTransforms, op.TransformOperation)
+				}
+			}
+			dataSet.LogicalTableMap[id] = logicalTable
+		}
+	}
+	return dataSet
+}
+
+func (v jsonPhysicalTable) MarshalJSON() ([]byte, error) {
+	switch t := v.PhysicalTable.(type) {
+	case *types.PhysicalTableMemberRelationalTable:
+		return json.Marshal(map[string]interface{}{"RelationalTable": t.Value})
+	case *types.PhysicalTableMemberCustomSql:
+		return json.Marshal(map[string]interface{}{"CustomSql": t.Value})
+	case *types.PhysicalTableMemberS3Source:
+		return json.Marshal(map[string]interface{}{"S3Source": t.Value})
+	case *types.PhysicalTableMemberSaaSTable:
+		return json.Marshal(map[string]interface{}{"SaaSTable": t.Value})
+	default:
+		return marshalUnknownUnion("physical table", t)
+	}
+}
+
+func (v *jsonPhysicalTable) UnmarshalJSON(data []byte) error {
+	member, raw, err := unmarshalUnion(data)
+	if err != nil {
+		return fmt.Errorf("physical table: %w", err)
+	}
+	switch member {
+	case "RelationalTable":
+		t := &types.PhysicalTableMemberRelationalTable{}
+		v.PhysicalTable, err = t, json.Unmarshal(raw, &t.Value)
+	case "CustomSql":
+		t := &types.PhysicalTableMemberCustomSql{}
+		v.PhysicalTable, err = t, json.Unmarshal(raw, &t.Value)
+	case "S3Source":
+		t := &types.PhysicalTableMemberS3Source{}
+		v.PhysicalTable, err = t, json.Unmarshal(raw, &t.Value)
+	case "SaaSTable":
+		t := &types.PhysicalTableMemberSaaSTable{}
+		v.PhysicalTable, err = t, json.Unmarshal(raw, &t.Value)
+	default:
+		return fmt.Errorf("unknown physical table member `%s`", member)
+	}
+	return err
+}
+
+func (v jsonTransformOperation) MarshalJSON() ([]byte, error) {
+	switch t := v.TransformOperation.(type) {
+	case *types.TransformOperationMemberProjectOperation:
+		return json.Marshal(map[string]interface{}{"ProjectOperation": t.Value})
+	case *types.TransformOperationMemberFilterOperation:
+		return json.Marshal(map[string]interface{}{"FilterOperation": t.Value})
+	case *types.TransformOperationMemberCreateColumnsOperation:
+		return json.Marshal(map[string]interface{}{"CreateColumnsOperation": t.Value})
+	case *types.TransformOperationMemberRenameColumnOperation:
+		return json.Marshal(map[string]interface{}{"RenameColumnOperation": t.Value})
+	case *types.TransformOperationMemberCastColumnTypeOperation:
+		return json.Marshal(map[string]interface{}{"CastColumnTypeOperation": t.Value})
+	case *types.TransformOperationMemberTagColumnOperation:
+		return json.Marshal(map[string]interface{}{"TagColumnOperation": t.Value})
+	case *types.TransformOperationMemberUntagColumnOperation:
+		return json.Marshal(map[string]interface{}{"UntagColumnOperation": t.Value})
+	case *types.TransformOperationMemberOverrideDatasetParameterOperation:
+		return json.Marshal(map[string]interface{}{"OverrideDatasetParameterOperation": t.Value})
+	default:
+		return marshalUnknownUnion("transform operation", t)
+	}
+}
+
+func (v *jsonTransformOperation) UnmarshalJSON(data []byte) error {
+	member, raw, err := unmarshalUnion(data)
+	if err != nil {
+		return fmt.Errorf("transform operation: %w", err)
+	}
+	switch member {
+	case "ProjectOperation":
+		t := &types.TransformOperationMemberProjectOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "FilterOperation":
+		t := &types.TransformOperationMemberFilterOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "CreateColumnsOperation":
+		t := &types.TransformOperationMemberCreateColumnsOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "RenameColumnOperation":
+		t := &types.TransformOperationMemberRenameColumnOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "CastColumnTypeOperation":
+		t := &types.TransformOperationMemberCastColumnTypeOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "TagColumnOperation":
+		t := &types.TransformOperationMemberTagColumnOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "UntagColumnOperation":
+		t := &types.TransformOperationMemberUntagColumnOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	case "OverrideDatasetParameterOperation":
+		t := &types.TransformOperationMemberOverrideDatasetParameterOperation{}
+		v.TransformOperation, err = t, json.Unmarshal(raw, &t.Value)
+	default:
+		return fmt.Errorf("unknown transform operation member `%s`", member)
+	}
+	return err
+}
+
+// marshalUnknownUnion serializes the union member unknown to this version with its type name and a reflection dump.
+func marshalUnknownUnion(kind string, member interface{}) ([]byte, error) {
+	name := fmt.Sprintf("%T", member)
+	if u, ok := member.(*types.UnknownUnionMember); ok {
+		name = u.Tag
+	}
+	log.Printf("[warn] %s `%s` is unknown to this version, serialized as is", kind, name)
+	value, err := json.Marshal(member)
+	if err != nil {
+		log.Printf("[debug] failed to marshal %s `%s`: %v", kind, name, err)
+		value = []byte("null")
+	}
+	return json.Marshal(map[string]interface{}{"unknown": name, "value": json.RawMessage(value)})
+}
+
+func unmarshalUnion(data []byte) (string, json.RawMessage, error) {
+	var union map[string]json.RawMessage
+	if err := json.Unmarshal(data, &union); err != nil {
+		return "", nil, err
+	}
+	if raw, ok := union["unknown"]; ok {
+		var name string
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return "", nil, err
+		}
+		return "", nil, fmt.Errorf("member `%s` is unknown to this version, can not be deserialized", name)
+	}
+	if len(union) != 1 {
+		return "", nil, fmt.Errorf("union must have exactly one member, got %d", len(union))
+	}
+	for member, raw := range union {
+		return member, raw, nil
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,41 @@
+package redshiftdatasetannotator
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+func TestMarshalDataSetJSONUnknownMember(t *testing.T) {
+	dataSet := testDataSet("users", &types.UnknownUnionMember{Tag: "NewOperation", Value: []byte(`{}`)})
+	bs, err := MarshalDataSetJSON(dataSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalDataSetJSON(bs); err == nil {
+		t.Error("UnmarshalDataSetJSON with unknown member succeeded, want error")
+	}
+	fingerprint, err := DataSetFingerprint(dataSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := DataSetFingerprint(testDataSet("users", &types.UnknownUnionMember{Tag: "NewOperation", Value: []byte(`{}`)}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fingerprint != again {
+		t.Errorf("fingerprints differ: %s and %s", fingerprint, again)
+	}
+}
+
+func TestDataFingerprintUnknownMember(t *testing.T) {
+	dataSet := testDataSet("users", &types.UnknownUnionMember{Tag: "NewOperation", Value: []byte(`{}`)})
+	dataSet.PhysicalTableMap["unknown"] = &types.UnknownUnionMember{Tag: "NewTable", Value: []byte(`{}`)}
+	input, err := NewUpdateDataSetInput(dataSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dataFingerprint(input); err != nil {
+		t.Fatal(err)
+	}
+}
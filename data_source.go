@@ -0,0 +1,91 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+// findDataSetsByDataSource returns the IDs of the data sets whose relational tables read from the data source.
+// If schema or table is not empty, only the data sets reading the relation are returned.
+// The data sets that failed to describe (other than the types not supported by the API) are returned as failed,
+// since they may read from the data source.
+func (app *App) findDataSetsByDataSource(ctx context.Context, dataSourceID string, schema string, table string) ([]string, []string, error) {
+	awsAccountID := app.AWSAccountID()
+	var dataSetIDs, failed []string
+	paginator := quicksight.NewListDataSetsPaginator(app.client, &quicksight.ListDataSetsInput{
+		AwsAccountId: aws.String(awsAccountID),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ListDataSets: %w", err)
+		}
+		for _, summary := range output.DataSetSummaries {
+			dataSetID := coalesce(summary.DataSetId)
+			if app.settings.ignoreDataSet(dataSetID) {
+				log.Printf("[debug] skip data set %s ignored by the project configuration", dataSetID)
+				continue
+			}
+			described, err := app.describeDataSet(ctx, aws.String(awsAccountID), dataSetID)
+			if err != nil {
+				if isNotDescribableDataSet(err) {
+					log.Printf("[debug] skip data set %s: %s", dataSetID, err)
+					continue
+				}
+				log.Printf("[error] data set %s: %s", dataSetID, err)
+				failed = append(failed, dataSetID)
+				continue
+			}
+			if len(relationalTablesOf(described.DataSet, dataSourceID, schema, table)) > 0 {
+				dataSetIDs = append(dataSetIDs, dataSetID)
+			}
+		}
+	}
+	return dataSetIDs, failed, nil
+}
+
+// isNotDescribableDataSet reports whether DescribeDataSet failed because the API does not support the type of the data set,
+// e.g. data sets of uploaded files.
+func isNotDescribableDataSet(err error) bool {
+	var invalidParameter *types.InvalidParameterValueException
+	return errors.As(err, &invalidParameter) && strings.Contains(invalidParameter.ErrorMessage(), "not supported through API")
+}
+
+// relationalTablesOf returns the relational tables of the data set reading from the data source,
+// filtered by schema and table if not empty.
+func relationalTablesOf(dataSet *types.DataSet, dataSourceID string, schema string, table string) map[string]types.RelationalTable {
+	tables := make(map[string]types.RelationalTable)
+	for physicalTableID, physicalTable := range dataSet.PhysicalTableMap {
+		relationalTable, ok := physicalTable.(*types.PhysicalTableMemberRelationalTable)
+		if !ok {
+			continue
+		}
+		if dataSourceIDOf(coalesce(relationalTable.Value.DataSourceArn)) != dataSourceID {
+			continue
+		}
+		if schema != "" && !strings.EqualFold(coalesce(relationalTable.Value.Schema), schema) {
+			continue
+		}
+		if table != "" && !strings.EqualFold(coalesce(relationalTable.Value.Name), table) {
+			continue
+		}
+		tables[physicalTableID] = relationalTable.Value
+	}
+	return tables
+}
+
+func dataSourceIDOf(dataSourceArn string) string {
+	arnObj, err := arn.Parse(dataSourceArn)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(arnObj.Resource, "datasource/")
+}
@@ -0,0 +1,90 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestFindDataSetsByDataSource(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	putDataSet := func(dataSetID, dataSourceID, schema, table string) {
+		dataSet := testDataSet(dataSetID)
+		relationalTable := testRelationalTable(dataSet)
+		relationalTable.DataSourceArn = aws.String(testArn("datasource/" + dataSourceID))
+		relationalTable.Schema = aws.String(schema)
+		relationalTable.Name = aws.String(table)
+		client.PutDataSet(dataSet)
+	}
+	putDataSet("users", "warehouse", "public", "users")
+	putDataSet("orders", "warehouse", "sales", "orders")
+	putDataSet("events", "lake", "public", "events")
+	app := newTestApp(t, client, io.Discard)
+	cases := []struct {
+		schema, table string
+		want          []string
+	}{
+		{"", "", []string{"orders", "users"}},
+		{"public", "", []string{"users"}},
+		{"sales", "orders", []string{"orders"}},
+		{"", "missing", nil},
+	}
+	for _, c := range cases {
+		got, failed, err := app.findDataSetsByDataSource(ctx, "warehouse", c.schema, c.table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(failed) > 0 {
+			t.Errorf("findDataSetsByDataSource(warehouse, %q, %q) failed = %v", c.schema, c.table, failed)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("findDataSetsByDataSource(warehouse, %q, %q) = %v, want %v", c.schema, c.table, got, c.want)
+		}
+	}
+}
+
+func TestFindDataSetsByDataSourceIgnore(t *testing.T) {
+	client := quicksighttest.NewClient()
+	for _, dataSetID := range []string{"users", "tmp_users"} {
+		client.PutDataSet(testDataSet(dataSetID))
+	}
+	app := newTestApp(t, client, io.Discard)
+	app.settings = projectSettings{Ignore: &ignoreList{DataSets: []string{"tmp_*"}}}
+	got, _, err := app.findDataSetsByDataSource(context.Background(), "warehouse", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("findDataSetsByDataSource = %v, want %v", got, want)
+	}
+}
+
+func TestFindDataSetsByDataSourceDescribeError(t *testing.T) {
+	client := quicksighttest.NewClient()
+	for _, dataSetID := range []string{"users", "uploaded", "throttled"} {
+		client.PutDataSet(testDataSet(dataSetID))
+	}
+	client.FailDescribeDataSet(testAWSAccountID, "uploaded", &types.InvalidParameterValueException{
+		Message: aws.String("The data set type is not supported through API yet"),
+	})
+	client.FailDescribeDataSet(testAWSAccountID, "throttled", &types.ThrottlingException{
+		Message: aws.String("Rate exceeded"),
+	})
+	app := newTestApp(t, client, io.Discard)
+	got, failed, err := app.findDataSetsByDataSource(context.Background(), "warehouse", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"users"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("data sets = %v, want %v", got, want)
+	}
+	if want := []string{"throttled"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("failed = %v, want %v", failed, want)
+	}
+}
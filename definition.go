@@ -0,0 +1,190 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+const (
+	assetKindAnalysis  = "analysis"
+	assetKindDashboard = "dashboard"
+)
+
+// assetDefinition is the definition of an analysis or a dashboard.
+type assetDefinition struct {
+	Kind string
+	ID   string
+	Name string
+	Arn  string
+
+	ThemeArn *string
+	// DashboardPublishOptions is set only for dashboards.
+	DashboardPublishOptions *types.DashboardPublishOptions
+
+	// Definition is *types.AnalysisDefinition or *types.DashboardVersionDefinition.
+	Definition       interface{}
+	Declarations     []types.DataSetIdentifierDeclaration
+	CalculatedFields []types.CalculatedField
+}
+
+// listAssetDefinitions describes the definitions of all analyses and dashboards of the account.
+// Assets whose definition can not be described (e.g. failed to create, throttled or AccessDenied) are skipped with a warning,
+// or, if strict, reported as an error after describing the others, since the assets skipped may use the data set.
+func (app *App) listAssetDefinitions(ctx context.Context, awsAccountID string, strict bool) ([]*assetDefinition, error) {
+	var assets []*assetDefinition
+	var failed []string
+	skip := func(kind, id string, err error) {
+		log.Printf("[warn] skip %s %s: %v", kind, id, err)
+		failed = append(failed, kind+" "+id)
+	}
+	analyses := quicksight.NewListAnalysesPaginator(app.client, &quicksight.ListAnalysesInput{
+		AwsAccountId: aws.String(awsAccountID),
+	})
+	for analyses.HasMorePages() {
+		output, err := analyses.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListAnalyses: %w", err)
+		}
+		for _, summary := range output.AnalysisSummaryList {
+			if summary.Status == types.ResourceStatusDeleted {
+				continue
+			}
+			described, err := app.client.DescribeAnalysisDefinition(ctx, &quicksight.DescribeAnalysisDefinitionInput{
+				AwsAccountId: aws.String(awsAccountID),
+				AnalysisId:   summary.AnalysisId,
+			})
+			if err != nil {
+				skip(assetKindAnalysis, coalesce(summary.AnalysisId), fmt.Errorf("DescribeAnalysisDefinition: %w", err))
+				continue
+			}
+			if described.Definition == nil {
+				log.Printf("[warn] skip analysis %s: no definition, status %s", coalesce(summary.AnalysisId), described.ResourceStatus)
+				continue
+			}
+			assets = append(assets, &assetDefinition{
+				Kind:             assetKindAnalysis,
+				ID:               coalesce(summary.AnalysisId),
+				Name:             coalesce(summary.Name),
+				Arn:              coalesce(summary.Arn),
+				ThemeArn:         described.ThemeArn,
+				Definition:       described.Definition,
+				Declarations:     described.Definition.DataSetIdentifierDeclarations,
+				CalculatedFields: described.Definition.CalculatedFields,
+			})
+		}
+	}
+	dashboards := quicksight.NewListDashboardsPaginator(app.client, &quicksight.ListDashboardsInput{
+		AwsAccountId: aws.String(awsAccountID),
+	})
+	for dashboards.HasMorePages() {
+		output, err := dashboards.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListDashboards: %w", err)
+		}
+		for _, summary := range output.DashboardSummaryList {
+			described, err := app.client.DescribeDashboardDefinition(ctx, &quicksight.DescribeDashboardDefinitionInput{
+				AwsAccountId: aws.String(awsAccountID),
+				DashboardId:  summary.DashboardId,
+			})
+			if err != nil {
+				skip(assetKindDashboard, coalesce(summary.DashboardId), fmt.Errorf("DescribeDashboardDefinition: %w", err))
+				continue
+			}
+			if described.Definition == nil {
+				log.Printf("[warn] skip dashboard %s: no definition, status %s", coalesce(summary.DashboardId), described.ResourceStatus)
+				continue
+			}
+			assets = append(assets, &assetDefinition{
+				Kind:             assetKindDashboard,
+				ID:               coalesce(summary.DashboardId),
+				Name:             coalesce(summary.Name),
+				Arn:              coalesce(summary.Arn),
+				ThemeArn:         described.ThemeArn,
+				Definition:       described.Definition,
+				Declarations:     described.Definition.DataSetIdentifierDeclarations,
+				CalculatedFields: described.Definition.CalculatedFields,
+
+				DashboardPublishOptions: described.DashboardPublishOptions,
+			})
+		}
+	}
+	if strict && len(failed) > 0 {
+		return nil, fmt.Errorf("failed to describe %d analyses and dashboards: %s", len(failed), strings.Join(failed, ", "))
+	}
+	return assets, nil
+}
+
+// dataSetIdentifiers returns the identifiers declared for the data set in the definition.
+func (asset *assetDefinition) dataSetIdentifiers(dataSetArn string) map[string]bool {
+	identifiers := make(map[string]bool)
+	for _, declaration := range asset.Declarations {
+		if coalesce(declaration.DataSetArn) == dataSetArn {
+			identifiers[coalesce(declaration.Identifier)] = true
+		}
+	}
+	return identifiers
+}
+
+// fieldReferences returns the column identifiers (of visuals, filters, parameters, etc.) referring the field of the data set,
+// and the calculated fields using the field in the expression.
+func (asset *assetDefinition) fieldReferences(dataSetArn string, fieldName string) ([]*types.ColumnIdentifier, []*types.CalculatedField) {
+	identifiers := asset.dataSetIdentifiers(dataSetArn)
+	if len(identifiers) == 0 {
+		return nil, nil
+	}
+	var columns []*types.ColumnIdentifier
+	walkColumnIdentifiers(reflect.ValueOf(asset.Definition), func(column *types.ColumnIdentifier) {
+		if identifiers[coalesce(column.DataSetIdentifier)] && coalesce(column.ColumnName) == fieldName {
+			columns = append(columns, column)
+		}
+	})
+	var calculatedFields []*types.CalculatedField
+	for i := range asset.CalculatedFields {
+		calculatedField := &asset.CalculatedFields[i]
+		if identifiers[coalesce(calculatedField.DataSetIdentifier)] && referencesColumn(coalesce(calculatedField.Expression), fieldName) {
+			calculatedFields = append(calculatedFields, calculatedField)
+		}
+	}
+	return columns, calculatedFields
+}
+
+var columnIdentifierType = reflect.TypeOf(types.ColumnIdentifier{})
+
+// walkColumnIdentifiers calls fn with every ColumnIdentifier in v.
+// The definitions of analyses and dashboards are trees of structs, slices and union interfaces, so v is walked by reflection.
+func walkColumnIdentifiers(v reflect.Value, fn func(*types.ColumnIdentifier)) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			walkColumnIdentifiers(v.Elem(), fn)
+		}
+	case reflect.Struct:
+		if v.Type() == columnIdentifierType {
+			if v.CanAddr() {
+				fn(v.Addr().Interface().(*types.ColumnIdentifier))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				walkColumnIdentifiers(v.Field(i), fn)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkColumnIdentifiers(v.Index(i), fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkColumnIdentifiers(iter.Value(), fn)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/samber/lo"
+)
+
+type DoctorOption struct {
+	SkipQuery bool `help:"do not run a query on Redshift for each data source"`
+}
+
+// doctorChecklist prints the results of the checks with hints to fix the failures.
+type doctorChecklist struct {
+	w        io.Writer
+	failures int
+}
+
+func (c *doctorChecklist) ok(format string, args ...interface{}) {
+	fmt.Fprintf(c.w, "[OK] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (c *doctorChecklist) ng(err error, hint string, format string, args ...interface{}) {
+	c.failures++
+	fmt.Fprintf(c.w, "[NG] %s: %s\n", fmt.Sprintf(format, args...), err)
+	if hint != "" {
+		fmt.Fprintf(c.w, "     -> %s\n", hint)
+	}
+}
+
+func (app *App) RunDoctor(ctx context.Context, opt *DoctorOption) error {
+	checklist := &doctorChecklist{w: app.w}
+	app.doctorConfig(checklist)
+
+	output, err := app.stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		checklist.ng(err, "check the AWS credentials (AWS_PROFILE, or quicksight_aws_profile and quicksight_role_arn of the profile)", "caller identity")
+		return fmt.Errorf("doctor found %d problem(s)", checklist.failures)
+	}
+	checklist.ok("caller identity: %s", coalesce(output.Arn))
+	awsAccountID := app.AWSAccountID()
+	if awsAccountID == "" {
+		awsAccountID = coalesce(output.Account)
+	}
+
+	dataSources, err := app.listDataSources(ctx, awsAccountID)
+	if err != nil {
+		checklist.ng(err, "grant quicksight:ListDataSources, quicksight:DescribeDataSource, quicksight:DescribeDataSet and quicksight:UpdateDataSet, or check --aws-account-id and the region", "QuickSight in %s", awsAccountID)
+		return fmt.Errorf("doctor found %d problem(s)", checklist.failures)
+	}
+	redshiftDataSources := lo.Filter(dataSources, func(ds types.DataSource, _ int) bool {
+		return ds.Type == types.DataSourceTypeRedshift
+	})
+	checklist.ok("QuickSight in %s: %d data source(s), %d Redshift data source(s)", awsAccountID, len(dataSources), len(redshiftDataSources))
+
+	for i := range redshiftDataSources {
+		app.doctorDataSource(ctx, checklist, &redshiftDataSources[i], opt)
+	}
+	if checklist.failures > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", checklist.failures)
+	}
+	return nil
+}
+
+// doctorConfig validates the schema of the user configuration file and the profile names,
+// and reports the errors of the project configuration file, the environment variables and the profile deferred by New.
+func (app *App) doctorConfig(checklist *doctorChecklist) {
+	if app.cfgErr != nil {
+		checklist.ng(app.cfgErr, "fix the configuration file, the RSDSA_* environment variables or --profile. the following checks use the default configuration", "configuration")
+	}
+	p := configFilePath()
+	b, err := os.ReadFile(p)
+	switch {
+	case os.IsNotExist(err):
+		checklist.ok("configuration file %s: not found, the default profile (serverless workgroup `default`) is used", p)
+	case err != nil:
+		checklist.ng(err, "check the permission of the file", "configuration file %s", p)
+	default:
+		var cfg Config
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			checklist.ng(err, "fix the key or the value, see README for the keys of a profile", "configuration file %s", p)
+		} else {
+			checklist.ok("configuration file %s", p)
+		}
+	}
+	if len(app.cfgFiles) > 1 {
+		for _, file := range app.cfgFiles[1:] {
+			checklist.ok("project configuration file %s", file)
+		}
+	}
+	if err := app.cfg.validate(); err != nil {
+		checklist.ng(err, "fix the glob or regexp of the profile name", "profile names")
+	}
+	names := lo.Keys(app.cfg)
+	sort.Strings(names)
+	for _, name := range names {
+		profile := app.cfg[name]
+		if profile == nil || profile.Connection == nil {
+			continue
+		}
+		if connection := *profile.Connection; connection != connectionDataAPI && connection != connectionPostgres {
+			checklist.ng(fmt.Errorf("unknown connection `%s`", connection), "set `data-api` or `postgres`", "profile `%s`", name)
+		}
+	}
+}
+
+func (app *App) listDataSources(ctx context.Context, awsAccountID string) ([]types.DataSource, error) {
+	var dataSources []types.DataSource
+	paginator := quicksight.NewListDataSourcesPaginator(app.client, &quicksight.ListDataSourcesInput{
+		AwsAccountId: aws.String(awsAccountID),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListDataSources: %w", err)
+		}
+		dataSources = append(dataSources, output.DataSources...)
+	}
+	return dataSources, nil
+}
+
+// doctorDataSource checks the matched profile of the data source, and runs a trivial query on Redshift.
+func (app *App) doctorDataSource(ctx context.Context, checklist *doctorChecklist, ds *types.DataSource, opt *DoctorOption) {
+	title := fmt.Sprintf("data source `%s` (%s)", coalesce(ds.Name), coalesce(ds.DataSourceId))
+	target, err := app.resolveRedshiftTarget(ctx, ds)
+	if err != nil {
+		checklist.ng(err, "", "%s", title)
+		return
+	}
+	name, _ := app.cfg.lookup(target)
+	profile := app.cfg.lookupTarget(target)
+	if name == "" {
+		name = "(none)"
+	}
+	connection := coalesce(profile.Connection, aws.String(connectionDataAPI))
+	detail := fmt.Sprintf("%s, profile `%s`, connection %s", target, name, connection)
+	if opt.SkipQuery {
+		checklist.ok("%s: %s", title, detail)
+		return
+	}
+	hint := fmt.Sprintf("configure the profile `%s` (e.g. `redshift-data-set-annotator configure --host %s`), or add a profile for the data source", name, target.Host)
+	db, err := app.openRedshift(ctx, ds)
+	if err != nil {
+		checklist.ng(err, hint, "%s: %s", title, detail)
+		return
+	}
+	defer db.Close()
+	var one int
+	if err := db.QueryRowContext(ctx, "select 1").Scan(&one); err != nil {
+		if connection == connectionDataAPI {
+			hint = "grant redshift-data:ExecuteStatement, redshift-data:DescribeStatement and redshift-data:GetStatementResult, and the credentials of the database (db_user, secret_arn or the IAM identity)"
+		} else {
+			hint = "check the network to the host and the credentials of the database"
+		}
+		checklist.ng(err, hint, "%s: %s", title, detail)
+		return
+	}
+	log.Printf("[debug] %s: select 1 returns %d", title, one)
+	checklist.ok("%s: %s, query ok", title, detail)
+}
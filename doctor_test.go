@@ -0,0 +1,109 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+type fakeSTSClient struct{}
+
+func (fakeSTSClient) GetCallerIdentity(ctx context.Context, params *sts.GetCallerIdentityInput, optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String("123456789012"),
+		Arn:     aws.String("arn:aws:iam::123456789012:user/doctor"),
+	}, nil
+}
+
+func TestRunDoctor(t *testing.T) {
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = t.TempDir()
+
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(&types.DataSource{
+		Arn:          aws.String("arn:aws:quicksight:ap-northeast-1:123456789012:datasource/warehouse"),
+		DataSourceId: aws.String("warehouse"),
+		Name:         aws.String("warehouse"),
+		Type:         types.DataSourceTypeRedshift,
+		DataSourceParameters: &types.DataSourceParametersMemberRedshiftParameters{
+			Value: types.RedshiftParameters{
+				Host:     aws.String("warehouse.abc123.ap-northeast-1.redshift.amazonaws.com"),
+				Database: aws.String("dev"),
+			},
+		},
+	})
+	client.PutDataSource(&types.DataSource{
+		Arn:          aws.String("arn:aws:quicksight:ap-northeast-1:123456789012:datasource/athena"),
+		DataSourceId: aws.String("athena"),
+		Name:         aws.String("athena"),
+		Type:         types.DataSourceTypeAthena,
+	})
+	var buf bytes.Buffer
+	app, err := New(ctx, "123456789012",
+		WithQuickSightClient(client),
+		WithSTSClient(fakeSTSClient{}),
+		WithConfig(Config{"cluster:warehouse": &ProfileConfig{DBUser: aws.String("admin")}}),
+		WithWriter(&buf),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunDoctor(ctx, &DoctorOption{SkipQuery: true}); err != nil {
+		t.Fatalf("RunDoctor: %s\n%s", err, buf.String())
+	}
+	for _, want := range []string{
+		"[OK] caller identity: arn:aws:iam::123456789012:user/doctor",
+		"[OK] QuickSight in 123456789012: 2 data source(s), 1 Redshift data source(s)",
+		"[OK] data source `warehouse` (warehouse): cluster warehouse (warehouse.abc123.ap-northeast-1.redshift.amazonaws.com), profile `cluster:warehouse`, connection data-api",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRunDoctorConfigError(t *testing.T) {
+	defer func(dir string) { configDir = dir }(configDir)
+	configDir = t.TempDir()
+	t.Setenv("RSDSA_PORT", "not a number")
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), projectConfigFileName)
+	if err := os.WriteFile(path, []byte("profiles: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := []Option{
+		WithQuickSightClient(quicksighttest.NewClient()),
+		WithSTSClient(fakeSTSClient{}),
+		WithConfigFile(path),
+	}
+	if _, err := New(ctx, "123456789012", opts...); err == nil {
+		t.Fatal("New with invalid RSDSA_PORT succeeded, want error")
+	}
+	var buf bytes.Buffer
+	app, err := New(ctx, "123456789012", append(opts, WithDeferredConfigErrors(), WithWriter(&buf))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := app.RunDoctor(ctx, &DoctorOption{SkipQuery: true}); err == nil {
+		t.Fatal("RunDoctor with invalid RSDSA_PORT succeeded, want error")
+	}
+	for _, want := range []string{
+		"[NG] configuration: ",
+		"RSDSA_PORT",
+		"[OK] caller identity: arn:aws:iam::123456789012:user/doctor",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output does not contain %q\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+	"gopkg.in/yaml.v3"
+)
+
+type ExportOption struct {
+	DataSetID    []string `help:"data set ID to export, can be repeated"`
+	DataSourceID string   `help:"Export all data sets using the data source, instead of --data-set-id"`
+	Schema       string   `help:"With --data-source-id, export only data sets using a table in the schema"`
+	Table        string   `help:"With --data-source-id, export only data sets using the table"`
+	OutputDir    string   `help:"write <data-set-id>.yaml into the directory, instead of stdout" type:"path"`
+}
+
+// DataSetExport is the effective field metadata of a data set.
+// It is also read by annotate --annotations-file, and by apply as the spec of the data set.
+type DataSetExport struct {
+	DataSetID        string                   `yaml:"data_set_id"`
+	Name             string                   `yaml:"name,omitempty"`
+	Fields           []*FieldExport           `yaml:"fields"`
+	CalculatedFields []*CalculatedFieldExport `yaml:"calculated_fields,omitempty"`
+}
+
+// FieldExport is a field of the data set read from a column of Redshift.
+// Name is the logical name, and Source is the column, schema.table.column.
+type FieldExport struct {
+	Name           string `yaml:"name"`
+	Source         string `yaml:"source"`
+	Description    string `yaml:"description,omitempty"`
+	GeographicRole string `yaml:"geographic_role,omitempty"`
+	Cast           string `yaml:"cast,omitempty"`
+	Folder         string `yaml:"folder,omitempty"`
+	Hidden         bool   `yaml:"hidden,omitempty"`
+}
+
+// CalculatedFieldExport is a calculated field of the data set. annotate --annotations-file ignores them.
+type CalculatedFieldExport struct {
+	Name        string `yaml:"name"`
+	Expression  string `yaml:"expression"`
+	Description string `yaml:"description,omitempty"`
+	Folder      string `yaml:"folder,omitempty"`
+}
+
+func (app *App) RunExport(ctx context.Context, opt *ExportOption) error {
+	if len(opt.DataSetID) == 0 {
+		merged := *opt
+		merged.DataSourceID, merged.Schema, merged.Table = app.settings.selectDataSource(opt.DataSourceID, opt.Schema, opt.Table)
+		opt = &merged
+	}
+	switch {
+	case len(opt.DataSetID) > 0 && opt.DataSourceID != "":
+		return errors.New("--data-set-id and --data-source-id can not be used together")
+	case len(opt.DataSetID) == 0 && opt.DataSourceID == "":
+		return errors.New("--data-set-id or --data-source-id is required")
+	case opt.DataSourceID == "" && (opt.Schema != "" || opt.Table != ""):
+		return errors.New("--schema and --table require --data-source-id")
+	}
+	dataSetIDs := opt.DataSetID
+	if opt.DataSourceID != "" {
+		var failed []string
+		var err error
+		dataSetIDs, failed, err = app.findDataSetsByDataSource(ctx, opt.DataSourceID, opt.Schema, opt.Table)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to describe %d data set(s): %s", len(failed), strings.Join(failed, ", "))
+		}
+		log.Printf("[info] found %d data set(s) using data source %s", len(dataSetIDs), opt.DataSourceID)
+	}
+	if opt.OutputDir != "" {
+		if err := os.MkdirAll(opt.OutputDir, 0755); err != nil {
+			return err
+		}
+	}
+	enc := yaml.NewEncoder(app.w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	for _, dataSetID := range dataSetIDs {
+		described, err := app.describeDataSet(ctx, aws.String(app.AWSAccountID()), dataSetID)
+		if err != nil {
+			return err
+		}
+		export := NewDataSetExport(described.DataSet)
+		if opt.OutputDir == "" {
+			if err := enc.Encode(export); err != nil {
+				return err
+			}
+			continue
+		}
+		var buf bytes.Buffer
+		fileEnc := yaml.NewEncoder(&buf)
+		fileEnc.SetIndent(2)
+		if err := fileEnc.Encode(export); err != nil {
+			return err
+		}
+		if err := fileEnc.Close(); err != nil {
+			return err
+		}
+		path := filepath.Join(opt.OutputDir, dataSetID+".yaml")
+		if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		log.Printf("[info] exported data set %s to %s", dataSetID, path)
+	}
+	return nil
+}
+
+// NewDataSetExport walks the transforms of the logical tables, and returns the fields read from the columns of Redshift
+// and the calculated fields. The fields of custom SQL are not exported.
+func NewDataSetExport(dataSet *types.DataSet) *DataSetExport {
+	folders := make(map[string]string)
+	for path, folder := range dataSet.FieldFolders {
+		for _, column := range folder.Columns {
+			folders[column] = path
+		}
+	}
+	export := &DataSetExport{
+		DataSetID: coalesce(dataSet.DataSetId),
+		Name:      coalesce(dataSet.Name),
+		Fields:    make([]*FieldExport, 0),
+	}
+	for _, field := range sourceFields(dataSet) {
+		if field.Table == nil {
+			continue
+		}
+		export.Fields = append(export.Fields, &FieldExport{
+			Name:           field.Trace.Name,
+			Source:         field.Source(),
+			Description:    field.Trace.Description,
+			GeographicRole: string(field.Trace.GeographicRole),
+			Cast:           string(field.Trace.CastType),
+			Folder:         folders[field.Trace.Name],
+			Hidden:         !field.Trace.Visible,
+		})
+	}
+	logicalTableIDs := lo.Keys(dataSet.LogicalTableMap)
+	sort.Strings(logicalTableIDs)
+	for _, logicalTableID := range logicalTableIDs {
+		for i, transform := range dataSet.LogicalTableMap[logicalTableID].DataTransforms {
+			op, ok := transform.(*types.TransformOperationMemberCreateColumnsOperation)
+			if !ok {
+				continue
+			}
+			for _, column := range op.Value.Columns {
+				trace := traceField(dataSet, logicalTableID, i+1, coalesce(column.ColumnName))
+				export.CalculatedFields = append(export.CalculatedFields, &CalculatedFieldExport{
+					Name:        coalesce(column.ColumnName),
+					Expression:  coalesce(column.Expression),
+					Description: trace.Description,
+					Folder:      folders[trace.Name],
+				})
+			}
+		}
+	}
+	return export
+}
+
+// ColumnAnnotations returns the annotations of the columns of the relation, as if they were read from the column comments.
+func (export *DataSetExport) ColumnAnnotations(schema string, table string) ColumnAnnotations {
+	annotations := make(ColumnAnnotations)
+	prefix := strings.ToLower(schema + "." + table + ".")
+	for _, field := range export.Fields {
+		if !strings.HasPrefix(strings.ToLower(field.Source), prefix) {
+			continue
+		}
+		column := field.Source[len(prefix):]
+		annotation := &ColumnAnnotation{
+			CoumnName:   column,
+			Name:        nillif(field.Name, ""),
+			Description: nillif(field.Description, ""),
+			Hints:       make(map[string]string),
+		}
+		if field.GeographicRole != "" {
+			annotation.Hints["geographic_role"] = field.GeographicRole
+		}
+		if field.Cast != "" {
+			annotation.Hints["cast"] = field.Cast
+		}
+		if field.Folder != "" {
+			annotation.Hints["folder"] = field.Folder
+		}
+		if field.Hidden {
+			annotation.Hints["hidden"] = ""
+		}
+		annotations[column] = annotation
+	}
+	return annotations
+}
+
+// loadAnnotationsFile reads the YAML documents written by export, and returns the one of the data set.
+func loadAnnotationsFile(path string, dataSetID string) (*DataSetExport, error) {
+	exports, err := loadDataSetExports(path)
+	if err != nil {
+		return nil, fmt.Errorf("annotations file %s: %w", path, err)
+	}
+	for _, export := range exports {
+		if export.DataSetID == dataSetID {
+			return export, nil
+		}
+	}
+	return nil, fmt.Errorf("annotations file %s: no fields of data set %s", path, dataSetID)
+}
+
+// loadDataSetExports reads all YAML documents of the file. Unknown keys are an error.
+func loadDataSetExports(path string) ([]*DataSetExport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	var exports []*DataSetExport
+	for {
+		var export DataSetExport
+		if err := dec.Decode(&export); err != nil {
+			if errors.Is(err, io.EOF) {
+				return exports, nil
+			}
+			return nil, err
+		}
+		if export.DataSetID == "" {
+			return nil, fmt.Errorf("data_set_id is required in document %d", len(exports)+1)
+		}
+		exports = append(exports, &export)
+	}
+}
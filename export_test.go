@@ -0,0 +1,106 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+	"gopkg.in/yaml.v3"
+)
+
+func TestExportRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users",
+		testRename("pref_code", "Prefecture"),
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{ColumnName: aws.String("Prefecture"), Tags: []types.ColumnTag{
+				{ColumnDescription: &types.ColumnDescription{Text: aws.String("Prefecture code")}},
+				{ColumnGeographicRole: types.GeoSpatialDataRoleState},
+			}},
+		},
+	))
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	export := func() *DataSetExport {
+		t.Helper()
+		buf.Reset()
+		if err := app.RunExport(ctx, &ExportOption{DataSetID: []string{"users"}}); err != nil {
+			t.Fatal(err)
+		}
+		var exported DataSetExport
+		if err := yaml.Unmarshal(buf.Bytes(), &exported); err != nil {
+			t.Fatal(err)
+		}
+		return &exported
+	}
+	exported := export()
+	want := &DataSetExport{
+		DataSetID: "users",
+		Name:      "users",
+		Fields: []*FieldExport{
+			{Name: "id", Source: "public.users.id"},
+			{Name: "Prefecture", Source: "public.users.pref_code", Description: "Prefecture code", GeographicRole: "STATE"},
+		},
+	}
+	if !reflect.DeepEqual(exported, want) {
+		t.Fatalf("export = %s, want %s", buf.String(), marshalYAML(t, want))
+	}
+
+	annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+	annotate := func(export *DataSetExport) {
+		t.Helper()
+		if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := app.RunAnnotate(ctx, &AnnotateOption{
+			DataSetID:              "users",
+			AnnotationsFile:        annotationsFile,
+			ForceRename:            true,
+			ForceUpdateDescription: true,
+			OnConflict:             "abort",
+			BackupOption:           BackupOption{NoBackup: true},
+			IngestionOption:        IngestionOption{SpiceRefresh: "allow"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the unedited export makes no changes.
+	annotate(exported)
+	if n := len(client.Updates()); n != 0 {
+		t.Fatalf("updates = %d, want 0", n)
+	}
+
+	edited := &DataSetExport{
+		DataSetID: "users",
+		Name:      "users",
+		Fields: []*FieldExport{
+			{Name: "User ID", Source: "public.users.id", Cast: "INTEGER", Folder: "Keys"},
+			{Name: "Prefecture", Source: "public.users.pref_code", Description: "JIS X 0401 prefecture code", GeographicRole: "STATE"},
+		},
+	}
+	annotate(edited)
+	if n := len(client.Updates()); n != 1 {
+		t.Fatalf("updates = %d, want 1", n)
+	}
+	if exported := export(); !reflect.DeepEqual(exported, edited) {
+		t.Errorf("export after annotate = %s, want %s", buf.String(), marshalYAML(t, edited))
+	}
+}
+
+func marshalYAML(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
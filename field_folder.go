@@ -0,0 +1,108 @@
+package redshiftdatasetannotator
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+type folderPrefix struct {
+	Prefix string
+	Folder string
+}
+
+type folderPrefixMatcher []folderPrefix
+
+func newFolderPrefixMatcher(prefixes map[string]string) folderPrefixMatcher {
+	matcher := make(folderPrefixMatcher, 0, len(prefixes))
+	for prefix, folder := range prefixes {
+		matcher = append(matcher, folderPrefix{Prefix: strings.ToLower(prefix), Folder: normalizeFolderPath(folder)})
+	}
+	// longest prefix first
+	sort.Slice(matcher, func(i, j int) bool {
+		if len(matcher[i].Prefix) != len(matcher[j].Prefix) {
+			return len(matcher[i].Prefix) > len(matcher[j].Prefix)
+		}
+		return matcher[i].Prefix < matcher[j].Prefix
+	})
+	return matcher
+}
+
+// Match returns the folder of the longest prefix matching columnName.
+func (matcher folderPrefixMatcher) Match(columnName string) (string, bool) {
+	name := strings.ToLower(columnName)
+	for _, p := range matcher {
+		if strings.HasPrefix(name, p.Prefix) {
+			return p.Folder, true
+		}
+	}
+	return "", false
+}
+
+func normalizeFolderPath(folder string) string {
+	parts := strings.Split(folder, "/")
+	parts = lo.Map(parts, func(part string, _ int) string {
+		return strings.TrimSpace(part)
+	})
+	parts = lo.Filter(parts, func(part string, _ int) bool {
+		return part != ""
+	})
+	return strings.Join(parts, "/")
+}
+
+// findFieldFolder returns the folder path that contains the column.
+func findFieldFolder(fieldFolders map[string]types.FieldFolder, columnName string) (string, bool) {
+	for folderPath, folder := range fieldFolders {
+		if lo.Contains(folder.Columns, columnName) {
+			return folderPath, true
+		}
+	}
+	return "", false
+}
+
+// setFieldFolder moves the column into folderPath.
+// If the column already belongs to another folder, it is only moved when force is true.
+// Reports whether the field folders have been changed.
+func setFieldFolder(fieldFolders map[string]types.FieldFolder, folderPath string, columnName string, force bool) bool {
+	if current, ok := findFieldFolder(fieldFolders, columnName); ok {
+		if current == folderPath || !force {
+			return false
+		}
+		folder := fieldFolders[current]
+		folder.Columns = lo.Without(folder.Columns, columnName)
+		if len(folder.Columns) == 0 && folder.Description == nil {
+			delete(fieldFolders, current)
+			log.Printf("[debug] remove empty field folder `%s`", current)
+		} else {
+			fieldFolders[current] = folder
+		}
+	}
+	folder := fieldFolders[folderPath]
+	folder.Columns = append(cloneSlice(folder.Columns), columnName)
+	fieldFolders[folderPath] = folder
+	return true
+}
+
+// renameFieldFolderColumns rewrites the column name referenced by field folders.
+// Reports whether the field folders have been changed.
+func renameFieldFolderColumns(fieldFolders map[string]types.FieldFolder, oldColumnName, newColumnName string) bool {
+	var changed bool
+	for folderPath, folder := range fieldFolders {
+		if !lo.Contains(folder.Columns, oldColumnName) {
+			continue
+		}
+		folder.Columns = lo.Map(folder.Columns, func(columnName string, _ int) string {
+			if columnName == oldColumnName {
+				return newColumnName
+			}
+			return columnName
+		})
+		fieldFolders[folderPath] = folder
+		log.Printf("[debug] change field folder `%s` column `%s` to `%s`", folderPath, oldColumnName, newColumnName)
+		changed = true
+	}
+	return changed
+}
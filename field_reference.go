@@ -0,0 +1,267 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// fieldReferenceRewrite is the rewrite of the field references of an analysis or a dashboard
+// for the renamed fields of a data set.
+type fieldReferenceRewrite struct {
+	asset   *assetDefinition
+	changes []string
+}
+
+// changedFieldNames returns the renames of renamedColumns that change the current field names of the data set.
+// renamedColumns also maps the physical columns of the kept renames, which are not the current fields.
+func changedFieldNames(dataSet *types.DataSet, renamedColumns map[string]string) map[string]string {
+	current := make(map[string]bool)
+	for _, field := range sourceFields(dataSet) {
+		current[field.Trace.Name] = true
+	}
+	return lo.PickBy(renamedColumns, func(oldName string, newName string) bool {
+		return current[oldName] && oldName != newName
+	})
+}
+
+// planFieldReferenceRewrites finds the analyses and dashboards using the data set, and rewrites the column identifiers
+// and the calculated field expressions referring the renamed fields (old name to new name) in their definitions.
+// The definitions are rewritten in memory, and applied by applyFieldReferenceRewrites.
+func (app *App) planFieldReferenceRewrites(ctx context.Context, dataSetArn string, renamedColumns map[string]string) ([]*fieldReferenceRewrite, error) {
+	if len(renamedColumns) == 0 {
+		return nil, nil
+	}
+	// an asset skipped here would be left with the references to the old names
+	assets, err := app.listAssetDefinitions(ctx, app.AWSAccountID(), true)
+	if err != nil {
+		return nil, err
+	}
+	oldNames := lo.Keys(renamedColumns)
+	sort.Strings(oldNames)
+	// renames are applied at once, so that swapped names (a to b, b to a) are not renamed twice.
+	replacements := make([]string, 0, len(oldNames)*2)
+	for _, oldName := range oldNames {
+		replacements = append(replacements, "{"+oldName+"}", "{"+renamedColumns[oldName]+"}")
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	var rewrites []*fieldReferenceRewrite
+	for _, asset := range assets {
+		identifiers := asset.dataSetIdentifiers(dataSetArn)
+		if len(identifiers) == 0 {
+			continue
+		}
+		references := make(map[string]int)
+		walkColumnIdentifiers(reflect.ValueOf(asset.Definition), func(column *types.ColumnIdentifier) {
+			if !identifiers[coalesce(column.DataSetIdentifier)] {
+				return
+			}
+			if newName, ok := renamedColumns[coalesce(column.ColumnName)]; ok {
+				references[coalesce(column.ColumnName)]++
+				column.ColumnName = aws.String(newName)
+			}
+		})
+		changes := make([]string, 0)
+		for _, oldName := range oldNames {
+			if n := references[oldName]; n > 0 {
+				changes = append(changes,
+					fmt.Sprintf("  - field `%s` (%d reference(s))", oldName, n),
+					fmt.Sprintf("  + field `%s` (%d reference(s))", renamedColumns[oldName], n),
+				)
+			}
+		}
+		for i := range asset.CalculatedFields {
+			calculatedField := &asset.CalculatedFields[i]
+			if !identifiers[coalesce(calculatedField.DataSetIdentifier)] {
+				continue
+			}
+			expression := coalesce(calculatedField.Expression)
+			rewritten := replacer.Replace(expression)
+			if rewritten == expression {
+				continue
+			}
+			calculatedField.Expression = aws.String(rewritten)
+			changes = append(changes,
+				fmt.Sprintf("  - calculated field `%s`: %s", coalesce(calculatedField.Name), expression),
+				fmt.Sprintf("  + calculated field `%s`: %s", coalesce(calculatedField.Name), rewritten),
+			)
+		}
+		if len(changes) == 0 {
+			log.Printf("[debug] %s %s does not refer the renamed fields", asset.Kind, asset.ID)
+			continue
+		}
+		rewrites = append(rewrites, &fieldReferenceRewrite{
+			asset:   asset,
+			changes: changes,
+		})
+	}
+	return rewrites, nil
+}
+
+func printFieldReferenceRewrites(w io.Writer, rewrites []*fieldReferenceRewrite) {
+	for _, rewrite := range rewrites {
+		fmt.Fprintf(w, "~ %s %s `%s`\n", rewrite.asset.Kind, rewrite.asset.ID, rewrite.asset.Name)
+		for _, change := range rewrite.changes {
+			fmt.Fprintln(w, change)
+		}
+	}
+}
+
+var (
+	assetPollingInterval = 2 * time.Second
+	assetUpdateTimeout   = 5 * time.Minute
+)
+
+// applyFieldReferenceRewrites updates the analyses, and the dashboards with publishing the new versions.
+// Every rewrite is tried, and the assets failed to update are reported at the end.
+func (app *App) applyFieldReferenceRewrites(ctx context.Context, rewrites []*fieldReferenceRewrite) error {
+	var failed []string
+	for _, rewrite := range rewrites {
+		asset := rewrite.asset
+		if err := app.applyFieldReferenceRewrite(ctx, asset); err != nil {
+			log.Printf("[error] failed to rewrite field references of %s %s: %s", asset.Kind, asset.ID, err)
+			failed = append(failed, asset.Kind+" "+asset.ID)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to rewrite field references of %d of %d analyses and dashboards: %s", len(failed), len(rewrites), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// applyFieldReferenceRewrite updates the asset and waits for the update to finish.
+// For dashboards, the new version is published after it is created successfully.
+func (app *App) applyFieldReferenceRewrite(ctx context.Context, asset *assetDefinition) error {
+	awsAccountID := aws.String(app.AWSAccountID())
+	switch asset.Kind {
+	case assetKindAnalysis:
+		_, err := app.client.UpdateAnalysis(ctx, &quicksight.UpdateAnalysisInput{
+			AwsAccountId: awsAccountID,
+			AnalysisId:   aws.String(asset.ID),
+			Name:         aws.String(asset.Name),
+			ThemeArn:     asset.ThemeArn,
+			Definition:   asset.Definition.(*types.AnalysisDefinition),
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateAnalysis: %w", err)
+		}
+		err = waitAssetStatus(ctx, func(ctx context.Context) (types.ResourceStatus, []string, error) {
+			output, err := app.client.DescribeAnalysis(ctx, &quicksight.DescribeAnalysisInput{
+				AwsAccountId: awsAccountID,
+				AnalysisId:   aws.String(asset.ID),
+			})
+			if err != nil {
+				return "", nil, fmt.Errorf("DescribeAnalysis: %w", err)
+			}
+			messages := lo.Map(output.Analysis.Errors, func(e types.AnalysisError, _ int) string {
+				return fmt.Sprintf("%s: %s", e.Type, coalesce(e.Message))
+			})
+			return output.Analysis.Status, messages, nil
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("[info] updated field references of analysis %s", asset.ID)
+	case assetKindDashboard:
+		output, err := app.client.UpdateDashboard(ctx, &quicksight.UpdateDashboardInput{
+			AwsAccountId:            awsAccountID,
+			DashboardId:             aws.String(asset.ID),
+			Name:                    aws.String(asset.Name),
+			ThemeArn:                asset.ThemeArn,
+			DashboardPublishOptions: asset.DashboardPublishOptions,
+			Definition:              asset.Definition.(*types.DashboardVersionDefinition),
+			VersionDescription:      aws.String("rewrite field references of renamed fields by redshift-data-set-annotator"),
+		})
+		if err != nil {
+			return fmt.Errorf("UpdateDashboard: %w", err)
+		}
+		versionNumber, err := dashboardVersionNumber(coalesce(output.VersionArn))
+		if err != nil {
+			return fmt.Errorf("UpdateDashboard: %w", err)
+		}
+		err = waitAssetStatus(ctx, func(ctx context.Context) (types.ResourceStatus, []string, error) {
+			output, err := app.client.DescribeDashboard(ctx, &quicksight.DescribeDashboardInput{
+				AwsAccountId:  awsAccountID,
+				DashboardId:   aws.String(asset.ID),
+				VersionNumber: aws.Int64(versionNumber),
+			})
+			if err != nil {
+				return "", nil, fmt.Errorf("DescribeDashboard: %w", err)
+			}
+			if output.Dashboard.Version == nil {
+				return "", nil, fmt.Errorf("DescribeDashboard: version %d not found", versionNumber)
+			}
+			messages := lo.Map(output.Dashboard.Version.Errors, func(e types.DashboardError, _ int) string {
+				return fmt.Sprintf("%s: %s", e.Type, coalesce(e.Message))
+			})
+			return output.Dashboard.Version.Status, messages, nil
+		})
+		if err != nil {
+			return fmt.Errorf("version %d: %w", versionNumber, err)
+		}
+		if _, err := app.client.UpdateDashboardPublishedVersion(ctx, &quicksight.UpdateDashboardPublishedVersionInput{
+			AwsAccountId:  awsAccountID,
+			DashboardId:   aws.String(asset.ID),
+			VersionNumber: aws.Int64(versionNumber),
+		}); err != nil {
+			return fmt.Errorf("UpdateDashboardPublishedVersion: %w", err)
+		}
+		log.Printf("[info] updated field references of dashboard %s, published version %d", asset.ID, versionNumber)
+	}
+	return nil
+}
+
+// waitAssetStatus polls the status of the analysis or the dashboard version until the creation or the update finishes,
+// and returns an error with the messages of the asset if it failed.
+func waitAssetStatus(ctx context.Context, describe func(ctx context.Context) (types.ResourceStatus, []string, error)) error {
+	ctx, cancel := context.WithTimeout(ctx, assetUpdateTimeout)
+	defer cancel()
+	ticker := time.NewTicker(assetPollingInterval)
+	defer ticker.Stop()
+	for {
+		status, messages, err := describe(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("[debug] status=%s", status)
+		switch status {
+		case types.ResourceStatusCreationSuccessful, types.ResourceStatusUpdateSuccessful:
+			return nil
+		case types.ResourceStatusCreationFailed, types.ResourceStatusUpdateFailed, types.ResourceStatusDeleted:
+			if len(messages) > 0 {
+				return fmt.Errorf("%s: %s", status, strings.Join(messages, ", "))
+			}
+			return fmt.Errorf("%s", status)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the update: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// dashboardVersionNumber returns the version number of the dashboard version ARN, arn:aws:quicksight:...:dashboard/<id>/version/<number>
+func dashboardVersionNumber(versionArn string) (int64, error) {
+	i := strings.LastIndex(versionArn, "/version/")
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected dashboard version arn `%s`", versionArn)
+	}
+	versionNumber, err := strconv.ParseInt(versionArn[i+len("/version/"):], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected dashboard version arn `%s`: %w", versionArn, err)
+	}
+	return versionNumber, nil
+}
@@ -0,0 +1,163 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestRewriteFieldReferences(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	dataSetArn := testArn("dataset/users")
+	column := func(identifier, name string) *types.ColumnIdentifier {
+		return &types.ColumnIdentifier{DataSetIdentifier: aws.String(identifier), ColumnName: aws.String(name)}
+	}
+	client.PutAnalysis(&types.Analysis{
+		Arn:        aws.String(testArn("analysis/sales")),
+		AnalysisId: aws.String("sales"),
+		Name:       aws.String("Sales"),
+		Status:     types.ResourceStatusCreationSuccessful,
+	}, &types.AnalysisDefinition{
+		DataSetIdentifierDeclarations: []types.DataSetIdentifierDeclaration{
+			{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+			{Identifier: aws.String("o"), DataSetArn: aws.String(testArn("dataset/orders"))},
+		},
+		CalculatedFields: []types.CalculatedField{
+			{DataSetIdentifier: aws.String("u"), Name: aws.String("Region"), Expression: aws.String("ifelse({pref_code} = '13', {city}, {Prefecture})")},
+			{DataSetIdentifier: aws.String("o"), Name: aws.String("Pref"), Expression: aws.String("{pref_code}")},
+		},
+		FilterGroups: []types.FilterGroup{
+			{Filters: []types.Filter{
+				{CategoryFilter: &types.CategoryFilter{FilterId: aws.String("f1"), Column: column("u", "pref_code")}},
+				{CategoryFilter: &types.CategoryFilter{FilterId: aws.String("f2"), Column: column("o", "pref_code")}},
+			}},
+		},
+	})
+	client.PutDashboard(&types.Dashboard{
+		Arn:         aws.String(testArn("dashboard/kpi")),
+		DashboardId: aws.String("kpi"),
+		Name:        aws.String("KPI"),
+	}, &types.DashboardVersionDefinition{
+		DataSetIdentifierDeclarations: []types.DataSetIdentifierDeclaration{
+			{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+		},
+		FilterGroups: []types.FilterGroup{
+			{Filters: []types.Filter{{CategoryFilter: &types.CategoryFilter{FilterId: aws.String("f1"), Column: column("u", "Prefecture")}}}},
+		},
+	})
+	client.PutDashboard(&types.Dashboard{
+		Arn:         aws.String(testArn("dashboard/other")),
+		DashboardId: aws.String("other"),
+		Name:        aws.String("Other"),
+	}, &types.DashboardVersionDefinition{
+		DataSetIdentifierDeclarations: []types.DataSetIdentifierDeclaration{
+			{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+		},
+	})
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	// pref_code and Prefecture are swapped.
+	rewrites, err := app.planFieldReferenceRewrites(ctx, dataSetArn, map[string]string{
+		"pref_code":  "Prefecture",
+		"Prefecture": "PrefectureName",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rewrites) != 2 {
+		t.Fatalf("rewrites = %d, want 2 (sales and kpi)", len(rewrites))
+	}
+	printFieldReferenceRewrites(&buf, rewrites)
+	for _, want := range []string{
+		"~ analysis sales `Sales`",
+		"  - calculated field `Region`: ifelse({pref_code} = '13', {city}, {Prefecture})",
+		"  + calculated field `Region`: ifelse({Prefecture} = '13', {city}, {PrefectureName})",
+		"  - field `pref_code` (1 reference(s))",
+		"~ dashboard kpi `KPI`",
+		"  + field `PrefectureName` (1 reference(s))",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("diff does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	if err := app.applyFieldReferenceRewrites(ctx, rewrites); err != nil {
+		t.Fatal(err)
+	}
+
+	analysis, _ := client.AnalysisDefinition(testAWSAccountID, "sales")
+	if got := *analysis.FilterGroups[0].Filters[0].CategoryFilter.Column.ColumnName; got != "Prefecture" {
+		t.Errorf("column of data set = %s, want Prefecture", got)
+	}
+	if got := *analysis.FilterGroups[0].Filters[1].CategoryFilter.Column.ColumnName; got != "pref_code" {
+		t.Errorf("column of other data set = %s, want pref_code", got)
+	}
+	if got := *analysis.CalculatedFields[1].Expression; got != "{pref_code}" {
+		t.Errorf("calculated field of other data set = %s, want {pref_code}", got)
+	}
+	dashboard, version, _ := client.DashboardDefinition(testAWSAccountID, "kpi")
+	if version != 2 {
+		t.Errorf("published version = %d, want 2", version)
+	}
+	if got := *dashboard.FilterGroups[0].Filters[0].CategoryFilter.Column.ColumnName; got != "PrefectureName" {
+		t.Errorf("column of dashboard = %s, want PrefectureName", got)
+	}
+	if _, version, _ := client.DashboardDefinition(testAWSAccountID, "other"); version != 1 {
+		t.Errorf("published version of other = %d, want 1", version)
+	}
+}
+
+func TestApplyFieldReferenceRewritesFailure(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	dataSetArn := testArn("dataset/users")
+	declarations := []types.DataSetIdentifierDeclaration{
+		{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+	}
+	calculatedFields := []types.CalculatedField{
+		{DataSetIdentifier: aws.String("u"), Name: aws.String("Pref"), Expression: aws.String("{pref_code}")},
+	}
+	client.PutAnalysis(&types.Analysis{
+		Arn:        aws.String(testArn("analysis/sales")),
+		AnalysisId: aws.String("sales"),
+		Name:       aws.String("Sales"),
+		Status:     types.ResourceStatusCreationSuccessful,
+	}, &types.AnalysisDefinition{DataSetIdentifierDeclarations: declarations, CalculatedFields: calculatedFields})
+	client.PutDashboard(&types.Dashboard{
+		Arn:         aws.String(testArn("dashboard/kpi")),
+		DashboardId: aws.String("kpi"),
+		Name:        aws.String("KPI"),
+	}, &types.DashboardVersionDefinition{DataSetIdentifierDeclarations: declarations, CalculatedFields: calculatedFields})
+	client.PutDashboard(&types.Dashboard{
+		Arn:         aws.String(testArn("dashboard/ops")),
+		DashboardId: aws.String("ops"),
+		Name:        aws.String("Ops"),
+	}, &types.DashboardVersionDefinition{DataSetIdentifierDeclarations: declarations, CalculatedFields: calculatedFields})
+	client.FailAssetUpdate(testAWSAccountID, "sales", "calculated field is invalid")
+	client.FailAssetUpdate(testAWSAccountID, "kpi", "visual is invalid")
+	app := newTestApp(t, client, io.Discard)
+	rewrites, err := app.planFieldReferenceRewrites(ctx, dataSetArn, map[string]string{"pref_code": "Prefecture"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.applyFieldReferenceRewrites(ctx, rewrites)
+	if err == nil {
+		t.Fatal("applyFieldReferenceRewrites succeeded, want error")
+	}
+	if !strings.Contains(err.Error(), "2 of 3") || !strings.Contains(err.Error(), "analysis sales") || !strings.Contains(err.Error(), "dashboard kpi") {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if _, version, _ := client.DashboardDefinition(testAWSAccountID, "kpi"); version != 1 {
+		t.Errorf("published version of kpi = %d, want 1 as the new version failed", version)
+	}
+	dashboard, version, _ := client.DashboardDefinition(testAWSAccountID, "ops")
+	if version != 2 || *dashboard.CalculatedFields[0].Expression != "{Prefecture}" {
+		t.Errorf("ops is not rewritten after the failures: version %d", version)
+	}
+}
@@ -0,0 +1,125 @@
+package redshiftdatasetannotator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// fieldTrace is the field name in the data set and the transforms applied to the field.
+type fieldTrace struct {
+	Name           string
+	Visible        bool
+	CastType       types.ColumnDataType
+	Description    string
+	GeographicRole types.GeoSpatialDataRole
+}
+
+// traceField follows the column from the transform at start of the logical table through the logical tables (and the joins of them),
+// applying the renames, and collects the casts and tags of the column.
+func traceField(dataSet *types.DataSet, logicalTableID string, start int, columnName string) *fieldTrace {
+	trace := &fieldTrace{
+		Name:    columnName,
+		Visible: true,
+	}
+	for ok := true; ok; start = 0 {
+		logicalTable := dataSet.LogicalTableMap[logicalTableID]
+		for i, transform := range logicalTable.DataTransforms {
+			if i < start {
+				continue
+			}
+			switch op := transform.(type) {
+			case *types.TransformOperationMemberRenameColumnOperation:
+				if coalesce(op.Value.ColumnName) == trace.Name {
+					trace.Name = coalesce(op.Value.NewColumnName)
+				}
+			case *types.TransformOperationMemberCastColumnTypeOperation:
+				if coalesce(op.Value.ColumnName) == trace.Name {
+					trace.CastType = op.Value.NewColumnType
+				}
+			case *types.TransformOperationMemberTagColumnOperation:
+				if coalesce(op.Value.ColumnName) != trace.Name {
+					continue
+				}
+				for _, tag := range op.Value.Tags {
+					if tag.ColumnDescription != nil {
+						trace.Description = strings.TrimSpace(coalesce(tag.ColumnDescription.Text))
+					}
+					if tag.ColumnGeographicRole != "" {
+						trace.GeographicRole = tag.ColumnGeographicRole
+					}
+				}
+			case *types.TransformOperationMemberProjectOperation:
+				if !lo.Contains(op.Value.ProjectedColumns, trace.Name) {
+					trace.Visible = false
+				}
+			}
+		}
+		childID := logicalTableID
+		logicalTableID, ok = lo.FindKeyBy(dataSet.LogicalTableMap, func(_ string, logicalTable types.LogicalTable) bool {
+			if logicalTable.Source == nil || logicalTable.Source.JoinInstruction == nil {
+				return false
+			}
+			join := logicalTable.Source.JoinInstruction
+			return coalesce(join.LeftOperand) == childID || coalesce(join.RightOperand) == childID
+		})
+	}
+	return trace
+}
+
+// sourceField is a field of the data set read from an input column of a physical table.
+// Table is nil for the columns of custom SQL.
+type sourceField struct {
+	PhysicalTableID string
+	Table           *types.RelationalTable
+	Column          string
+	Trace           *fieldTrace
+}
+
+// Source returns the column of Redshift, schema.table.column. It is empty for the columns of custom SQL.
+func (field *sourceField) Source() string {
+	if field.Table == nil {
+		return ""
+	}
+	return coalesce(field.Table.Schema) + "." + coalesce(field.Table.Name) + "." + field.Column
+}
+
+// sourceFields returns the fields read from the input columns of the relational tables and custom SQL,
+// ordered by the physical table ID and the input columns.
+func sourceFields(dataSet *types.DataSet) []*sourceField {
+	var fields []*sourceField
+	physicalTableIDs := lo.Keys(dataSet.PhysicalTableMap)
+	sort.Strings(physicalTableIDs)
+	for _, physicalTableID := range physicalTableIDs {
+		logicalTableID, ok := lo.FindKeyBy(dataSet.LogicalTableMap, func(_ string, logicalTable types.LogicalTable) bool {
+			return logicalTable.Source != nil && coalesce(logicalTable.Source.PhysicalTableId) == physicalTableID
+		})
+		if !ok {
+			continue
+		}
+		var table *types.RelationalTable
+		var columns []string
+		switch physicalTable := dataSet.PhysicalTableMap[physicalTableID].(type) {
+		case *types.PhysicalTableMemberRelationalTable:
+			table = &physicalTable.Value
+			columns = lo.Map(physicalTable.Value.InputColumns, func(column types.InputColumn, _ int) string {
+				return coalesce(column.Name)
+			})
+		case *types.PhysicalTableMemberCustomSql:
+			columns = lo.Map(physicalTable.Value.Columns, func(column types.InputColumn, _ int) string {
+				return coalesce(column.Name)
+			})
+		}
+		for _, column := range columns {
+			fields = append(fields, &sourceField{
+				PhysicalTableID: physicalTableID,
+				Table:           table,
+				Column:          column,
+				Trace:           traceField(dataSet, logicalTableID, 0, column),
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,82 @@
+package redshiftdatasetannotator
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+type geographicRolePattern struct {
+	Pattern string
+	Role    types.GeoSpatialDataRole
+}
+
+// defaultGeographicRolePatterns are used with `--infer-geographic-role`.
+var defaultGeographicRolePatterns = []geographicRolePattern{
+	{Pattern: "country", Role: types.GeoSpatialDataRoleCountry},
+	{Pattern: "*_country", Role: types.GeoSpatialDataRoleCountry},
+	{Pattern: "state", Role: types.GeoSpatialDataRoleState},
+	{Pattern: "*_state", Role: types.GeoSpatialDataRoleState},
+	{Pattern: "prefecture", Role: types.GeoSpatialDataRoleState},
+	{Pattern: "*_prefecture", Role: types.GeoSpatialDataRoleState},
+	{Pattern: "county", Role: types.GeoSpatialDataRoleCounty},
+	{Pattern: "*_county", Role: types.GeoSpatialDataRoleCounty},
+	{Pattern: "city", Role: types.GeoSpatialDataRoleCity},
+	{Pattern: "*_city", Role: types.GeoSpatialDataRoleCity},
+	{Pattern: "postcode", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "*_postcode", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "zipcode", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "*_zipcode", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "*_zip", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "postal_code", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "*_postal_code", Role: types.GeoSpatialDataRolePostcode},
+	{Pattern: "lat", Role: types.GeoSpatialDataRoleLatitude},
+	{Pattern: "*_lat", Role: types.GeoSpatialDataRoleLatitude},
+	{Pattern: "latitude", Role: types.GeoSpatialDataRoleLatitude},
+	{Pattern: "*_latitude", Role: types.GeoSpatialDataRoleLatitude},
+	{Pattern: "lng", Role: types.GeoSpatialDataRoleLongitude},
+	{Pattern: "*_lng", Role: types.GeoSpatialDataRoleLongitude},
+	{Pattern: "lon", Role: types.GeoSpatialDataRoleLongitude},
+	{Pattern: "*_lon", Role: types.GeoSpatialDataRoleLongitude},
+	{Pattern: "longitude", Role: types.GeoSpatialDataRoleLongitude},
+	{Pattern: "*_longitude", Role: types.GeoSpatialDataRoleLongitude},
+}
+
+type geographicRoleMatcher []geographicRolePattern
+
+func newGeographicRoleMatcher(inferDefault bool, patterns map[string]string) (geographicRoleMatcher, error) {
+	keys := make([]string, 0, len(patterns))
+	for pattern := range patterns {
+		keys = append(keys, pattern)
+	}
+	sort.Strings(keys)
+	matcher := make(geographicRoleMatcher, 0, len(patterns)+len(defaultGeographicRolePatterns))
+	for _, pattern := range keys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("geographic role pattern `%s`: %w", pattern, err)
+		}
+		role, err := parseGeographicRole(patterns[pattern])
+		if err != nil {
+			return nil, fmt.Errorf("geographic role pattern `%s`: %w", pattern, err)
+		}
+		matcher = append(matcher, geographicRolePattern{Pattern: strings.ToLower(pattern), Role: role})
+	}
+	if inferDefault {
+		matcher = append(matcher, defaultGeographicRolePatterns...)
+	}
+	return matcher, nil
+}
+
+// Match returns the geographic role of the first pattern matching columnName.
+func (matcher geographicRoleMatcher) Match(columnName string) (types.GeoSpatialDataRole, bool) {
+	name := strings.ToLower(columnName)
+	for _, p := range matcher {
+		if ok, _ := path.Match(p.Pattern, name); ok {
+			return p.Role, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,90 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+const testAWSAccountID = "123456789012"
+
+func testArn(resource string) string {
+	return "arn:aws:quicksight:ap-northeast-1:" + testAWSAccountID + ":" + resource
+}
+
+// testDataSource returns a Redshift data source with a provisioned cluster endpoint.
+func testDataSource(dataSourceID string) *types.DataSource {
+	return &types.DataSource{
+		Arn:          aws.String(testArn("datasource/" + dataSourceID)),
+		DataSourceId: aws.String(dataSourceID),
+		Name:         aws.String(dataSourceID),
+		Type:         types.DataSourceTypeRedshift,
+		DataSourceParameters: &types.DataSourceParametersMemberRedshiftParameters{
+			Value: types.RedshiftParameters{
+				Host:     aws.String("example.abc123xyz789.ap-northeast-1.redshift.amazonaws.com"),
+				Port:     5439,
+				Database: aws.String("dev"),
+			},
+		},
+	}
+}
+
+// testDataSet returns a direct query data set reading public.users (id, pref_code) of the warehouse data source,
+// with the logical table `logical` applying transforms.
+func testDataSet(dataSetID string, transforms ...types.TransformOperation) *types.DataSet {
+	return &types.DataSet{
+		Arn:        aws.String(testArn("dataset/" + dataSetID)),
+		DataSetId:  aws.String(dataSetID),
+		Name:       aws.String(dataSetID),
+		ImportMode: types.DataSetImportModeDirectQuery,
+		PhysicalTableMap: map[string]types.PhysicalTable{
+			"physical": &types.PhysicalTableMemberRelationalTable{
+				Value: types.RelationalTable{
+					DataSourceArn: aws.String(testArn("datasource/warehouse")),
+					Schema:        aws.String("public"),
+					Name:          aws.String("users"),
+					InputColumns: []types.InputColumn{
+						{Name: aws.String("id"), Type: types.InputColumnDataTypeString},
+						{Name: aws.String("pref_code"), Type: types.InputColumnDataTypeString},
+					},
+				},
+			},
+		},
+		LogicalTableMap: map[string]types.LogicalTable{
+			"logical": {
+				Alias:          aws.String("users"),
+				Source:         &types.LogicalTableSource{PhysicalTableId: aws.String("physical")},
+				DataTransforms: transforms,
+			},
+		},
+	}
+}
+
+// testRelationalTable returns the relational table of testDataSet to override.
+func testRelationalTable(dataSet *types.DataSet) *types.RelationalTable {
+	return &dataSet.PhysicalTableMap["physical"].(*types.PhysicalTableMemberRelationalTable).Value
+}
+
+func testRename(columnName, newColumnName string) types.TransformOperation {
+	return &types.TransformOperationMemberRenameColumnOperation{
+		Value: types.RenameColumnOperation{ColumnName: aws.String(columnName), NewColumnName: aws.String(newColumnName)},
+	}
+}
+
+// newTestApp returns the App with the fake client and the empty configuration.
+func newTestApp(t *testing.T, client *quicksighttest.Client, w io.Writer) *App {
+	t.Helper()
+	app, err := New(context.Background(), testAWSAccountID,
+		WithQuickSightClient(client),
+		WithConfig(newConfig()),
+		WithWriter(w),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
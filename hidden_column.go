@@ -0,0 +1,127 @@
+package redshiftdatasetannotator
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// matchHiddenColumn reports whether columnName matches any of the glob patterns.
+func matchHiddenColumn(patterns []string, columnName string) bool {
+	name := strings.ToLower(columnName)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func referencesColumn(expression string, columnName string) bool {
+	return strings.Contains(expression, "{"+columnName+"}")
+}
+
+// checkHiddenColumnDependencies returns an error if the hidden column is used by
+// column level permission rules, column groups, row-level security tag rules, calculated fields or filters.
+func checkHiddenColumnDependencies(input columnDependencies, columnName string) error {
+	if dependencies := input.usedBy(columnName); len(dependencies) > 0 {
+		return fmt.Errorf("can not hide column `%s`, it is used by %s", columnName, strings.Join(dependencies, ", "))
+	}
+	return nil
+}
+
+// usedBy returns the column level permission rules, column groups, row-level security tag rules,
+// calculated fields and filters that use the column.
+func (input columnDependencies) usedBy(columnName string) []string {
+	dependencies := make([]string, 0)
+	for i, rule := range input.ColumnLevelPermissionRules {
+		if lo.Contains(rule.ColumnNames, columnName) {
+			dependencies = append(dependencies, fmt.Sprintf("ColumnLevelPermissionRules[%d]", i))
+		}
+	}
+	for _, group := range input.ColumnGroups {
+		if group.GeoSpatialColumnGroup != nil && lo.Contains(group.GeoSpatialColumnGroup.Columns, columnName) {
+			dependencies = append(dependencies, fmt.Sprintf("geospatial column group `%s`", coalesce(group.GeoSpatialColumnGroup.Name)))
+		}
+	}
+	if input.RowLevelPermissionTagConfiguration != nil {
+		for _, rule := range input.RowLevelPermissionTagConfiguration.TagRules {
+			if coalesce(rule.ColumnName) == columnName {
+				dependencies = append(dependencies, fmt.Sprintf("row-level security tag rule `%s`", coalesce(rule.TagKey)))
+			}
+		}
+	}
+	for _, op := range input.CreateColumnsOperations {
+		for _, column := range op.Value.Columns {
+			if referencesColumn(coalesce(column.Expression), columnName) {
+				dependencies = append(dependencies, fmt.Sprintf("calculated field `%s`", coalesce(column.ColumnName)))
+			}
+		}
+	}
+	for _, op := range input.FilterOperations {
+		if referencesColumn(coalesce(op.Value.ConditionExpression), columnName) {
+			dependencies = append(dependencies, fmt.Sprintf("filter `%s`", coalesce(op.Value.ConditionExpression)))
+		}
+	}
+	return dependencies
+}
+
+type columnDependencies struct {
+	ColumnLevelPermissionRules         []types.ColumnLevelPermissionRule
+	ColumnGroups                       []types.ColumnGroup
+	RowLevelPermissionTagConfiguration *types.RowLevelPermissionTagConfiguration
+	CreateColumnsOperations            []*types.TransformOperationMemberCreateColumnsOperation
+	FilterOperations                   []*types.TransformOperationMemberFilterOperation
+}
+
+// hideColumns removes the hidden columns from the project operations.
+// If there is no project operation, a new one that projects every column except the hidden columns is added.
+// Reports whether the project operations have been changed.
+func hideColumns(projectOperations []*types.TransformOperationMemberProjectOperation, columnNames []string, hiddenColumnNames []string) ([]*types.TransformOperationMemberProjectOperation, bool) {
+	if len(hiddenColumnNames) == 0 {
+		return projectOperations, false
+	}
+	if len(projectOperations) == 0 {
+		projectOperations = append(projectOperations, &types.TransformOperationMemberProjectOperation{
+			Value: types.ProjectOperation{
+				ProjectedColumns: lo.Without(columnNames, hiddenColumnNames...),
+			},
+		})
+		log.Printf("[debug] new project operation without columns %v", hiddenColumnNames)
+		return projectOperations, true
+	}
+	var changed bool
+	for i, op := range projectOperations {
+		projected := lo.Without(op.Value.ProjectedColumns, hiddenColumnNames...)
+		if len(projected) == len(op.Value.ProjectedColumns) {
+			continue
+		}
+		projectOperations[i] = &types.TransformOperationMemberProjectOperation{
+			Value: types.ProjectOperation{
+				ProjectedColumns: projected,
+			},
+		}
+		log.Printf("[debug] remove columns %v from project operation[%d]", lo.Intersect(op.Value.ProjectedColumns, hiddenColumnNames), i)
+		changed = true
+	}
+	return projectOperations, changed
+}
+
+// removeFieldFolderColumns removes the column from field folders.
+func removeFieldFolderColumns(fieldFolders map[string]types.FieldFolder, columnName string) bool {
+	var changed bool
+	for folderPath, folder := range fieldFolders {
+		if !lo.Contains(folder.Columns, columnName) {
+			continue
+		}
+		folder.Columns = lo.Without(folder.Columns, columnName)
+		fieldFolders[folderPath] = folder
+		log.Printf("[debug] remove column `%s` from field folder `%s`", columnName, folderPath)
+		changed = true
+	}
+	return changed
+}
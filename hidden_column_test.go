@@ -0,0 +1,98 @@
+package redshiftdatasetannotator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+func TestCheckHiddenColumnDependencies(t *testing.T) {
+	cases := []struct {
+		name  string
+		input columnDependencies
+		want  string
+	}{
+		{
+			name: "calculated field",
+			input: columnDependencies{
+				CreateColumnsOperations: []*types.TransformOperationMemberCreateColumnsOperation{
+					{Value: types.CreateColumnsOperation{Columns: []types.CalculatedColumn{
+						{ColumnId: aws.String("c1"), ColumnName: aws.String("Region"), Expression: aws.String("ifelse({pref_code} = '13', 'Kanto', 'Other')")},
+					}}},
+				},
+			},
+			want: "calculated field `Region`",
+		},
+		{
+			name: "row-level security tag rule",
+			input: columnDependencies{
+				RowLevelPermissionTagConfiguration: &types.RowLevelPermissionTagConfiguration{
+					TagRules: []types.RowLevelPermissionTagRule{
+						{ColumnName: aws.String("pref_code"), TagKey: aws.String("prefecture")},
+					},
+				},
+			},
+			want: "row-level security tag rule `prefecture`",
+		},
+		{
+			name: "column group",
+			input: columnDependencies{
+				ColumnGroups: []types.ColumnGroup{
+					{GeoSpatialColumnGroup: &types.GeoSpatialColumnGroup{Name: aws.String("region"), Columns: []string{"pref_code", "city"}}},
+				},
+			},
+			want: "geospatial column group `region`",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkHiddenColumnDependencies(c.input, "pref_code")
+			if err == nil {
+				t.Fatal("hiding the column succeeded, want error")
+			}
+			if !strings.Contains(err.Error(), c.want) {
+				t.Errorf("error = %q, want to contain %q", err, c.want)
+			}
+			if err := checkHiddenColumnDependencies(c.input, "id"); err != nil {
+				t.Errorf("hiding the column not used: %s", err)
+			}
+		})
+	}
+}
+
+func TestHideColumns(t *testing.T) {
+	// without a project operation, every column except the hidden columns is projected
+	projectOperations, changed := hideColumns(nil, []string{"id", "pref_code", "dw_hash"}, []string{"dw_hash"})
+	if !changed {
+		t.Fatal("project operations are not changed")
+	}
+	if len(projectOperations) != 1 {
+		t.Fatalf("project operations = %d, want 1", len(projectOperations))
+	}
+	if want := []string{"id", "pref_code"}; !reflect.DeepEqual(projectOperations[0].Value.ProjectedColumns, want) {
+		t.Errorf("projected columns = %v, want %v", projectOperations[0].Value.ProjectedColumns, want)
+	}
+
+	// the hidden columns are projected away from the existing project operation
+	existing := &types.TransformOperationMemberProjectOperation{
+		Value: types.ProjectOperation{ProjectedColumns: []string{"id", "pref_code", "dw_hash", "Region"}},
+	}
+	projectOperations, changed = hideColumns([]*types.TransformOperationMemberProjectOperation{existing}, nil, []string{"dw_hash", "pref_code"})
+	if !changed {
+		t.Fatal("project operations are not changed")
+	}
+	if want := []string{"id", "Region"}; !reflect.DeepEqual(projectOperations[0].Value.ProjectedColumns, want) {
+		t.Errorf("projected columns = %v, want %v", projectOperations[0].Value.ProjectedColumns, want)
+	}
+	if want := []string{"id", "pref_code", "dw_hash", "Region"}; !reflect.DeepEqual(existing.Value.ProjectedColumns, want) {
+		t.Errorf("the original project operation is modified: %v", existing.Value.ProjectedColumns)
+	}
+
+	// hiding the columns already projected away changes nothing
+	if _, changed := hideColumns(projectOperations, nil, []string{"dw_hash"}); changed {
+		t.Error("project operations are changed, want unchanged")
+	}
+}
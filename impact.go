@@ -0,0 +1,201 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+type ImpactOption struct {
+	Column       string `arg:"" help:"column of Redshift, schema.table.column"`
+	DataSourceID string `help:"only data sets using the data source"`
+	Output       string `help:"output format" enum:"table,json" default:"table"`
+}
+
+// ColumnImpact is the data sets, analyses and dashboards using a column of Redshift.
+type ColumnImpact struct {
+	Schema   string           `json:"schema"`
+	Table    string           `json:"table"`
+	Column   string           `json:"column"`
+	DataSets []*DataSetImpact `json:"data_sets"`
+}
+
+// DataSetImpact is a data set reading the column, and the analyses and dashboards built on it.
+type DataSetImpact struct {
+	DataSetID       string         `json:"data_set_id"`
+	Name            string         `json:"name"`
+	Arn             string         `json:"arn"`
+	DataSourceID    string         `json:"data_source_id"`
+	PhysicalTableID string         `json:"physical_table_id"`
+	FieldName       string         `json:"field_name"`
+	Hidden          bool           `json:"hidden,omitempty"`
+	Analyses        []*AssetImpact `json:"analyses"`
+	Dashboards      []*AssetImpact `json:"dashboards"`
+}
+
+// AssetImpact is an analysis or a dashboard using the data set.
+// References is the number of the field references and the calculated fields using the field.
+type AssetImpact struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Arn        string `json:"arn"`
+	References int    `json:"references"`
+}
+
+func (app *App) RunImpact(ctx context.Context, opt *ImpactOption) error {
+	parts := strings.Split(opt.Column, ".")
+	if len(parts) != 3 || lo.Contains(parts, "") {
+		return fmt.Errorf("column `%s` is not schema.table.column", opt.Column)
+	}
+	impact, err := app.AnalyzeColumnImpact(ctx, opt.DataSourceID, parts[0], parts[1], parts[2])
+	if err != nil {
+		return err
+	}
+	if opt.Output == "json" {
+		bs, err := json.MarshalIndent(impact, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(app.w, string(bs))
+		return nil
+	}
+	tw := tabwriter.NewWriter(app.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tID\tNAME\tDATA SET\tFIELD\tREFERENCES")
+	for _, dataSet := range impact.DataSets {
+		field := dataSet.FieldName
+		if dataSet.Hidden {
+			field += " (hidden)"
+		}
+		fmt.Fprintf(tw, "data set\t%s\t%s\t%s\t%s\t-\n", dataSet.DataSetID, dataSet.Name, dataSet.DataSetID, field)
+		for _, analysis := range dataSet.Analyses {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", assetKindAnalysis, analysis.ID, analysis.Name, dataSet.DataSetID, field, analysis.References)
+		}
+		for _, dashboard := range dataSet.Dashboards {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\n", assetKindDashboard, dashboard.ID, dashboard.Name, dataSet.DataSetID, field, dashboard.References)
+		}
+	}
+	return tw.Flush()
+}
+
+// AnalyzeColumnImpact finds the data sets reading the column through the input columns of relational tables,
+// the field name of the column in each data set, and the analyses and dashboards using the data sets.
+func (app *App) AnalyzeColumnImpact(ctx context.Context, dataSourceID string, schema string, table string, column string) (*ColumnImpact, error) {
+	awsAccountID := app.AWSAccountID()
+	impact := &ColumnImpact{
+		Schema:   schema,
+		Table:    table,
+		Column:   column,
+		DataSets: make([]*DataSetImpact, 0),
+	}
+	var failed []string
+	paginator := quicksight.NewListDataSetsPaginator(app.client, &quicksight.ListDataSetsInput{
+		AwsAccountId: aws.String(awsAccountID),
+	})
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ListDataSets: %w", err)
+		}
+		for _, summary := range output.DataSetSummaries {
+			described, err := app.describeDataSet(ctx, aws.String(awsAccountID), coalesce(summary.DataSetId))
+			if err != nil {
+				if isNotDescribableDataSet(err) {
+					log.Printf("[debug] skip data set %s: %s", coalesce(summary.DataSetId), err)
+					continue
+				}
+				log.Printf("[error] data set %s: %s", coalesce(summary.DataSetId), err)
+				failed = append(failed, coalesce(summary.DataSetId))
+				continue
+			}
+			impact.DataSets = append(impact.DataSets, dataSetImpacts(described.DataSet, dataSourceID, schema, table, column)...)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("failed to describe %d data set(s), the impact would be incomplete: %s", len(failed), strings.Join(failed, ", "))
+	}
+	if len(impact.DataSets) == 0 {
+		return impact, nil
+	}
+	assets, err := app.listAssetDefinitions(ctx, awsAccountID, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, dataSet := range impact.DataSets {
+		dataSet.Analyses = make([]*AssetImpact, 0)
+		dataSet.Dashboards = make([]*AssetImpact, 0)
+		for _, asset := range assets {
+			if len(asset.dataSetIdentifiers(dataSet.Arn)) == 0 {
+				continue
+			}
+			columns, calculatedFields := asset.fieldReferences(dataSet.Arn, dataSet.FieldName)
+			assetImpact := &AssetImpact{
+				ID:         asset.ID,
+				Name:       asset.Name,
+				Arn:        asset.Arn,
+				References: len(columns) + len(calculatedFields),
+			}
+			if asset.Kind == assetKindAnalysis {
+				dataSet.Analyses = append(dataSet.Analyses, assetImpact)
+			} else {
+				dataSet.Dashboards = append(dataSet.Dashboards, assetImpact)
+			}
+		}
+	}
+	return impact, nil
+}
+
+// dataSetImpacts returns the impacts of the physical tables of the data set having the column in the input columns.
+func dataSetImpacts(dataSet *types.DataSet, dataSourceID string, schema string, table string, column string) []*DataSetImpact {
+	var impacts []*DataSetImpact
+	for physicalTableID, physicalTable := range dataSet.PhysicalTableMap {
+		relationalTable, ok := physicalTable.(*types.PhysicalTableMemberRelationalTable)
+		if !ok {
+			continue
+		}
+		tableDataSourceID := dataSourceIDOf(coalesce(relationalTable.Value.DataSourceArn))
+		if dataSourceID != "" && tableDataSourceID != dataSourceID {
+			continue
+		}
+		if !strings.EqualFold(coalesce(relationalTable.Value.Schema), schema) || !strings.EqualFold(coalesce(relationalTable.Value.Name), table) {
+			continue
+		}
+		inputColumn, ok := lo.Find(relationalTable.Value.InputColumns, func(c types.InputColumn) bool {
+			return strings.EqualFold(coalesce(c.Name), column)
+		})
+		if !ok {
+			continue
+		}
+		fieldName, visible := outputColumnName(dataSet, physicalTableID, coalesce(inputColumn.Name))
+		impacts = append(impacts, &DataSetImpact{
+			DataSetID:       coalesce(dataSet.DataSetId),
+			Name:            coalesce(dataSet.Name),
+			Arn:             coalesce(dataSet.Arn),
+			DataSourceID:    tableDataSourceID,
+			PhysicalTableID: physicalTableID,
+			FieldName:       fieldName,
+			Hidden:          !visible,
+		})
+	}
+	return impacts
+}
+
+// outputColumnName follows the column of the physical table through the logical tables (and the joins of them),
+// and returns the field name in the data set. visible is false if the column is removed by a ProjectOperation.
+func outputColumnName(dataSet *types.DataSet, physicalTableID string, columnName string) (string, bool) {
+	logicalTableID, ok := lo.FindKeyBy(dataSet.LogicalTableMap, func(_ string, logicalTable types.LogicalTable) bool {
+		return logicalTable.Source != nil && coalesce(logicalTable.Source.PhysicalTableId) == physicalTableID
+	})
+	if !ok {
+		return columnName, true
+	}
+	trace := traceField(dataSet, logicalTableID, 0, columnName)
+	return trace.Name, trace.Visible
+}
@@ -0,0 +1,101 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestAnalyzeColumnImpact(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	dataSetArn := testArn("dataset/users")
+	client.PutDataSet(testDataSet("users", testRename("pref_code", "Prefecture")))
+	column := func() *types.ColumnIdentifier {
+		return &types.ColumnIdentifier{DataSetIdentifier: aws.String("u"), ColumnName: aws.String("Prefecture")}
+	}
+	client.PutAnalysis(&types.Analysis{
+		Arn:        aws.String(testArn("analysis/sales")),
+		AnalysisId: aws.String("sales"),
+		Name:       aws.String("Sales"),
+		Status:     types.ResourceStatusCreationSuccessful,
+	}, &types.AnalysisDefinition{
+		DataSetIdentifierDeclarations: []types.DataSetIdentifierDeclaration{
+			{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+		},
+		CalculatedFields: []types.CalculatedField{
+			{DataSetIdentifier: aws.String("u"), Name: aws.String("Region"), Expression: aws.String("ifelse({Prefecture} = '13', 'Kanto', 'Other')")},
+		},
+		FilterGroups: []types.FilterGroup{
+			{Filters: []types.Filter{{CategoryFilter: &types.CategoryFilter{FilterId: aws.String("f1"), Column: column()}}}},
+		},
+	})
+	client.PutDashboard(&types.Dashboard{
+		Arn:         aws.String(testArn("dashboard/kpi")),
+		DashboardId: aws.String("kpi"),
+		Name:        aws.String("KPI"),
+	}, &types.DashboardVersionDefinition{
+		DataSetIdentifierDeclarations: []types.DataSetIdentifierDeclaration{
+			{Identifier: aws.String("u"), DataSetArn: aws.String(dataSetArn)},
+		},
+	})
+	var buf bytes.Buffer
+	app := newTestApp(t, client, &buf)
+	impact, err := app.AnalyzeColumnImpact(ctx, "", "public", "users", "pref_code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(impact.DataSets) != 1 {
+		t.Fatalf("data sets = %d, want 1", len(impact.DataSets))
+	}
+	dataSet := impact.DataSets[0]
+	if dataSet.FieldName != "Prefecture" || dataSet.Hidden {
+		t.Errorf("field = %q hidden=%v, want Prefecture", dataSet.FieldName, dataSet.Hidden)
+	}
+	if len(dataSet.Analyses) != 1 || dataSet.Analyses[0].References != 2 {
+		t.Errorf("analyses = %+v, want sales with 2 references", dataSet.Analyses)
+	}
+	if len(dataSet.Dashboards) != 1 || dataSet.Dashboards[0].References != 0 {
+		t.Errorf("dashboards = %+v, want kpi with 0 references", dataSet.Dashboards)
+	}
+
+	if err := app.RunImpact(ctx, &ImpactOption{Column: "public.users.pref_code", Output: "table"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "analysis") || !strings.Contains(buf.String(), "Prefecture") {
+		t.Errorf("unexpected table output:\n%s", buf.String())
+	}
+	if err := app.RunImpact(ctx, &ImpactOption{Column: "users.pref_code"}); err == nil {
+		t.Error("RunImpact with table.column succeeded, want error")
+	}
+}
+
+func TestAnalyzeColumnImpactDescribeError(t *testing.T) {
+	client := quicksighttest.NewClient()
+	client.PutDataSet(testDataSet("users"))
+	client.PutDataSet(testDataSet("uploaded"))
+	client.FailDescribeDataSet(testAWSAccountID, "uploaded", &types.InvalidParameterValueException{
+		Message: aws.String("The data set type is not supported through API yet"),
+	})
+	app := newTestApp(t, client, io.Discard)
+	impact, err := app.AnalyzeColumnImpact(context.Background(), "", "public", "users", "pref_code")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(impact.DataSets) != 1 {
+		t.Errorf("data sets = %d, want 1", len(impact.DataSets))
+	}
+
+	client.FailDescribeDataSet(testAWSAccountID, "users", &types.AccessDeniedException{
+		Message: aws.String("not authorized"),
+	})
+	if _, err := app.AnalyzeColumnImpact(context.Background(), "", "public", "users", "pref_code"); err == nil {
+		t.Error("AnalyzeColumnImpact with AccessDenied succeeded, want error")
+	}
+}
@@ -0,0 +1,140 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+type IngestionOption struct {
+	WaitIngestion    bool          `help:"Wait for the SPICE ingestion triggered by the update, and report the result"`
+	IngestionTimeout time.Duration `help:"Timeout of waiting for the SPICE ingestion" default:"1h"`
+	SpiceRefresh     string        `help:"SPICE refresh triggered by the update. allow: keep the ingestion, cancel: cancel the ingestion if only metadata changed, deny: update SPICE data sets only if only metadata changed, and cancel the ingestion" enum:"allow,cancel,deny" default:"allow"`
+}
+
+var ingestionPollingInterval = 10 * time.Second
+
+// dataFingerprint returns a hash of the fields that affect SPICE data.
+// Metadata such as tags, field folders, column groups and permissions are excluded,
+// and the order of the transform operations is ignored because annotate rebuilds them.
+func dataFingerprint(input *quicksight.UpdateDataSetInput) (string, error) {
+	dataSet := &types.DataSet{
+		ImportMode:       input.ImportMode,
+		PhysicalTableMap: input.PhysicalTableMap,
+	}
+	transforms := make(map[string][]string, len(input.LogicalTableMap))
+	if input.LogicalTableMap != nil {
+		dataSet.LogicalTableMap = make(map[string]types.LogicalTable, len(input.LogicalTableMap))
+		for id, table := range input.LogicalTableMap {
+			ops := make([]string, 0, len(table.DataTransforms))
+			for _, op := range table.DataTransforms {
+				switch op.(type) {
+				case *types.TransformOperationMemberTagColumnOperation, *types.TransformOperationMemberUntagColumnOperation:
+					continue
+				}
+				bs, err := json.Marshal(jsonTransformOperation{TransformOperation: op})
+				if err != nil {
+					return "", fmt.Errorf("failed to marshal transform operation: %w", err)
+				}
+				ops = append(ops, string(bs))
+			}
+			sort.Strings(ops)
+			transforms[id] = ops
+			table.DataTransforms = nil
+			dataSet.LogicalTableMap[id] = table
+		}
+	}
+	bs, err := MarshalDataSetJSON(dataSet)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal data set: %w", err)
+	}
+	h := sha256.New()
+	h.Write(bs)
+	if err := json.NewEncoder(h).Encode(transforms); err != nil {
+		return "", fmt.Errorf("failed to marshal transform operations: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// checkSpiceRefresh returns an error if the update is denied by --spice-refresh.
+func checkSpiceRefresh(opt IngestionOption, input *quicksight.UpdateDataSetInput, metadataOnly bool) error {
+	if input.ImportMode != types.DataSetImportModeSpice || opt.SpiceRefresh != "deny" || metadataOnly {
+		return nil
+	}
+	return fmt.Errorf("data set %s is SPICE and the update changes data, that triggers a SPICE refresh. denied by --spice-refresh=deny", coalesce(input.DataSetId))
+}
+
+// handleIngestion cancels or waits for the SPICE ingestion triggered by UpdateDataSet.
+func (app *App) handleIngestion(ctx context.Context, opt IngestionOption, input *quicksight.UpdateDataSetInput, output *quicksight.UpdateDataSetOutput, metadataOnly bool) error {
+	if output.IngestionId == nil {
+		return nil
+	}
+	if metadataOnly && (opt.SpiceRefresh == "cancel" || opt.SpiceRefresh == "deny") {
+		_, err := app.client.CancelIngestion(ctx, &quicksight.CancelIngestionInput{
+			AwsAccountId: input.AwsAccountId,
+			DataSetId:    input.DataSetId,
+			IngestionId:  output.IngestionId,
+		})
+		if err != nil {
+			return fmt.Errorf("CancelIngestion: %w", err)
+		}
+		log.Printf("[info] cancelled ingestion `%s`, only metadata changed", *output.IngestionId)
+		return nil
+	}
+	if !opt.WaitIngestion {
+		return nil
+	}
+	return app.waitIngestion(ctx, opt, input.AwsAccountId, input.DataSetId, output.IngestionId)
+}
+
+func (app *App) waitIngestion(ctx context.Context, opt IngestionOption, awsAccountID, dataSetID, ingestionID *string) error {
+	ctx, cancel := context.WithTimeout(ctx, opt.IngestionTimeout)
+	defer cancel()
+	log.Printf("[info] waiting for ingestion `%s`", *ingestionID)
+	ticker := time.NewTicker(ingestionPollingInterval)
+	defer ticker.Stop()
+	for {
+		output, err := app.client.DescribeIngestion(ctx, &quicksight.DescribeIngestionInput{
+			AwsAccountId: awsAccountID,
+			DataSetId:    dataSetID,
+			IngestionId:  ingestionID,
+		})
+		if err != nil {
+			return fmt.Errorf("DescribeIngestion: %w", err)
+		}
+		ingestion := output.Ingestion
+		log.Printf("[debug] ingestion `%s` status=%s", *ingestionID, ingestion.IngestionStatus)
+		switch ingestion.IngestionStatus {
+		case types.IngestionStatusCompleted:
+			var ingested, dropped int64
+			if ingestion.RowInfo != nil {
+				ingested = coalesce(ingestion.RowInfo.RowsIngested)
+				dropped = coalesce(ingestion.RowInfo.RowsDropped)
+			}
+			log.Printf("[info] ingestion `%s` completed in %ds, rows ingested=%d dropped=%d",
+				*ingestionID, coalesce(ingestion.IngestionTimeInSeconds), ingested, dropped)
+			return nil
+		case types.IngestionStatusFailed:
+			if ingestion.ErrorInfo != nil {
+				return fmt.Errorf("ingestion `%s` failed: %s: %s", *ingestionID, ingestion.ErrorInfo.Type, aws.ToString(ingestion.ErrorInfo.Message))
+			}
+			return fmt.Errorf("ingestion `%s` failed", *ingestionID)
+		case types.IngestionStatusCancelled:
+			return fmt.Errorf("ingestion `%s` cancelled", *ingestionID)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for ingestion `%s`: %w", *ingestionID, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
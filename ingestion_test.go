@@ -0,0 +1,116 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+var (
+	// describePrefCode only changes metadata of the data set.
+	describePrefCode = &DataSetExport{
+		DataSetID: "users",
+		Fields: []*FieldExport{
+			{Name: "pref_code", Source: "public.users.pref_code", Description: "Prefecture code"},
+		},
+	}
+	// renamePrefCode changes data of the data set.
+	renamePrefCode = &DataSetExport{
+		DataSetID: "users",
+		Fields: []*FieldExport{
+			{Name: "Prefecture", Source: "public.users.pref_code"},
+		},
+	}
+)
+
+// runTestIngestion annotates the SPICE data set users with export, where the ingestions end with status.
+func runTestIngestion(t *testing.T, status types.IngestionStatus, export *DataSetExport, opt IngestionOption) (*quicksighttest.Client, error) {
+	t.Helper()
+	client := quicksighttest.NewClient()
+	client.IngestionStatus = status
+	client.PutDataSource(testDataSource("warehouse"))
+	dataSet := testDataSet("users")
+	dataSet.ImportMode = types.DataSetImportModeSpice
+	client.PutDataSet(dataSet)
+	app := newTestApp(t, client, io.Discard)
+	annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if opt.IngestionTimeout == 0 {
+		opt.IngestionTimeout = time.Minute
+	}
+	err := app.RunAnnotate(context.Background(), &AnnotateOption{
+		DataSetID:       "users",
+		AnnotationsFile: annotationsFile,
+		OnConflict:      "abort",
+		BackupOption:    BackupOption{NoBackup: true},
+		IngestionOption: opt,
+	})
+	return client, err
+}
+
+// testIngestionStatus returns the status of the only ingestion of the data set users.
+func testIngestionStatus(t *testing.T, client *quicksighttest.Client) types.IngestionStatus {
+	t.Helper()
+	ingestions := client.Ingestions(testAWSAccountID, "users")
+	if len(ingestions) != 1 {
+		t.Fatalf("ingestions = %d, want 1", len(ingestions))
+	}
+	return ingestions[0].IngestionStatus
+}
+
+func TestWaitIngestion(t *testing.T) {
+	if _, err := runTestIngestion(t, types.IngestionStatusCompleted, renamePrefCode, IngestionOption{WaitIngestion: true, SpiceRefresh: "allow"}); err != nil {
+		t.Errorf("completed ingestion: %s", err)
+	}
+	_, err := runTestIngestion(t, types.IngestionStatusFailed, renamePrefCode, IngestionOption{WaitIngestion: true, SpiceRefresh: "allow"})
+	if err == nil || !strings.HasSuffix(err.Error(), "` failed") {
+		t.Errorf("error = %v, want the ingestion failed", err)
+	}
+	// without --wait-ingestion, the failure is not reported
+	if _, err := runTestIngestion(t, types.IngestionStatusFailed, renamePrefCode, IngestionOption{SpiceRefresh: "allow"}); err != nil {
+		t.Errorf("failed ingestion without waiting: %s", err)
+	}
+}
+
+func TestSpiceRefreshCancel(t *testing.T) {
+	client, err := runTestIngestion(t, types.IngestionStatusRunning, describePrefCode, IngestionOption{SpiceRefresh: "cancel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testIngestionStatus(t, client); got != types.IngestionStatusCancelled {
+		t.Errorf("ingestion status of metadata only changes = %s, want CANCELLED", got)
+	}
+	client, err = runTestIngestion(t, types.IngestionStatusRunning, renamePrefCode, IngestionOption{SpiceRefresh: "cancel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testIngestionStatus(t, client); got != types.IngestionStatusRunning {
+		t.Errorf("ingestion status of data changes = %s, want RUNNING", got)
+	}
+}
+
+func TestSpiceRefreshDeny(t *testing.T) {
+	client, err := runTestIngestion(t, types.IngestionStatusRunning, renamePrefCode, IngestionOption{SpiceRefresh: "deny"})
+	if err == nil || !strings.Contains(err.Error(), "denied by --spice-refresh=deny") {
+		t.Errorf("error = %v, want denied", err)
+	}
+	if n := len(client.Updates()); n != 0 {
+		t.Errorf("UpdateDataSet called %d times, want 0", n)
+	}
+	client, err = runTestIngestion(t, types.IngestionStatusRunning, describePrefCode, IngestionOption{SpiceRefresh: "deny"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testIngestionStatus(t, client); got != types.IngestionStatusCancelled {
+		t.Errorf("ingestion status of metadata only changes = %s, want CANCELLED", got)
+	}
+}
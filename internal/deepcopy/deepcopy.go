@@ -0,0 +1,62 @@
+// Package deepcopy provides deep copy of the AWS SDK types by reflection.
+package deepcopy
+
+import "reflect"
+
+// Copy returns a deep copy of v.
+func Copy[T any](v T) T {
+	var copied T
+	reflect.ValueOf(&copied).Elem().Set(Value(reflect.ValueOf(&v).Elem()))
+	return copied
+}
+
+// Value returns a deep copy of v.
+// Unexported fields of structs are copied as is.
+func Value(v reflect.Value) reflect.Value {
+	copied := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return copied
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(Value(v.Elem()))
+		copied.Set(p)
+	case reflect.Interface:
+		if v.IsNil() {
+			return copied
+		}
+		copied.Set(Value(v.Elem()))
+	case reflect.Slice:
+		if v.IsNil() {
+			return copied
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(Value(v.Index(i)))
+		}
+		copied.Set(s)
+	case reflect.Map:
+		if v.IsNil() {
+			return copied
+		}
+		m := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			m.SetMapIndex(iter.Key(), Value(iter.Value()))
+		}
+		copied.Set(m)
+	case reflect.Struct:
+		// copy unexported fields as is, then replace exported fields with deep copies.
+		copied.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			copied.Field(i).Set(Value(v.Field(i)))
+		}
+	default:
+		copied.Set(v)
+	}
+	return copied
+}
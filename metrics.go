@@ -0,0 +1,102 @@
+package redshiftdatasetannotator
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// syncMetrics are the metrics of sync, exposed in the Prometheus text exposition format.
+// They are written by hand to avoid the dependency on the Prometheus client.
+type syncMetrics struct {
+	mu sync.Mutex
+
+	runs               int64
+	dataSetsScanned    int64
+	dataSetsSkipped    int64
+	dataSetsUpdated    int64
+	dataSetsFailed     int64
+	lastSuccessfulRun  time.Time
+	catalogQueryCount  int64
+	catalogQuerySum    float64
+	catalogQueryCounts []int64
+}
+
+// catalogQueryBuckets are the upper bounds in seconds of the histogram of the catalog query latency.
+// The queries through the Redshift Data API take seconds, as they are polled.
+var catalogQueryBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+func newSyncMetrics() *syncMetrics {
+	return &syncMetrics{
+		catalogQueryCounts: make([]int64, len(catalogQueryBuckets)),
+	}
+}
+
+func (m *syncMetrics) observeRun(result syncRunResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs++
+	m.dataSetsScanned += int64(result.scanned)
+	m.dataSetsSkipped += int64(result.skipped)
+	m.dataSetsUpdated += int64(result.updated)
+	m.dataSetsFailed += int64(result.failed)
+	if result.failed == 0 && result.err == nil {
+		m.lastSuccessfulRun = time.Now()
+	}
+}
+
+func (m *syncMetrics) observeCatalogQuery(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.catalogQueryCount++
+	m.catalogQuerySum += d.Seconds()
+	for i, le := range catalogQueryBuckets {
+		if d.Seconds() <= le {
+			m.catalogQueryCounts[i]++
+		}
+	}
+}
+
+func (m *syncMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	printf := func(format string, args ...interface{}) {
+		written, _ := fmt.Fprintf(w, format, args...)
+		n += int64(written)
+	}
+	counter := func(name string, help string, value int64) {
+		printf("# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+	}
+	counter("rsdsa_sync_runs_total", "Number of sync runs.", m.runs)
+	counter("rsdsa_sync_data_sets_scanned_total", "Number of data sets scanned.", m.dataSetsScanned)
+	counter("rsdsa_sync_data_sets_skipped_total", "Number of data sets skipped as the column comments are not changed.", m.dataSetsSkipped)
+	counter("rsdsa_sync_data_sets_updated_total", "Number of data sets updated.", m.dataSetsUpdated)
+	counter("rsdsa_sync_data_sets_failed_total", "Number of data sets failed to sync.", m.dataSetsFailed)
+
+	name := "rsdsa_sync_last_success_timestamp_seconds"
+	printf("# HELP %s Unix time of the last sync run without failures.\n# TYPE %s gauge\n", name, name)
+	if m.lastSuccessfulRun.IsZero() {
+		printf("%s 0\n", name)
+	} else {
+		printf("%s %d\n", name, m.lastSuccessfulRun.Unix())
+	}
+
+	name = "rsdsa_catalog_query_duration_seconds"
+	printf("# HELP %s Latency of the queries of the column comments.\n# TYPE %s histogram\n", name, name)
+	for i, le := range catalogQueryBuckets {
+		printf("%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(le, 'g', -1, 64), m.catalogQueryCounts[i])
+	}
+	printf("%s_bucket{le=\"+Inf\"} %d\n", name, m.catalogQueryCount)
+	printf("%s_sum %s\n", name, strconv.FormatFloat(m.catalogQuerySum, 'g', -1, 64))
+	printf("%s_count %d\n", name, m.catalogQueryCount)
+	return n, nil
+}
+
+func (m *syncMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
@@ -0,0 +1,144 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftserverless"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	_ "github.com/lib/pq"
+)
+
+const (
+	connectionDataAPI  = "data-api"
+	connectionPostgres = "postgres"
+)
+
+const defaultRedshiftPort = 5439
+
+// GetPostgresDSN returns the DSN to connect to Redshift (or PostgreSQL) with the PostgreSQL wire protocol.
+// host, port and database of the profile take precedence over the data source, e.g. for an SSH tunnel or a local container.
+// The password is read from RSDSA_PASSWORD, unless iam_auth or a secret gives the credentials.
+func (app *App) GetPostgresDSN(ctx context.Context, ds *types.DataSource) (string, error) {
+	parameters, ok := ds.DataSourceParameters.(*types.DataSourceParametersMemberRedshiftParameters)
+	if !ok {
+		return "", errors.New("data source is not redshift")
+	}
+	params := parameters.Value
+	profile, target, err := app.redshiftProfile(ctx, ds)
+	if err != nil {
+		return "", err
+	}
+	host := coalesce(profile.Host, params.Host)
+	if host == "" {
+		return "", fmt.Errorf("redshift host not configured for %s", target)
+	}
+	port := int(coalesce(profile.Port))
+	if port == 0 {
+		port = int(coalesce(nillif(params.Port, 0), aws.Int32(defaultRedshiftPort)))
+	}
+	database := coalesce(profile.Database, params.Database)
+	user := coalesce(profile.User, profile.DBUser)
+	password := os.Getenv(envPassword)
+	switch {
+	case profile.IAMAuth:
+		user, password, err = app.getIAMCredentials(ctx, target, database, profile)
+		if err != nil {
+			return "", err
+		}
+	case profile.SecretArn != nil:
+		user, password, err = app.getSecretCredentials(ctx, profile, *profile.SecretArn)
+		if err != nil {
+			return "", err
+		}
+	case user == "" && ds.SecretArn != nil:
+		log.Printf("[debug] use the secret of the data source %s", *ds.SecretArn)
+		user, password, err = app.getSecretCredentials(ctx, profile, *ds.SecretArn)
+		if err != nil {
+			return "", err
+		}
+	}
+	if user == "" {
+		return "", fmt.Errorf("redshift user not configured for %s, please execute `redshift-data-set-annotator configure`", target)
+	}
+	log.Printf("[debug] connect to redshift with postgres protocol host=%s port=%d database=%s user=%s", host, port, database, user)
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(user, password),
+		Host:   net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:   "/" + database,
+	}
+	query := url.Values{}
+	query.Set("sslmode", coalesce(profile.SSLMode, aws.String("require")))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// getIAMCredentials returns the temporary database credentials of provisioned clusters or serverless workgroups.
+func (app *App) getIAMCredentials(ctx context.Context, target *redshiftTarget, database string, profile *ProfileConfig) (string, string, error) {
+	awsCfg, err := app.redshiftAWSConfig(ctx, profile)
+	if err != nil {
+		return "", "", err
+	}
+	if target.WorkgroupName != "" || (target.ClusterIdentifier == "" && profile.WorkgroupName != nil) {
+		workgroupName := coalesce(nillif(target.WorkgroupName, ""), profile.WorkgroupName)
+		output, err := app.credentials.redshiftServerless(awsCfg).GetCredentials(ctx, &redshiftserverless.GetCredentialsInput{
+			WorkgroupName: aws.String(workgroupName),
+			DbName:        aws.String(database),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("GetCredentials: %w", err)
+		}
+		return coalesce(output.DbUser), coalesce(output.DbPassword), nil
+	}
+	clusterIdentifier := coalesce(nillif(target.ClusterIdentifier, ""), profile.ClusterIdentifier)
+	if clusterIdentifier == "" {
+		return "", "", fmt.Errorf("redshift cluster idnetifier not configured for %s, please execute `redshift-data-set-annotator configure`", target)
+	}
+	dbUser := coalesce(profile.User, profile.DBUser)
+	if dbUser == "" {
+		return "", "", fmt.Errorf("redshift db user not configured for %s, please execute `redshift-data-set-annotator configure`", target)
+	}
+	output, err := app.credentials.redshift(awsCfg).GetClusterCredentials(ctx, &redshift.GetClusterCredentialsInput{
+		ClusterIdentifier: aws.String(clusterIdentifier),
+		DbUser:            aws.String(dbUser),
+		DbName:            aws.String(database),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("GetClusterCredentials: %w", err)
+	}
+	return coalesce(output.DbUser), coalesce(output.DbPassword), nil
+}
+
+// getSecretCredentials returns the user name and password stored in the Secrets Manager secret.
+// The secret is expected to be the JSON of Redshift credentials, e.g. {"username":"admin","password":"..."}.
+func (app *App) getSecretCredentials(ctx context.Context, profile *ProfileConfig, secretArn string) (string, string, error) {
+	awsCfg, err := app.redshiftAWSConfig(ctx, profile)
+	if err != nil {
+		return "", "", err
+	}
+	output, err := app.credentials.secretsManager(awsCfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretArn),
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("GetSecretValue: %w", err)
+	}
+	var secret struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal([]byte(coalesce(output.SecretString)), &secret); err != nil {
+		return "", "", fmt.Errorf("failed to parse secret %s: %w", secretArn, err)
+	}
+	return secret.Username, secret.Password, nil
+}
@@ -0,0 +1,212 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftserverless"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+type stubRedshiftCredentials func(*redshift.GetClusterCredentialsInput) (*redshift.GetClusterCredentialsOutput, error)
+
+func (f stubRedshiftCredentials) GetClusterCredentials(ctx context.Context, params *redshift.GetClusterCredentialsInput, optFns ...func(*redshift.Options)) (*redshift.GetClusterCredentialsOutput, error) {
+	return f(params)
+}
+
+type stubRedshiftServerlessCredentials func(*redshiftserverless.GetCredentialsInput) (*redshiftserverless.GetCredentialsOutput, error)
+
+func (f stubRedshiftServerlessCredentials) GetCredentials(ctx context.Context, params *redshiftserverless.GetCredentialsInput, optFns ...func(*redshiftserverless.Options)) (*redshiftserverless.GetCredentialsOutput, error) {
+	return f(params)
+}
+
+type stubSecretsManager func(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+
+func (f stubSecretsManager) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	return f(params)
+}
+
+const testSecretArn = "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:redshift-AbCdEf"
+
+// newTestCredentialsApp returns the App with the default profile and the stubs of the credential APIs.
+// The stubs return the credentials of the inputs, e.g. GetClusterCredentials of the cluster `example` and the user `admin`
+// returns IAM:admin and example-password, and the secret is {"username":"reader","password":"<secret id>"}.
+func newTestCredentialsApp(t *testing.T, profile *ProfileConfig) *App {
+	t.Helper()
+	app := newTestApp(t, quicksighttest.NewClient(), io.Discard)
+	app.cfg = Config{defaultProfileName: profile}
+	app.credentials = credentialsClients{
+		redshift: func(aws.Config) redshiftCredentialsClient {
+			return stubRedshiftCredentials(func(input *redshift.GetClusterCredentialsInput) (*redshift.GetClusterCredentialsOutput, error) {
+				if aws.ToString(input.DbName) != "dev" {
+					return nil, errors.New("unexpected database " + aws.ToString(input.DbName))
+				}
+				return &redshift.GetClusterCredentialsOutput{
+					DbUser:     aws.String("IAM:" + aws.ToString(input.DbUser)),
+					DbPassword: aws.String(aws.ToString(input.ClusterIdentifier) + "-password"),
+				}, nil
+			})
+		},
+		redshiftServerless: func(aws.Config) redshiftServerlessCredentialsClient {
+			return stubRedshiftServerlessCredentials(func(input *redshiftserverless.GetCredentialsInput) (*redshiftserverless.GetCredentialsOutput, error) {
+				return &redshiftserverless.GetCredentialsOutput{
+					DbUser:     aws.String("IAMR:analyst"),
+					DbPassword: aws.String(aws.ToString(input.WorkgroupName) + "-password"),
+				}, nil
+			})
+		},
+		secretsManager: func(aws.Config) secretsManagerClient {
+			return stubSecretsManager(func(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+				if aws.ToString(input.SecretId) == "broken" {
+					return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("not json")}, nil
+				}
+				return &secretsmanager.GetSecretValueOutput{
+					SecretString: aws.String(`{"username":"reader","password":"` + aws.ToString(input.SecretId) + `"}`),
+				}, nil
+			})
+		},
+	}
+	return app
+}
+
+func TestGetPostgresDSN(t *testing.T) {
+	const host = "example.abc123xyz789.ap-northeast-1.redshift.amazonaws.com:5439"
+	cases := []struct {
+		name             string
+		profile          *ProfileConfig
+		password         string
+		dataSourceSecret string
+		want             string
+		wantErr          string
+	}{
+		{
+			name:     "password of the environment variable",
+			profile:  &ProfileConfig{User: aws.String("admin")},
+			password: "pass",
+			want:     "postgres://admin:pass@" + host + "/dev?sslmode=require",
+		},
+		{
+			name:    "host, port and database of the profile",
+			profile: &ProfileConfig{Host: aws.String("localhost"), Port: aws.Int32(15439), Database: aws.String("analytics"), User: aws.String("admin"), SSLMode: aws.String("disable")},
+			want:    "postgres://admin:@localhost:15439/analytics?sslmode=disable",
+		},
+		{
+			name:     "iam auth takes precedence over the password",
+			profile:  &ProfileConfig{DBUser: aws.String("admin"), IAMAuth: true},
+			password: "pass",
+			want:     "postgres://IAM%3Aadmin:example-password@" + host + "/dev?sslmode=require",
+		},
+		{
+			name:    "secret of the profile",
+			profile: &ProfileConfig{SecretArn: aws.String(testSecretArn)},
+			want:    "postgres://reader:" + strings.ReplaceAll(testSecretArn, ":", "%3A") + "@" + host + "/dev?sslmode=require",
+		},
+		{
+			name:             "secret of the data source",
+			profile:          &ProfileConfig{},
+			dataSourceSecret: "datasource-secret",
+			want:             "postgres://reader:datasource-secret@" + host + "/dev?sslmode=require",
+		},
+		{
+			name:             "user of the profile takes precedence over the secret of the data source",
+			profile:          &ProfileConfig{User: aws.String("admin")},
+			password:         "pass",
+			dataSourceSecret: "datasource-secret",
+			want:             "postgres://admin:pass@" + host + "/dev?sslmode=require",
+		},
+		{
+			name:    "user not configured",
+			profile: &ProfileConfig{},
+			wantErr: "redshift user not configured",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(envPassword, c.password)
+			app := newTestCredentialsApp(t, c.profile)
+			ds := testDataSource("warehouse")
+			if c.dataSourceSecret != "" {
+				ds.SecretArn = aws.String(c.dataSourceSecret)
+			}
+			dsn, err := app.GetPostgresDSN(context.Background(), ds)
+			if c.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+					t.Errorf("error = %v, want %q", err, c.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dsn != c.want {
+				t.Errorf("dsn = %s, want %s", dsn, c.want)
+			}
+		})
+	}
+}
+
+func TestGetIAMCredentials(t *testing.T) {
+	ctx := context.Background()
+	app := newTestCredentialsApp(t, &ProfileConfig{})
+	user, password, err := app.getIAMCredentials(ctx, &redshiftTarget{WorkgroupName: "analytics"}, "dev", &ProfileConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "IAMR:analyst" || password != "analytics-password" {
+		t.Errorf("credentials of the workgroup = %s/%s, want IAMR:analyst/analytics-password", user, password)
+	}
+	// the workgroup of the profile is used when the target is not resolved
+	_, password, err = app.getIAMCredentials(ctx, &redshiftTarget{Host: "localhost"}, "dev", &ProfileConfig{WorkgroupName: aws.String("default")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password != "default-password" {
+		t.Errorf("password of the workgroup of the profile = %s, want default-password", password)
+	}
+
+	user, password, err = app.getIAMCredentials(ctx, &redshiftTarget{ClusterIdentifier: "example"}, "dev", &ProfileConfig{DBUser: aws.String("admin")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "IAM:admin" || password != "example-password" {
+		t.Errorf("credentials of the cluster = %s/%s, want IAM:admin/example-password", user, password)
+	}
+	if _, _, err := app.getIAMCredentials(ctx, &redshiftTarget{ClusterIdentifier: "example"}, "dev", &ProfileConfig{}); err == nil || !strings.Contains(err.Error(), "db user not configured") {
+		t.Errorf("error without db user = %v, want db user not configured", err)
+	}
+	if _, _, err := app.getIAMCredentials(ctx, &redshiftTarget{Host: "localhost"}, "dev", &ProfileConfig{DBUser: aws.String("admin")}); err == nil || !strings.Contains(err.Error(), "cluster idnetifier not configured") {
+		t.Errorf("error without cluster = %v, want cluster identifier not configured", err)
+	}
+	if _, _, err := app.getIAMCredentials(ctx, &redshiftTarget{ClusterIdentifier: "example"}, "analytics", &ProfileConfig{DBUser: aws.String("admin")}); err == nil || !strings.HasPrefix(err.Error(), "GetClusterCredentials: ") {
+		t.Errorf("error of the API = %v, want GetClusterCredentials error", err)
+	}
+}
+
+func TestGetSecretCredentials(t *testing.T) {
+	ctx := context.Background()
+	app := newTestCredentialsApp(t, &ProfileConfig{})
+	user, password, err := app.getSecretCredentials(ctx, &ProfileConfig{}, testSecretArn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "reader" || password != testSecretArn {
+		t.Errorf("credentials = %s/%s, want reader/%s", user, password, testSecretArn)
+	}
+	if _, _, err := app.getSecretCredentials(ctx, &ProfileConfig{}, "broken"); err == nil || !strings.Contains(err.Error(), "failed to parse secret broken") {
+		t.Errorf("error of the malformed secret = %v, want failed to parse", err)
+	}
+	app.credentials.secretsManager = func(aws.Config) secretsManagerClient {
+		return stubSecretsManager(func(*secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+			return nil, errors.New("access denied")
+		})
+	}
+	if _, _, err := app.getSecretCredentials(ctx, &ProfileConfig{}, testSecretArn); err == nil || err.Error() != "GetSecretValue: access denied" {
+		t.Errorf("error of the API = %v, want GetSecretValue: access denied", err)
+	}
+}
@@ -0,0 +1,152 @@
+package redshiftdatasetannotator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/samber/lo"
+)
+
+// projectSettings are the settings of the commands in the project configuration file.
+// The flags of the commands take precedence over them.
+//
+//	annotation_sources:
+//	  annotations_file: annotations.yaml
+//	  infer_geographic_role: true
+//	  geographic_role_patterns: {"*_pref": STATE}
+//	  folder_prefixes: {"addr_": Customer/Address}
+//	comment_format:
+//	  name_line: false
+//	  hint_prefix: "#"
+//	ignore:
+//	  data_sets: ["tmp_*"]
+//	  columns: ["_*", "public.users.dw_hash"]
+//	data_sets:
+//	  data_source_id: warehouse
+//	  schema: public
+type projectSettings struct {
+	AnnotationSources *annotationSources `json:"annotation_sources,omitempty"`
+	CommentFormat     *commentFormat     `json:"comment_format,omitempty"`
+	Ignore            *ignoreList        `json:"ignore,omitempty"`
+	DataSets          *dataSetSelector   `json:"data_sets,omitempty"`
+}
+
+// annotationSources are the defaults of the annotation sources of annotate and sync.
+// The annotations file is relative to the project configuration file.
+type annotationSources struct {
+	AnnotationsFile        string            `json:"annotations_file,omitempty"`
+	InferGeographicRole    bool              `json:"infer_geographic_role,omitempty"`
+	GeographicRolePatterns map[string]string `json:"geographic_role_patterns,omitempty"`
+	FolderPrefixes         map[string]string `json:"folder_prefixes,omitempty"`
+}
+
+// commentFormat is the format of the column comments of Redshift.
+type commentFormat struct {
+	// NameLine is whether the first line of the comment is the field name, default true.
+	// If false, the whole comment is the description.
+	NameLine *bool `json:"name_line,omitempty"`
+	// HintPrefix is the prefix of the hint lines, default `@`, e.g. `#` for `#geo: STATE`.
+	HintPrefix string `json:"hint_prefix,omitempty"`
+}
+
+const defaultHintPrefix = "@"
+
+// ignoreList is the data sets and columns that are not annotated.
+type ignoreList struct {
+	// DataSets are glob patterns of the data set IDs, skipped when the data sets are selected by the data source.
+	DataSets []string `json:"data_sets,omitempty"`
+	// Columns are glob patterns of the column names or schema.table.column, whose comments are not read.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// dataSetSelector selects the data sets by the data source, when neither --data-set-id nor --data-source-id is given.
+type dataSetSelector struct {
+	DataSourceID string `json:"data_source_id"`
+	Schema       string `json:"schema,omitempty"`
+	Table        string `json:"table,omitempty"`
+}
+
+func (s projectSettings) validate() error {
+	if sources := s.AnnotationSources; sources != nil {
+		if _, err := newGeographicRoleMatcher(false, sources.GeographicRolePatterns); err != nil {
+			return fmt.Errorf("annotation_sources: %w", err)
+		}
+	}
+	if format := s.CommentFormat; format != nil && strings.TrimSpace(format.HintPrefix) != format.HintPrefix {
+		return fmt.Errorf("comment_format: hint_prefix `%s` must not have spaces", format.HintPrefix)
+	}
+	if ignore := s.Ignore; ignore != nil {
+		for _, pattern := range append(append([]string{}, ignore.DataSets...), ignore.Columns...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("ignore pattern `%s`: %w", pattern, err)
+			}
+		}
+	}
+	if s.DataSets != nil && s.DataSets.DataSourceID == "" {
+		return errors.New("data_sets: data_source_id is required")
+	}
+	return nil
+}
+
+func (s projectSettings) empty() bool {
+	return s == projectSettings{}
+}
+
+// annotateOption returns a copy of opt with the annotation sources and the data set selector of the settings.
+// The flags take precedence, and the patterns and prefixes of the flags are merged over the settings.
+func (s projectSettings) annotateOption(opt *AnnotateOption) *AnnotateOption {
+	merged := *opt
+	if sources := s.AnnotationSources; sources != nil {
+		if merged.AnnotationsFile == "" {
+			merged.AnnotationsFile = sources.AnnotationsFile
+		}
+		merged.InferGeographicRole = merged.InferGeographicRole || sources.InferGeographicRole
+		merged.GeographicRolePattern = lo.Assign(sources.GeographicRolePatterns, opt.GeographicRolePattern)
+		merged.FolderPrefix = lo.Assign(sources.FolderPrefixes, opt.FolderPrefix)
+	}
+	if merged.DataSetID == "" {
+		merged.DataSourceID, merged.Schema, merged.Table = s.selectDataSource(merged.DataSourceID, merged.Schema, merged.Table)
+	}
+	return &merged
+}
+
+// selectDataSource returns the data source, schema and table of the data set selector, if dataSourceID is empty.
+// Used only when the data sets are not selected by --data-set-id.
+func (s projectSettings) selectDataSource(dataSourceID, schema, table string) (string, string, string) {
+	if dataSourceID != "" || s.DataSets == nil {
+		return dataSourceID, schema, table
+	}
+	log.Printf("[info] select the data sets using data source %s by the project configuration", s.DataSets.DataSourceID)
+	return s.DataSets.DataSourceID, coalesce(nillif(schema, ""), &s.DataSets.Schema), coalesce(nillif(table, ""), &s.DataSets.Table)
+}
+
+// ignoreDataSet reports whether the data set is ignored.
+func (s projectSettings) ignoreDataSet(dataSetID string) bool {
+	return s.Ignore != nil && matchHiddenColumn(s.Ignore.DataSets, dataSetID)
+}
+
+// ignoreColumn reports whether the column of the relation is ignored.
+func (s projectSettings) ignoreColumn(schema, table, columnName string) bool {
+	if s.Ignore == nil {
+		return false
+	}
+	return matchHiddenColumn(s.Ignore.Columns, columnName) || matchHiddenColumn(s.Ignore.Columns, schema+"."+table+"."+columnName)
+}
+
+// format returns the comment format of the settings with the defaults.
+func (s projectSettings) format() commentFormat {
+	format := commentFormat{NameLine: aws.Bool(true), HintPrefix: defaultHintPrefix}
+	if s.CommentFormat != nil {
+		if s.CommentFormat.NameLine != nil {
+			format.NameLine = s.CommentFormat.NameLine
+		}
+		if s.CommentFormat.HintPrefix != "" {
+			format.HintPrefix = s.CommentFormat.HintPrefix
+		}
+	}
+	return format
+}
@@ -0,0 +1,323 @@
+package quicksighttest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/internal/deepcopy"
+)
+
+type analysis struct {
+	analysis   *types.Analysis
+	definition *types.AnalysisDefinition
+}
+
+type dashboard struct {
+	dashboard *types.Dashboard
+	// definition is the definition of the published version.
+	definition *types.DashboardVersionDefinition
+	// versions are all versions, versions[n-1] is the version n. The versions before the stored one are nil.
+	versions []*dashboardVersion
+}
+
+type dashboardVersion struct {
+	version    *types.DashboardVersion
+	definition *types.DashboardVersionDefinition
+}
+
+// PutAnalysis stores the analysis and its definition. The account is taken from the Arn of the analysis.
+func (c *Client) PutAnalysis(a *types.Analysis, definition *types.AnalysisDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.analyses[key(accountID(a.Arn), aws.ToString(a.AnalysisId))] = &analysis{
+		analysis:   deepcopy.Copy(a),
+		definition: deepcopy.Copy(definition),
+	}
+}
+
+// PutDashboard stores the dashboard and the definition of its current version. The account is taken from the Arn of the dashboard.
+// The version number of the dashboard is 1 if not set.
+func (c *Client) PutDashboard(d *types.Dashboard, definition *types.DashboardVersionDefinition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := &dashboard{
+		dashboard:  deepcopy.Copy(d),
+		definition: deepcopy.Copy(definition),
+	}
+	if stored.dashboard.Version == nil {
+		stored.dashboard.Version = &types.DashboardVersion{Status: types.ResourceStatusCreationSuccessful}
+	}
+	if aws.ToInt64(stored.dashboard.Version.VersionNumber) < 1 {
+		stored.dashboard.Version.VersionNumber = aws.Int64(1)
+	}
+	stored.versions = make([]*dashboardVersion, *stored.dashboard.Version.VersionNumber)
+	stored.versions[len(stored.versions)-1] = &dashboardVersion{
+		version:    deepcopy.Copy(stored.dashboard.Version),
+		definition: stored.definition,
+	}
+	c.dashboards[key(accountID(d.Arn), aws.ToString(d.DashboardId))] = stored
+}
+
+// FailAssetUpdate makes the following updates of the analysis or the dashboard of the ID fail after they are accepted:
+// the status of the analysis becomes UPDATE_FAILED, and the new version of the dashboard CREATION_FAILED, with the message as the error.
+func (c *Client) FailAssetUpdate(awsAccountID, id string, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.assetUpdateErr[key(awsAccountID, id)] = message
+}
+
+// AnalysisDefinition returns a copy of the definition of the stored analysis.
+func (c *Client) AnalysisDefinition(awsAccountID, analysisID string) (*types.AnalysisDefinition, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.analyses[key(awsAccountID, analysisID)]
+	if !ok {
+		return nil, false
+	}
+	return deepcopy.Copy(a.definition), true
+}
+
+// DashboardDefinition returns a copy of the definition of the published version of the stored dashboard, and the version number.
+func (c *Client) DashboardDefinition(awsAccountID, dashboardID string) (*types.DashboardVersionDefinition, int64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dashboards[key(awsAccountID, dashboardID)]
+	if !ok {
+		return nil, 0, false
+	}
+	return deepcopy.Copy(d.definition), aws.ToInt64(d.dashboard.Version.VersionNumber), true
+}
+
+func sortedKeys[T any](m map[string]T, prefix string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *Client) ListAnalyses(ctx context.Context, params *quicksight.ListAnalysesInput, optFns ...func(*quicksight.Options)) (*quicksight.ListAnalysesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := sortedKeys(c.analyses, key(aws.ToString(params.AwsAccountId), ""))
+	summaries := make([]types.AnalysisSummary, 0, len(keys))
+	for _, k := range keys {
+		a := c.analyses[k].analysis
+		summaries = append(summaries, types.AnalysisSummary{
+			AnalysisId:      a.AnalysisId,
+			Arn:             a.Arn,
+			Name:            a.Name,
+			Status:          a.Status,
+			CreatedTime:     a.CreatedTime,
+			LastUpdatedTime: a.LastUpdatedTime,
+		})
+	}
+	return &quicksight.ListAnalysesOutput{
+		AnalysisSummaryList: summaries,
+		RequestId:           c.requestID(),
+		Status:              http.StatusOK,
+	}, nil
+}
+
+func (c *Client) DescribeAnalysisDefinition(ctx context.Context, params *quicksight.DescribeAnalysisDefinitionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeAnalysisDefinitionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.analyses[key(aws.ToString(params.AwsAccountId), aws.ToString(params.AnalysisId))]
+	if !ok {
+		return nil, notFound("analysis %s not found", aws.ToString(params.AnalysisId))
+	}
+	return &quicksight.DescribeAnalysisDefinitionOutput{
+		AnalysisId:     a.analysis.AnalysisId,
+		Name:           a.analysis.Name,
+		Definition:     deepcopy.Copy(a.definition),
+		ResourceStatus: a.analysis.Status,
+		ThemeArn:       a.analysis.ThemeArn,
+		RequestId:      c.requestID(),
+		Status:         http.StatusOK,
+	}, nil
+}
+
+func (c *Client) DescribeAnalysis(ctx context.Context, params *quicksight.DescribeAnalysisInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeAnalysisOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.analyses[key(aws.ToString(params.AwsAccountId), aws.ToString(params.AnalysisId))]
+	if !ok {
+		return nil, notFound("analysis %s not found", aws.ToString(params.AnalysisId))
+	}
+	return &quicksight.DescribeAnalysisOutput{
+		Analysis:  deepcopy.Copy(a.analysis),
+		RequestId: c.requestID(),
+		Status:    http.StatusOK,
+	}, nil
+}
+
+func (c *Client) ListDashboards(ctx context.Context, params *quicksight.ListDashboardsInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDashboardsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := sortedKeys(c.dashboards, key(aws.ToString(params.AwsAccountId), ""))
+	summaries := make([]types.DashboardSummary, 0, len(keys))
+	for _, k := range keys {
+		d := c.dashboards[k].dashboard
+		summary := types.DashboardSummary{
+			Arn:             d.Arn,
+			DashboardId:     d.DashboardId,
+			Name:            d.Name,
+			CreatedTime:     d.CreatedTime,
+			LastUpdatedTime: d.LastUpdatedTime,
+		}
+		if d.Version != nil {
+			summary.PublishedVersionNumber = d.Version.VersionNumber
+		}
+		summaries = append(summaries, summary)
+	}
+	return &quicksight.ListDashboardsOutput{
+		DashboardSummaryList: summaries,
+		RequestId:            c.requestID(),
+		Status:               http.StatusOK,
+	}, nil
+}
+
+func (c *Client) DescribeDashboardDefinition(ctx context.Context, params *quicksight.DescribeDashboardDefinitionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDashboardDefinitionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dashboards[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DashboardId))]
+	if !ok {
+		return nil, notFound("dashboard %s not found", aws.ToString(params.DashboardId))
+	}
+	output := &quicksight.DescribeDashboardDefinitionOutput{
+		DashboardId:    d.dashboard.DashboardId,
+		Name:           d.dashboard.Name,
+		Definition:     deepcopy.Copy(d.definition),
+		ResourceStatus: types.ResourceStatusCreationSuccessful,
+		RequestId:      c.requestID(),
+		Status:         http.StatusOK,
+	}
+	if d.dashboard.Version != nil {
+		output.ResourceStatus = d.dashboard.Version.Status
+		output.ThemeArn = d.dashboard.Version.ThemeArn
+	}
+	return output, nil
+}
+
+// DescribeDashboard returns the dashboard with the version of VersionNumber, or the published version.
+func (c *Client) DescribeDashboard(ctx context.Context, params *quicksight.DescribeDashboardInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDashboardOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dashboards[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DashboardId))]
+	if !ok {
+		return nil, notFound("dashboard %s not found", aws.ToString(params.DashboardId))
+	}
+	described := deepcopy.Copy(d.dashboard)
+	if params.VersionNumber != nil {
+		versionNumber := aws.ToInt64(params.VersionNumber)
+		if versionNumber < 1 || versionNumber > int64(len(d.versions)) || d.versions[versionNumber-1] == nil {
+			return nil, notFound("version %d of dashboard %s not found", versionNumber, aws.ToString(params.DashboardId))
+		}
+		described.Version = deepcopy.Copy(d.versions[versionNumber-1].version)
+	}
+	return &quicksight.DescribeDashboardOutput{
+		Dashboard: described,
+		RequestId: c.requestID(),
+		Status:    http.StatusOK,
+	}, nil
+}
+
+func (c *Client) UpdateAnalysis(ctx context.Context, params *quicksight.UpdateAnalysisInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateAnalysisOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.analyses[key(aws.ToString(params.AwsAccountId), aws.ToString(params.AnalysisId))]
+	if !ok {
+		return nil, notFound("analysis %s not found", aws.ToString(params.AnalysisId))
+	}
+	now := c.Now()
+	a.analysis.LastUpdatedTime = &now
+	if message, ok := c.assetUpdateErr[key(aws.ToString(params.AwsAccountId), aws.ToString(params.AnalysisId))]; ok {
+		a.analysis.Status = types.ResourceStatusUpdateFailed
+		a.analysis.Errors = []types.AnalysisError{{Type: types.AnalysisErrorTypeInternalFailure, Message: aws.String(message)}}
+	} else {
+		a.analysis.Name = params.Name
+		a.analysis.ThemeArn = params.ThemeArn
+		a.analysis.Status = types.ResourceStatusUpdateSuccessful
+		a.analysis.Errors = nil
+		a.definition = deepcopy.Copy(params.Definition)
+	}
+	return &quicksight.UpdateAnalysisOutput{
+		AnalysisId:   a.analysis.AnalysisId,
+		Arn:          a.analysis.Arn,
+		UpdateStatus: types.ResourceStatusUpdateInProgress,
+		RequestId:    c.requestID(),
+		Status:       http.StatusAccepted,
+	}, nil
+}
+
+// UpdateDashboard creates a new version of the dashboard, that is described by DescribeDashboard with the version number.
+// The published version is not changed.
+func (c *Client) UpdateDashboard(ctx context.Context, params *quicksight.UpdateDashboardInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDashboardOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dashboards[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DashboardId))]
+	if !ok {
+		return nil, notFound("dashboard %s not found", aws.ToString(params.DashboardId))
+	}
+	now := c.Now()
+	d.dashboard.Name = params.Name
+	d.dashboard.LastUpdatedTime = &now
+	versionNumber := int64(len(d.versions) + 1)
+	version := &types.DashboardVersion{
+		Arn:           aws.String(fmt.Sprintf("%s/version/%d", aws.ToString(d.dashboard.Arn), versionNumber)),
+		VersionNumber: aws.Int64(versionNumber),
+		Status:        types.ResourceStatusCreationSuccessful,
+		ThemeArn:      params.ThemeArn,
+		Description:   params.VersionDescription,
+		CreatedTime:   &now,
+	}
+	if message, ok := c.assetUpdateErr[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DashboardId))]; ok {
+		version.Status = types.ResourceStatusCreationFailed
+		version.Errors = []types.DashboardError{{Type: types.DashboardErrorTypeInternalFailure, Message: aws.String(message)}}
+	}
+	d.versions = append(d.versions, &dashboardVersion{version: version, definition: deepcopy.Copy(params.Definition)})
+	return &quicksight.UpdateDashboardOutput{
+		Arn:            d.dashboard.Arn,
+		DashboardId:    d.dashboard.DashboardId,
+		VersionArn:     version.Arn,
+		CreationStatus: types.ResourceStatusCreationInProgress,
+		RequestId:      c.requestID(),
+		Status:         http.StatusAccepted,
+	}, nil
+}
+
+func (c *Client) UpdateDashboardPublishedVersion(ctx context.Context, params *quicksight.UpdateDashboardPublishedVersionInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDashboardPublishedVersionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.dashboards[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DashboardId))]
+	if !ok {
+		return nil, notFound("dashboard %s not found", aws.ToString(params.DashboardId))
+	}
+	versionNumber := aws.ToInt64(params.VersionNumber)
+	if versionNumber < 1 || versionNumber > int64(len(d.versions)) || d.versions[versionNumber-1] == nil {
+		return nil, notFound("version %d of dashboard %s not found", versionNumber, aws.ToString(params.DashboardId))
+	}
+	version := d.versions[versionNumber-1]
+	if version.version.Status != types.ResourceStatusCreationSuccessful {
+		return nil, &types.InvalidParameterValueException{
+			Message: aws.String(fmt.Sprintf("version %d of dashboard %s is %s", versionNumber, aws.ToString(params.DashboardId), version.version.Status)),
+		}
+	}
+	d.definition = version.definition
+	d.dashboard.Version = deepcopy.Copy(version.version)
+	return &quicksight.UpdateDashboardPublishedVersionOutput{
+		DashboardArn: d.dashboard.Arn,
+		DashboardId:  d.dashboard.DashboardId,
+		RequestId:    c.requestID(),
+		Status:       http.StatusOK,
+	}, nil
+}
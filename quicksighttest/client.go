@@ -0,0 +1,331 @@
+// Package quicksighttest provides an in-memory fake of the QuickSight API for testing.
+package quicksighttest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/internal/deepcopy"
+)
+
+// Client is an in-memory fake of the QuickSight API.
+// It stores data sets and data sources, and records the UpdateDataSet calls.
+type Client struct {
+	// Now returns the current time, used for LastUpdatedTime and ingestions.
+	Now func() time.Time
+	// IngestionStatus is the status of the ingestions started by UpdateDataSet for SPICE data sets.
+	IngestionStatus types.IngestionStatus
+
+	mu          sync.Mutex
+	dataSets    map[string]*types.DataSet
+	describeErr map[string]error
+	// describeCount is the number of DescribeDataSet calls of each data set, see UpdateAfterDescribe.
+	describeCount map[string]int
+	afterDescribe map[string]map[int]func(*types.DataSet)
+	dataSources   map[string]*types.DataSource
+	ingestions    map[string]*types.Ingestion
+	analyses      map[string]*analysis
+	dashboards    map[string]*dashboard
+	// assetUpdateErr is the error message of the updates of the analyses and dashboards, see FailAssetUpdate.
+	assetUpdateErr map[string]string
+	updates        []*quicksight.UpdateDataSetInput
+	seq            int
+}
+
+// NewClient returns an empty fake.
+func NewClient() *Client {
+	return &Client{
+		Now:             time.Now,
+		IngestionStatus: types.IngestionStatusCompleted,
+		dataSets:        make(map[string]*types.DataSet),
+		describeErr:     make(map[string]error),
+		describeCount:   make(map[string]int),
+		afterDescribe:   make(map[string]map[int]func(*types.DataSet)),
+		dataSources:     make(map[string]*types.DataSource),
+		ingestions:      make(map[string]*types.Ingestion),
+		analyses:        make(map[string]*analysis),
+		dashboards:      make(map[string]*dashboard),
+		assetUpdateErr:  make(map[string]string),
+	}
+}
+
+func key(awsAccountID, id string) string {
+	return awsAccountID + "/" + id
+}
+
+func accountID(resourceArn *string) string {
+	arnObj, err := arn.Parse(aws.ToString(resourceArn))
+	if err != nil {
+		return ""
+	}
+	return arnObj.AccountID
+}
+
+func notFound(format string, args ...interface{}) error {
+	return &types.ResourceNotFoundException{
+		Message: aws.String(fmt.Sprintf(format, args...)),
+	}
+}
+
+// PutDataSet stores the data set. The account is taken from the Arn of the data set.
+// If OutputColumns is empty, it is computed from the physical and logical tables.
+func (c *Client) PutDataSet(dataSet *types.DataSet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stored := deepcopy.Copy(dataSet)
+	if stored.OutputColumns == nil {
+		stored.OutputColumns = OutputColumns(stored)
+	}
+	c.dataSets[key(accountID(stored.Arn), aws.ToString(stored.DataSetId))] = stored
+}
+
+// FailDescribeDataSet makes DescribeDataSet of the stored data set fail with err, while it is still listed by ListDataSets.
+func (c *Client) FailDescribeDataSet(awsAccountID, dataSetID string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.describeErr[key(awsAccountID, dataSetID)] = err
+}
+
+// UpdateAfterDescribe changes the stored data set with change right after it is described for the n-th time,
+// as if someone else updated it between DescribeDataSet and UpdateDataSet.
+func (c *Client) UpdateAfterDescribe(awsAccountID, dataSetID string, n int, change func(*types.DataSet)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(awsAccountID, dataSetID)
+	if c.afterDescribe[k] == nil {
+		c.afterDescribe[k] = make(map[int]func(*types.DataSet))
+	}
+	c.afterDescribe[k][n] = change
+}
+
+// PutDataSource stores the data source. The account is taken from the Arn of the data source.
+func (c *Client) PutDataSource(dataSource *types.DataSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dataSources[key(accountID(dataSource.Arn), aws.ToString(dataSource.DataSourceId))] = deepcopy.Copy(dataSource)
+}
+
+// DataSet returns a copy of the stored data set.
+func (c *Client) DataSet(awsAccountID, dataSetID string) (*types.DataSet, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dataSet, ok := c.dataSets[key(awsAccountID, dataSetID)]
+	if !ok {
+		return nil, false
+	}
+	return deepcopy.Copy(dataSet), true
+}
+
+// Ingestions returns copies of the ingestions of the data set started by UpdateDataSet, in the order of start.
+func (c *Client) Ingestions(awsAccountID, dataSetID string) []*types.Ingestion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := key(key(awsAccountID, dataSetID), "")
+	ingestions := make([]*types.Ingestion, 0)
+	for k, ingestion := range c.ingestions {
+		if strings.HasPrefix(k, prefix) {
+			ingestions = append(ingestions, deepcopy.Copy(ingestion))
+		}
+	}
+	sort.Slice(ingestions, func(i, j int) bool {
+		return ingestions[i].CreatedTime.Before(*ingestions[j].CreatedTime) ||
+			ingestions[i].CreatedTime.Equal(*ingestions[j].CreatedTime) && aws.ToString(ingestions[i].IngestionId) < aws.ToString(ingestions[j].IngestionId)
+	})
+	return ingestions
+}
+
+// Updates returns the recorded UpdateDataSet inputs.
+func (c *Client) Updates() []*quicksight.UpdateDataSetInput {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return deepcopy.Copy(c.updates)
+}
+
+func (c *Client) DescribeDataSet(ctx context.Context, params *quicksight.DescribeDataSetInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDataSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(aws.ToString(params.AwsAccountId), aws.ToString(params.DataSetId))
+	if err, ok := c.describeErr[k]; ok {
+		return nil, err
+	}
+	dataSet, ok := c.dataSets[k]
+	if !ok {
+		return nil, notFound("data set %s not found", aws.ToString(params.DataSetId))
+	}
+	output := &quicksight.DescribeDataSetOutput{
+		DataSet:   deepcopy.Copy(dataSet),
+		RequestId: c.requestID(),
+		Status:    http.StatusOK,
+	}
+	c.describeCount[k]++
+	if change, ok := c.afterDescribe[k][c.describeCount[k]]; ok {
+		change(dataSet)
+		now := c.Now()
+		dataSet.LastUpdatedTime = &now
+		dataSet.OutputColumns = OutputColumns(dataSet)
+	}
+	return output, nil
+}
+
+func (c *Client) DescribeDataSource(ctx context.Context, params *quicksight.DescribeDataSourceInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeDataSourceOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	dataSource, ok := c.dataSources[key(aws.ToString(params.AwsAccountId), aws.ToString(params.DataSourceId))]
+	if !ok {
+		return nil, notFound("data source %s not found", aws.ToString(params.DataSourceId))
+	}
+	return &quicksight.DescribeDataSourceOutput{
+		DataSource: deepcopy.Copy(dataSource),
+		RequestId:  c.requestID(),
+		Status:     http.StatusOK,
+	}, nil
+}
+
+func (c *Client) UpdateDataSet(ctx context.Context, params *quicksight.UpdateDataSetInput, optFns ...func(*quicksight.Options)) (*quicksight.UpdateDataSetOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key(aws.ToString(params.AwsAccountId), aws.ToString(params.DataSetId))
+	dataSet, ok := c.dataSets[k]
+	if !ok {
+		return nil, notFound("data set %s not found", aws.ToString(params.DataSetId))
+	}
+	input := deepcopy.Copy(params)
+	c.updates = append(c.updates, input)
+
+	// copy every field of the input that has the same name in the data set.
+	src := reflect.ValueOf(input).Elem()
+	dst := reflect.ValueOf(dataSet).Elem()
+	for i := 0; i < src.NumField(); i++ {
+		field := src.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if dstField := dst.FieldByName(field.Name); dstField.IsValid() && dstField.Type() == field.Type {
+			dstField.Set(deepcopy.Value(src.Field(i)))
+		}
+	}
+	now := c.Now()
+	dataSet.LastUpdatedTime = &now
+	dataSet.OutputColumns = OutputColumns(dataSet)
+
+	output := &quicksight.UpdateDataSetOutput{
+		Arn:       dataSet.Arn,
+		DataSetId: dataSet.DataSetId,
+		RequestId: c.requestID(),
+		Status:    http.StatusOK,
+	}
+	if dataSet.ImportMode == types.DataSetImportModeSpice {
+		c.seq++
+		ingestionID := fmt.Sprintf("ingestion-%d", c.seq)
+		c.ingestions[key(k, ingestionID)] = &types.Ingestion{
+			Arn:             aws.String(aws.ToString(dataSet.Arn) + "/ingestion/" + ingestionID),
+			IngestionId:     aws.String(ingestionID),
+			IngestionStatus: c.IngestionStatus,
+			CreatedTime:     &now,
+			RequestSource:   types.IngestionRequestSourceManual,
+			RequestType:     types.IngestionRequestTypeFullRefresh,
+		}
+		output.IngestionId = aws.String(ingestionID)
+		output.IngestionArn = c.ingestions[key(k, ingestionID)].Arn
+	}
+	return output, nil
+}
+
+func (c *Client) ListDataSets(ctx context.Context, params *quicksight.ListDataSetsInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDataSetsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := key(aws.ToString(params.AwsAccountId), "")
+	keys := make([]string, 0, len(c.dataSets))
+	for k := range c.dataSets {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	summaries := make([]types.DataSetSummary, 0, len(keys))
+	for _, k := range keys {
+		dataSet := c.dataSets[k]
+		summaries = append(summaries, types.DataSetSummary{
+			Arn:                               dataSet.Arn,
+			DataSetId:                         dataSet.DataSetId,
+			Name:                              dataSet.Name,
+			ImportMode:                        dataSet.ImportMode,
+			CreatedTime:                       dataSet.CreatedTime,
+			LastUpdatedTime:                   dataSet.LastUpdatedTime,
+			ColumnLevelPermissionRulesApplied: len(dataSet.ColumnLevelPermissionRules) > 0,
+			RowLevelPermissionDataSet:         deepcopy.Copy(dataSet.RowLevelPermissionDataSet),
+		})
+	}
+	return &quicksight.ListDataSetsOutput{
+		DataSetSummaries: summaries,
+		RequestId:        c.requestID(),
+		Status:           http.StatusOK,
+	}, nil
+}
+
+func (c *Client) ListDataSources(ctx context.Context, params *quicksight.ListDataSourcesInput, optFns ...func(*quicksight.Options)) (*quicksight.ListDataSourcesOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prefix := key(aws.ToString(params.AwsAccountId), "")
+	keys := make([]string, 0, len(c.dataSources))
+	for k := range c.dataSources {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	dataSources := make([]types.DataSource, 0, len(keys))
+	for _, k := range keys {
+		dataSources = append(dataSources, *deepcopy.Copy(c.dataSources[k]))
+	}
+	return &quicksight.ListDataSourcesOutput{
+		DataSources: dataSources,
+		RequestId:   c.requestID(),
+		Status:      http.StatusOK,
+	}, nil
+}
+
+func (c *Client) DescribeIngestion(ctx context.Context, params *quicksight.DescribeIngestionInput, optFns ...func(*quicksight.Options)) (*quicksight.DescribeIngestionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ingestion, ok := c.ingestions[key(key(aws.ToString(params.AwsAccountId), aws.ToString(params.DataSetId)), aws.ToString(params.IngestionId))]
+	if !ok {
+		return nil, notFound("ingestion %s not found", aws.ToString(params.IngestionId))
+	}
+	return &quicksight.DescribeIngestionOutput{
+		Ingestion: deepcopy.Copy(ingestion),
+		RequestId: c.requestID(),
+		Status:    http.StatusOK,
+	}, nil
+}
+
+func (c *Client) CancelIngestion(ctx context.Context, params *quicksight.CancelIngestionInput, optFns ...func(*quicksight.Options)) (*quicksight.CancelIngestionOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ingestion, ok := c.ingestions[key(key(aws.ToString(params.AwsAccountId), aws.ToString(params.DataSetId)), aws.ToString(params.IngestionId))]
+	if !ok {
+		return nil, notFound("ingestion %s not found", aws.ToString(params.IngestionId))
+	}
+	ingestion.IngestionStatus = types.IngestionStatusCancelled
+	return &quicksight.CancelIngestionOutput{
+		Arn:         ingestion.Arn,
+		IngestionId: ingestion.IngestionId,
+		RequestId:   c.requestID(),
+		Status:      http.StatusAccepted,
+	}, nil
+}
+
+func (c *Client) requestID() *string {
+	c.seq++
+	return aws.String(fmt.Sprintf("request-%d", c.seq))
+}
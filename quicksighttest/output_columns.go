@@ -0,0 +1,112 @@
+package quicksighttest
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+// OutputColumns approximates the output columns that QuickSight computes for the data set.
+// The input columns of the physical tables are transformed by the data transforms of the logical tables.
+// Joins are not supported.
+func OutputColumns(dataSet *types.DataSet) []types.OutputColumn {
+	ids := make([]string, 0, len(dataSet.LogicalTableMap))
+	for id := range dataSet.LogicalTableMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	columns := make([]types.OutputColumn, 0)
+	for _, id := range ids {
+		logicalTable := dataSet.LogicalTableMap[id]
+		if logicalTable.Source == nil || logicalTable.Source.PhysicalTableId == nil {
+			continue
+		}
+		columns = append(columns, transformColumns(
+			inputColumns(dataSet.PhysicalTableMap[*logicalTable.Source.PhysicalTableId]),
+			logicalTable.DataTransforms,
+		)...)
+	}
+	return columns
+}
+
+func inputColumns(physicalTable types.PhysicalTable) []types.OutputColumn {
+	var inputs []types.InputColumn
+	switch t := physicalTable.(type) {
+	case *types.PhysicalTableMemberRelationalTable:
+		inputs = t.Value.InputColumns
+	case *types.PhysicalTableMemberCustomSql:
+		inputs = t.Value.Columns
+	case *types.PhysicalTableMemberS3Source:
+		inputs = t.Value.InputColumns
+	}
+	columns := make([]types.OutputColumn, 0, len(inputs))
+	for _, input := range inputs {
+		columns = append(columns, types.OutputColumn{
+			Name: aws.String(aws.ToString(input.Name)),
+			Type: outputColumnType(string(input.Type)),
+		})
+	}
+	return columns
+}
+
+func outputColumnType(inputType string) types.ColumnDataType {
+	switch inputType {
+	case "STRING", "JSON":
+		return types.ColumnDataTypeString
+	case "BIT", "BOOLEAN", "INTEGER":
+		return types.ColumnDataTypeInteger
+	case "DECIMAL":
+		return types.ColumnDataTypeDecimal
+	case "DATETIME":
+		return types.ColumnDataTypeDatetime
+	}
+	return types.ColumnDataTypeString
+}
+
+func transformColumns(columns []types.OutputColumn, transforms []types.TransformOperation) []types.OutputColumn {
+	find := func(name string) int {
+		for i, column := range columns {
+			if aws.ToString(column.Name) == name {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, transform := range transforms {
+		switch op := transform.(type) {
+		case *types.TransformOperationMemberRenameColumnOperation:
+			if i := find(aws.ToString(op.Value.ColumnName)); i >= 0 {
+				columns[i].Name = aws.String(aws.ToString(op.Value.NewColumnName))
+			}
+		case *types.TransformOperationMemberCastColumnTypeOperation:
+			if i := find(aws.ToString(op.Value.ColumnName)); i >= 0 {
+				columns[i].Type = types.ColumnDataType(op.Value.NewColumnType)
+			}
+		case *types.TransformOperationMemberTagColumnOperation:
+			if i := find(aws.ToString(op.Value.ColumnName)); i >= 0 {
+				for _, tag := range op.Value.Tags {
+					if tag.ColumnDescription != nil {
+						columns[i].Description = aws.String(aws.ToString(tag.ColumnDescription.Text))
+					}
+				}
+			}
+		case *types.TransformOperationMemberCreateColumnsOperation:
+			for _, column := range op.Value.Columns {
+				columns = append(columns, types.OutputColumn{
+					Name: aws.String(aws.ToString(column.ColumnName)),
+					Type: types.ColumnDataTypeString,
+				})
+			}
+		case *types.TransformOperationMemberProjectOperation:
+			projected := make([]types.OutputColumn, 0, len(op.Value.ProjectedColumns))
+			for _, name := range op.Value.ProjectedColumns {
+				if i := find(name); i >= 0 {
+					projected = append(projected, columns[i])
+				}
+			}
+			columns = projected
+		}
+	}
+	return columns
+}
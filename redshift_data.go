@@ -0,0 +1,297 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata"
+	redshiftdatatypes "github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+	"github.com/jmoiron/sqlx"
+	redshiftdatasqldriver "github.com/mashiike/redshift-data-sql-driver"
+)
+
+// DSN parameters handled by newRedshiftDataClient.
+// The DSN of a secret ARN carries only the ARN, so the cluster (or workgroup) and database are passed as parameters.
+const (
+	dsnParamClusterIdentifier = "cluster_identifier"
+	dsnParamWorkgroupName     = "workgroup_name"
+	dsnParamDatabase          = "database"
+	dsnParamAWSProfile        = "aws_profile"
+	dsnParamRoleArn           = "role_arn"
+)
+
+// redshiftDataClientConstructor creates the Redshift Data API client of the DSN.
+type redshiftDataClientConstructor func(ctx context.Context, cfg *redshiftdatasqldriver.RedshiftDataConfig) (redshiftdatasqldriver.RedshiftDataClient, error)
+
+// openRedshiftData opens the Redshift Data API with the DSN of GetDSN and the clients of newClient.
+// The constructor is passed to the connector, and the global RedshiftDataClientConstructor of the redshift-data driver,
+// that is shared with the other importers of the driver, is left as is.
+func openRedshiftData(dsn string, newClient redshiftDataClientConstructor) (*sqlx.DB, error) {
+	d := &redshiftDataDriver{newClient: newClient}
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	// the DSN of the redshift-data driver, so queryRelation binds the named parameters
+	return sqlx.NewDb(sql.OpenDB(connector), "redshift-data"), nil
+}
+
+// newRedshiftDataClient creates the client with the aws_profile and role_arn parameters of the DSN.
+func newRedshiftDataClient(ctx context.Context, cfg *redshiftdatasqldriver.RedshiftDataConfig) (redshiftdatasqldriver.RedshiftDataClient, error) {
+	// the region is set by RedshiftDataOptFns of the `region` parameter
+	awsCfg, err := loadAWSConfig(ctx, cfg.Params.Get(dsnParamAWSProfile), "", cfg.Params.Get(dsnParamRoleArn))
+	if err != nil {
+		return nil, err
+	}
+	client := redshiftdata.NewFromConfig(awsCfg, cfg.RedshiftDataOptFns...)
+	if cfg.SecretsARN == nil {
+		return client, nil
+	}
+	return &secretRedshiftDataClient{
+		RedshiftDataClient: client,
+		clusterIdentifier:  nillif(cfg.Params.Get(dsnParamClusterIdentifier), ""),
+		workgroupName:      nillif(cfg.Params.Get(dsnParamWorkgroupName), ""),
+		database:           nillif(cfg.Params.Get(dsnParamDatabase), ""),
+	}, nil
+}
+
+// secretRedshiftDataClient fills the cluster (or workgroup) and database of statements executed with a secret ARN.
+type secretRedshiftDataClient struct {
+	redshiftdatasqldriver.RedshiftDataClient
+	clusterIdentifier *string
+	workgroupName     *string
+	database          *string
+}
+
+func (c *secretRedshiftDataClient) ExecuteStatement(ctx context.Context, params *redshiftdata.ExecuteStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.ExecuteStatementOutput, error) {
+	input := *params
+	if input.ClusterIdentifier == nil && input.WorkgroupName == nil {
+		input.ClusterIdentifier = c.clusterIdentifier
+		input.WorkgroupName = c.workgroupName
+	}
+	if input.Database == nil {
+		input.Database = c.database
+	}
+	return c.RedshiftDataClient.ExecuteStatement(ctx, &input, optFns...)
+}
+
+func setDSNParam(cfg *redshiftdatasqldriver.RedshiftDataConfig, key string, value string) {
+	if cfg.Params == nil {
+		cfg.Params = url.Values{}
+	}
+	cfg.Params.Set(key, value)
+}
+
+// redshiftDataDriver is the read only driver of the Redshift Data API with the clients of newClient.
+// It supports the queries of the catalogs, without transactions, prepared statements and Exec.
+type redshiftDataDriver struct {
+	newClient redshiftDataClientConstructor
+}
+
+func (d *redshiftDataDriver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.Connect(context.Background())
+}
+
+func (d *redshiftDataDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := redshiftdatasqldriver.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &redshiftDataConnector{d: d, cfg: cfg}, nil
+}
+
+type redshiftDataConnector struct {
+	d   *redshiftDataDriver
+	cfg *redshiftdatasqldriver.RedshiftDataConfig
+}
+
+func (c *redshiftDataConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	client, err := c.d.newClient(ctx, c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &redshiftDataConn{client: client, cfg: c.cfg}, nil
+}
+
+func (c *redshiftDataConnector) Driver() driver.Driver {
+	return c.d
+}
+
+// defaults of the timeout and polling interval of the statements, the same as the redshift-data driver.
+const (
+	defaultRedshiftDataTimeout = 15 * time.Minute
+	defaultRedshiftDataPolling = 10 * time.Millisecond
+)
+
+var errRedshiftDataNotSupported = errors.New("not supported by the redshift data api")
+
+type redshiftDataConn struct {
+	client redshiftdatasqldriver.RedshiftDataClient
+	cfg    *redshiftdatasqldriver.RedshiftDataConfig
+}
+
+func (conn *redshiftDataConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("prepared statement %w", errRedshiftDataNotSupported)
+}
+
+func (conn *redshiftDataConn) Close() error {
+	return nil
+}
+
+func (conn *redshiftDataConn) Begin() (driver.Tx, error) {
+	return nil, fmt.Errorf("transaction %w", errRedshiftDataNotSupported)
+}
+
+// QueryContext executes the statement with the named parameters (`:name`) and waits for the result.
+// The statement is cancelled if ctx is done before it finishes.
+func (conn *redshiftDataConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	params := make([]redshiftdatatypes.SqlParameter, 0, len(args))
+	for _, arg := range args {
+		if arg.Name == "" {
+			return nil, fmt.Errorf("positional parameter $%d %w, use named parameters", arg.Ordinal, errRedshiftDataNotSupported)
+		}
+		params = append(params, redshiftdatatypes.SqlParameter{
+			Name:  aws.String(arg.Name),
+			Value: aws.String(fmt.Sprintf("%v", arg.Value)),
+		})
+	}
+	timeout := conn.cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultRedshiftDataTimeout
+	}
+	polling := conn.cfg.Polling
+	if polling == 0 {
+		polling = defaultRedshiftDataPolling
+	}
+	statementCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	input := &redshiftdata.ExecuteStatementInput{
+		Sql:               aws.String(query),
+		ClusterIdentifier: conn.cfg.ClusterIdentifier,
+		Database:          conn.cfg.Database,
+		DbUser:            conn.cfg.DbUser,
+		WorkgroupName:     conn.cfg.WorkgroupName,
+		SecretArn:         conn.cfg.SecretsARN,
+	}
+	if len(params) > 0 {
+		input.Parameters = params
+	}
+	executed, err := conn.client.ExecuteStatement(statementCtx, input)
+	if err != nil {
+		return nil, fmt.Errorf("ExecuteStatement: %w", err)
+	}
+	id := aws.ToString(executed.Id)
+	for {
+		described, err := conn.client.DescribeStatement(statementCtx, &redshiftdata.DescribeStatementInput{Id: executed.Id})
+		if err != nil {
+			conn.cancelStatement(id)
+			return nil, fmt.Errorf("DescribeStatement: %w", err)
+		}
+		switch described.Status {
+		case redshiftdatatypes.StatusStringFinished:
+			if !aws.ToBool(described.HasResultSet) {
+				return &redshiftDataRows{}, nil
+			}
+			rows := &redshiftDataRows{
+				ctx: ctx,
+				p:   redshiftdata.NewGetStatementResultPaginator(conn.client, &redshiftdata.GetStatementResultInput{Id: executed.Id}),
+			}
+			if err := rows.nextPage(); err != nil {
+				return nil, err
+			}
+			return rows, nil
+		case redshiftdatatypes.StatusStringFailed, redshiftdatatypes.StatusStringAborted:
+			return nil, fmt.Errorf("statement %s %s: %s", id, described.Status, aws.ToString(described.Error))
+		}
+		select {
+		case <-statementCtx.Done():
+			conn.cancelStatement(id)
+			return nil, statementCtx.Err()
+		case <-time.After(polling):
+		}
+	}
+}
+
+func (conn *redshiftDataConn) cancelStatement(id string) {
+	log.Printf("[debug] cancel statement %s", id)
+	if _, err := conn.client.CancelStatement(context.Background(), &redshiftdata.CancelStatementInput{Id: aws.String(id)}); err != nil {
+		log.Printf("[warn] failed to cancel statement %s: %s", id, err)
+	}
+}
+
+// redshiftDataRows reads the pages of GetStatementResult.
+type redshiftDataRows struct {
+	ctx     context.Context
+	p       *redshiftdata.GetStatementResultPaginator
+	columns []string
+	records [][]redshiftdatatypes.Field
+}
+
+func (rows *redshiftDataRows) nextPage() error {
+	output, err := rows.p.NextPage(rows.ctx)
+	if err != nil {
+		return fmt.Errorf("GetStatementResult: %w", err)
+	}
+	if rows.columns == nil {
+		rows.columns = make([]string, 0, len(output.ColumnMetadata))
+		for _, column := range output.ColumnMetadata {
+			rows.columns = append(rows.columns, aws.ToString(column.Name))
+		}
+	}
+	rows.records = output.Records
+	return nil
+}
+
+func (rows *redshiftDataRows) Columns() []string {
+	return rows.columns
+}
+
+func (rows *redshiftDataRows) Close() error {
+	return nil
+}
+
+func (rows *redshiftDataRows) Next(dest []driver.Value) error {
+	for len(rows.records) == 0 {
+		if rows.p == nil || !rows.p.HasMorePages() {
+			return io.EOF
+		}
+		if err := rows.nextPage(); err != nil {
+			return err
+		}
+	}
+	record := rows.records[0]
+	rows.records = rows.records[1:]
+	for i := range dest {
+		if i >= len(record) {
+			dest[i] = nil
+			continue
+		}
+		switch field := record[i].(type) {
+		case *redshiftdatatypes.FieldMemberStringValue:
+			dest[i] = field.Value
+		case *redshiftdatatypes.FieldMemberLongValue:
+			dest[i] = field.Value
+		case *redshiftdatatypes.FieldMemberDoubleValue:
+			dest[i] = field.Value
+		case *redshiftdatatypes.FieldMemberBooleanValue:
+			dest[i] = field.Value
+		case *redshiftdatatypes.FieldMemberBlobValue:
+			dest[i] = field.Value
+		default:
+			dest[i] = nil
+		}
+	}
+	return nil
+}
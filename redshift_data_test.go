@@ -0,0 +1,147 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftdata/types"
+	redshiftdatasqldriver "github.com/mashiike/redshift-data-sql-driver"
+)
+
+// stubRedshiftData is the Redshift Data API whose statements finish after describing statuses,
+// and return the pages of records.
+type stubRedshiftData struct {
+	statuses  []types.StatusString
+	pages     []*redshiftdata.GetStatementResultOutput
+	executed  []*redshiftdata.ExecuteStatementInput
+	cancelled int
+}
+
+func (c *stubRedshiftData) ExecuteStatement(ctx context.Context, params *redshiftdata.ExecuteStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.ExecuteStatementOutput, error) {
+	c.executed = append(c.executed, params)
+	return &redshiftdata.ExecuteStatementOutput{Id: aws.String("statement-1")}, nil
+}
+
+func (c *stubRedshiftData) DescribeStatement(ctx context.Context, params *redshiftdata.DescribeStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.DescribeStatementOutput, error) {
+	status := c.statuses[0]
+	if len(c.statuses) > 1 {
+		c.statuses = c.statuses[1:]
+	}
+	return &redshiftdata.DescribeStatementOutput{
+		Id:           params.Id,
+		Status:       status,
+		HasResultSet: aws.Bool(len(c.pages) > 0),
+		Error:        aws.String("relation does not exist"),
+	}, nil
+}
+
+func (c *stubRedshiftData) CancelStatement(ctx context.Context, params *redshiftdata.CancelStatementInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.CancelStatementOutput, error) {
+	c.cancelled++
+	return &redshiftdata.CancelStatementOutput{Status: aws.Bool(true)}, nil
+}
+
+func (c *stubRedshiftData) GetStatementResult(ctx context.Context, params *redshiftdata.GetStatementResultInput, optFns ...func(*redshiftdata.Options)) (*redshiftdata.GetStatementResultOutput, error) {
+	i := 0
+	if params.NextToken != nil {
+		i, _ = strconv.Atoi(*params.NextToken)
+	}
+	page := *c.pages[i]
+	if i+1 < len(c.pages) {
+		page.NextToken = aws.String(strconv.Itoa(i + 1))
+	}
+	return &page, nil
+}
+
+func (c *stubRedshiftData) constructor(ctx context.Context, cfg *redshiftdatasqldriver.RedshiftDataConfig) (redshiftdatasqldriver.RedshiftDataClient, error) {
+	return c, nil
+}
+
+func testColumnRecord(columnName, name string) []types.Field {
+	return []types.Field{
+		&types.FieldMemberStringValue{Value: columnName},
+		&types.FieldMemberStringValue{Value: name},
+		&types.FieldMemberIsNull{Value: true},
+		&types.FieldMemberStringValue{Value: "character varying(256)"},
+	}
+}
+
+func TestOpenRedshiftData(t *testing.T) {
+	metadata := []types.ColumnMetadata{{Name: aws.String("column_name")}, {Name: aws.String("name")}, {Name: aws.String("description")}, {Name: aws.String("data_type")}}
+	client := &stubRedshiftData{
+		statuses: []types.StatusString{types.StatusStringSubmitted, types.StatusStringStarted, types.StatusStringFinished},
+		pages: []*redshiftdata.GetStatementResultOutput{
+			{ColumnMetadata: metadata, Records: [][]types.Field{testColumnRecord("id", "User ID")}},
+			{ColumnMetadata: metadata, Records: [][]types.Field{testColumnRecord("pref_code", "Prefecture")}},
+		},
+	}
+	db, err := openRedshiftData("admin@cluster(example)/dev?polling=1ms", client.constructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	annotations, err := QueryColumnAnnotations(context.Background(), db, "public", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.ToString(annotations["pref_code"].Name); got != "Prefecture" {
+		t.Errorf("name of pref_code = %q, want Prefecture", got)
+	}
+	if got := aws.ToString(annotations["id"].Name); got != "User ID" {
+		t.Errorf("name of id = %q, want User ID", got)
+	}
+	if redshiftdatasqldriver.RedshiftDataClientConstructor != nil {
+		t.Error("the global constructor of the redshift-data driver is replaced")
+	}
+
+	if len(client.executed) != 1 {
+		t.Fatalf("executed = %d, want 1", len(client.executed))
+	}
+	input := client.executed[0]
+	if aws.ToString(input.ClusterIdentifier) != "example" || aws.ToString(input.DbUser) != "admin" || aws.ToString(input.Database) != "dev" {
+		t.Errorf("cluster, user and database = %s, %s, %s, want example, admin, dev", aws.ToString(input.ClusterIdentifier), aws.ToString(input.DbUser), aws.ToString(input.Database))
+	}
+	parameters := make(map[string]string)
+	for _, p := range input.Parameters {
+		parameters[aws.ToString(p.Name)] = aws.ToString(p.Value)
+	}
+	if want := map[string]string{"schema": "public", "table": "users"}; !reflect.DeepEqual(parameters, want) {
+		t.Errorf("parameters = %v, want %v", parameters, want)
+	}
+}
+
+func TestOpenRedshiftDataFailed(t *testing.T) {
+	client := &stubRedshiftData{statuses: []types.StatusString{types.StatusStringFailed}}
+	db, err := openRedshiftData("admin@cluster(example)/dev?polling=1ms", client.constructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := QueryTableComment(context.Background(), db, "public", "users"); err == nil || !strings.Contains(err.Error(), "FAILED: relation does not exist") {
+		t.Errorf("error = %v, want the statement failed", err)
+	}
+
+	// the statement running at the timeout is cancelled
+	client = &stubRedshiftData{statuses: []types.StatusString{types.StatusStringStarted}}
+	db, err = openRedshiftData("admin@cluster(example)/dev?polling=1ms&timeout=20ms", client.constructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	start := time.Now()
+	if _, err := QueryTableComment(context.Background(), db, "public", "users"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("elapsed = %s, want the timeout", elapsed)
+	}
+	if client.cancelled != 1 {
+		t.Errorf("cancelled = %d, want 1", client.cancelled)
+	}
+}
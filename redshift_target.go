@@ -0,0 +1,173 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/aws/aws-sdk-go-v2/service/redshift"
+	"github.com/aws/aws-sdk-go-v2/service/redshiftserverless"
+)
+
+// redshiftTarget is the provisioned cluster or serverless workgroup of a data source.
+type redshiftTarget struct {
+	Host              string
+	DataSourceID      string
+	DataSourceArn     string
+	ClusterIdentifier string
+	WorkgroupName     string
+}
+
+func (target *redshiftTarget) String() string {
+	switch {
+	case target.ClusterIdentifier != "":
+		return fmt.Sprintf("cluster %s (%s)", target.ClusterIdentifier, target.Host)
+	case target.WorkgroupName != "":
+		return fmt.Sprintf("workgroup %s (%s)", target.WorkgroupName, target.Host)
+	default:
+		return target.Host
+	}
+}
+
+// redshiftProfile returns the profile and the cluster (or workgroup) of the Redshift data source.
+func (app *App) redshiftProfile(ctx context.Context, ds *types.DataSource) (*ProfileConfig, *redshiftTarget, error) {
+	target, err := app.resolveRedshiftTarget(ctx, ds)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app.cfg.lookupTarget(target), target, nil
+}
+
+// resolveRedshiftTarget resolves the cluster identifier or workgroup name of the data source.
+// The ClusterId of the data source and the standard endpoint hostnames are used as is,
+// and others (VPC endpoints, custom domain names, etc.) are resolved by the Redshift and Redshift Serverless APIs
+// only if `cluster:` or `workgroup:` profiles could match them.
+func (app *App) resolveRedshiftTarget(ctx context.Context, ds *types.DataSource) (*redshiftTarget, error) {
+	parameters, ok := ds.DataSourceParameters.(*types.DataSourceParametersMemberRedshiftParameters)
+	if !ok {
+		return nil, errors.New("data source is not redshift")
+	}
+	dataSourceArn := coalesce(ds.Arn)
+	if target, ok := app.redshiftTargetCache[dataSourceArn]; ok {
+		return target, nil
+	}
+	target := &redshiftTarget{
+		Host:              coalesce(parameters.Value.Host),
+		DataSourceID:      coalesce(ds.DataSourceId),
+		DataSourceArn:     dataSourceArn,
+		ClusterIdentifier: coalesce(parameters.Value.ClusterId),
+	}
+	switch {
+	case target.ClusterIdentifier != "":
+	case isProvisoned(target.Host):
+		target.ClusterIdentifier = getCluseterID(target.Host)
+	case isServeless(target.Host):
+		target.WorkgroupName = getWorkgroupName(target.Host)
+	case !app.cfg.needsRedshiftTarget(target):
+		// no `cluster:` or `workgroup:` profile could match, so the Redshift APIs are not called
+		log.Printf("[debug] skip resolving the cluster or workgroup of %s, use the profile of the host", target.Host)
+	default:
+		// the profile matched by the host or data source tells the account of the cluster
+		awsCfg, err := app.redshiftAWSConfig(ctx, app.cfg.lookupTarget(target))
+		if err != nil {
+			return nil, err
+		}
+		if err := lookupRedshiftEndpoint(ctx, awsCfg, target); err != nil {
+			return nil, fmt.Errorf("failed to resolve the cluster or workgroup of %s, that is required to match `%s` or `%s` profiles: %w", target.Host, profileNameCluster, profileNameWorkgroup, err)
+		}
+	}
+	log.Printf("[debug] data source %s is %s", target.DataSourceID, target)
+	app.redshiftTargetCache[dataSourceArn] = target
+	return target, nil
+}
+
+// lookupRedshiftEndpoint finds the cluster or workgroup whose endpoint, VPC endpoint or custom domain name is the host.
+func lookupRedshiftEndpoint(ctx context.Context, awsCfg aws.Config, target *redshiftTarget) error {
+	var errs []error
+	redshiftClient := redshift.NewFromConfig(awsCfg)
+	clusters := redshift.NewDescribeClustersPaginator(redshiftClient, &redshift.DescribeClustersInput{})
+	for clusters.HasMorePages() {
+		output, err := clusters.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DescribeClusters: %w", err))
+			break
+		}
+		for _, cluster := range output.Clusters {
+			if target.matchHost(cluster.CustomDomainName) || (cluster.Endpoint != nil && target.matchHost(cluster.Endpoint.Address)) {
+				target.ClusterIdentifier = coalesce(cluster.ClusterIdentifier)
+				return nil
+			}
+		}
+	}
+	endpoints := redshift.NewDescribeEndpointAccessPaginator(redshiftClient, &redshift.DescribeEndpointAccessInput{})
+	for endpoints.HasMorePages() {
+		output, err := endpoints.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DescribeEndpointAccess: %w", err))
+			break
+		}
+		for _, endpoint := range output.EndpointAccessList {
+			if target.matchHost(endpoint.Address) {
+				target.ClusterIdentifier = coalesce(endpoint.ClusterIdentifier)
+				return nil
+			}
+		}
+	}
+	serverlessClient := redshiftserverless.NewFromConfig(awsCfg)
+	workgroups := redshiftserverless.NewListWorkgroupsPaginator(serverlessClient, &redshiftserverless.ListWorkgroupsInput{})
+	for workgroups.HasMorePages() {
+		output, err := workgroups.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ListWorkgroups: %w", err))
+			break
+		}
+		for _, workgroup := range output.Workgroups {
+			if target.matchHost(workgroup.CustomDomainName) || (workgroup.Endpoint != nil && target.matchHost(workgroup.Endpoint.Address)) {
+				target.WorkgroupName = coalesce(workgroup.WorkgroupName)
+				return nil
+			}
+		}
+	}
+	serverlessEndpoints := redshiftserverless.NewListEndpointAccessPaginator(serverlessClient, &redshiftserverless.ListEndpointAccessInput{})
+	for serverlessEndpoints.HasMorePages() {
+		output, err := serverlessEndpoints.NextPage(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ListEndpointAccess: %w", err))
+			break
+		}
+		for _, endpoint := range output.Endpoints {
+			if target.matchHost(endpoint.Address) {
+				target.WorkgroupName = coalesce(endpoint.WorkgroupName)
+				return nil
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return fmt.Errorf("no cluster or workgroup has the endpoint %s", target.Host)
+}
+
+// needsRedshiftTarget reports whether a `cluster:` or `workgroup:` profile could be matched by the target,
+// that is, such profiles exist and no profile of the data source or the host takes precedence over them.
+func (cfg Config) needsRedshiftTarget(target *redshiftTarget) bool {
+	for _, name := range []string{target.DataSourceArn, profileNameDataSource + target.DataSourceID, target.Host} {
+		if profile, ok := cfg.Get(name); ok && profile != nil {
+			return false
+		}
+	}
+	for name, profile := range cfg {
+		if profile != nil && (strings.HasPrefix(name, profileNameCluster) || strings.HasPrefix(name, profileNameWorkgroup)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (target *redshiftTarget) matchHost(address *string) bool {
+	return address != nil && strings.EqualFold(*address, target.Host)
+}
@@ -0,0 +1,459 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+type ReportOption struct {
+	DataSetID    []string `help:"data set ID to report, can be repeated"`
+	DataSourceID string   `help:"Report all data sets using the data source, instead of --data-set-id"`
+	Schema       string   `help:"With --data-source-id, report only data sets using a table in the schema"`
+	Table        string   `help:"With --data-source-id, report only data sets using the table"`
+	Format       []string `help:"output formats, markdown and html" default:"markdown,html"`
+	OutputDir    string   `help:"output directory of the pages" type:"path" default:"report"`
+}
+
+const (
+	reportFormatMarkdown = "markdown"
+	reportFormatHTML     = "html"
+)
+
+// DataSetReport is a page of the data dictionary.
+type DataSetReport struct {
+	DataSetID       string
+	Name            string
+	Arn             string
+	ImportMode      string
+	LastUpdatedTime *time.Time
+	Sources         []*SourceReport
+	Parameters      []*ParameterReport
+	Fields          []*FieldReport
+}
+
+// SourceReport is a relation of Redshift read by the data set. Description is the comment of the relation.
+type SourceReport struct {
+	DataSourceID string
+	Schema       string
+	Table        string
+	Description  string
+}
+
+// ParameterReport is a parameter of the data set.
+type ParameterReport struct {
+	Name          string
+	Type          string
+	ValueType     string
+	DefaultValues []string
+}
+
+// FieldReport is a field of the data set.
+// Source (schema.table.column) and RedshiftType are empty for calculated fields and fields of custom SQL.
+type FieldReport struct {
+	Name           string
+	Source         string
+	RedshiftType   string
+	Description    string
+	CastType       string
+	GeographicRole string
+	Folder         string
+	Calculated     bool
+	Expression     string
+}
+
+func (app *App) RunReport(ctx context.Context, opt *ReportOption) error {
+	if len(opt.DataSetID) == 0 {
+		merged := *opt
+		merged.DataSourceID, merged.Schema, merged.Table = app.settings.selectDataSource(opt.DataSourceID, opt.Schema, opt.Table)
+		opt = &merged
+	}
+	switch {
+	case len(opt.DataSetID) > 0 && opt.DataSourceID != "":
+		return errors.New("--data-set-id and --data-source-id can not be used together")
+	case len(opt.DataSetID) == 0 && opt.DataSourceID == "":
+		return errors.New("--data-set-id or --data-source-id is required")
+	case opt.DataSourceID == "" && (opt.Schema != "" || opt.Table != ""):
+		return errors.New("--schema and --table require --data-source-id")
+	}
+	for _, format := range opt.Format {
+		if format != reportFormatMarkdown && format != reportFormatHTML {
+			return fmt.Errorf("unknown format `%s`, must be %s or %s", format, reportFormatMarkdown, reportFormatHTML)
+		}
+	}
+	dataSetIDs := opt.DataSetID
+	if opt.DataSourceID != "" {
+		var failed []string
+		var err error
+		dataSetIDs, failed, err = app.findDataSetsByDataSource(ctx, opt.DataSourceID, opt.Schema, opt.Table)
+		if err != nil {
+			return err
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to describe %d data set(s): %s", len(failed), strings.Join(failed, ", "))
+		}
+		log.Printf("[info] found %d data set(s) using data source %s", len(dataSetIDs), opt.DataSourceID)
+	}
+	reports := make([]*DataSetReport, 0, len(dataSetIDs))
+	for _, dataSetID := range dataSetIDs {
+		report, err := app.ReportDataSet(ctx, dataSetID)
+		if err != nil {
+			return fmt.Errorf("data set %s: %w", dataSetID, err)
+		}
+		reports = append(reports, report)
+	}
+	if err := os.MkdirAll(opt.OutputDir, 0755); err != nil {
+		return err
+	}
+	for _, format := range lo.Uniq(opt.Format) {
+		ext, render := ".md", renderMarkdownReport
+		if format == reportFormatHTML {
+			ext, render = ".html", renderHTMLReport
+		}
+		for _, report := range reports {
+			if err := writeReport(filepath.Join(opt.OutputDir, report.DataSetID+ext), report, render); err != nil {
+				return err
+			}
+		}
+		if err := writeReport(filepath.Join(opt.OutputDir, "index"+ext), reports, render); err != nil {
+			return err
+		}
+	}
+	log.Printf("[info] wrote the data dictionary of %d data set(s) to %s", len(reports), opt.OutputDir)
+	return nil
+}
+
+func writeReport(path string, data interface{}, render func(io.Writer, interface{}) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := render(f, data); err != nil {
+		return fmt.Errorf("render %s: %w", path, err)
+	}
+	log.Printf("[debug] wrote %s", path)
+	return f.Close()
+}
+
+// ReportDataSet reads the data set and the catalog of the Redshift relations in the same way as annotate,
+// and returns the page of the data dictionary.
+func (app *App) ReportDataSet(ctx context.Context, dataSetID string) (*DataSetReport, error) {
+	described, err := app.describeDataSet(ctx, aws.String(app.AWSAccountID()), dataSetID)
+	if err != nil {
+		return nil, err
+	}
+	catalogs := make(map[string]*relationCatalog)
+	for physicalTableID, physicalTable := range described.DataSet.PhysicalTableMap {
+		relationalTable, ok := physicalTable.(*types.PhysicalTableMemberRelationalTable)
+		if !ok {
+			continue
+		}
+		describeDataSourceOutput, err := app.DescribeDataSrouce(ctx, coalesce(relationalTable.Value.DataSourceArn))
+		if err != nil {
+			return nil, fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
+		}
+		if describeDataSourceOutput.DataSource.Type != types.DataSourceTypeRedshift {
+			log.Printf("[debug] physical table `%s` data source type is not redshift. type is `%s`", physicalTableID, describeDataSourceOutput.DataSource.Type)
+			continue
+		}
+		catalog, err := app.getRelationCatalog(ctx, describeDataSourceOutput.DataSource, relationalTable.Value, true)
+		if err != nil {
+			return nil, fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
+		}
+		catalogs[physicalTableID] = catalog
+	}
+	return newDataSetReport(described.DataSet, catalogs), nil
+}
+
+// newDataSetReport builds the page of the data set. catalogs are keyed by the physical table ID.
+// The fields are ordered by the output columns of the data set, and the hidden fields are not listed.
+func newDataSetReport(dataSet *types.DataSet, catalogs map[string]*relationCatalog) *DataSetReport {
+	report := &DataSetReport{
+		DataSetID:       coalesce(dataSet.DataSetId),
+		Name:            coalesce(dataSet.Name),
+		Arn:             coalesce(dataSet.Arn),
+		ImportMode:      string(dataSet.ImportMode),
+		LastUpdatedTime: dataSet.LastUpdatedTime,
+		Sources:         make([]*SourceReport, 0),
+		Parameters:      newParameterReports(dataSet.DatasetParameters),
+		Fields:          make([]*FieldReport, 0),
+	}
+	folders := make(map[string]string)
+	for path, folder := range dataSet.FieldFolders {
+		for _, column := range folder.Columns {
+			folders[column] = path
+		}
+	}
+	fields := make(map[string]*FieldReport)
+	addField := func(trace *fieldTrace, field *FieldReport) {
+		if !trace.Visible {
+			return
+		}
+		field.Name = trace.Name
+		// the description of the data set is preferred, as analysts see it in QuickSight
+		field.Description = coalesce(nillif(trace.Description, ""), &field.Description)
+		field.CastType = string(trace.CastType)
+		field.GeographicRole = string(trace.GeographicRole)
+		field.Folder = folders[trace.Name]
+		fields[trace.Name] = field
+	}
+
+	physicalTableIDs := lo.Keys(dataSet.PhysicalTableMap)
+	sort.Strings(physicalTableIDs)
+	for _, physicalTableID := range physicalTableIDs {
+		relationalTable, ok := dataSet.PhysicalTableMap[physicalTableID].(*types.PhysicalTableMemberRelationalTable)
+		if !ok {
+			continue
+		}
+		source := &SourceReport{
+			DataSourceID: dataSourceIDOf(coalesce(relationalTable.Value.DataSourceArn)),
+			Schema:       coalesce(relationalTable.Value.Schema),
+			Table:        coalesce(relationalTable.Value.Name),
+		}
+		if catalog, ok := catalogs[physicalTableID]; ok {
+			source.Description = strings.TrimSpace(coalesce(catalog.Comment))
+		}
+		report.Sources = append(report.Sources, source)
+	}
+	for _, sourceField := range sourceFields(dataSet) {
+		field := &FieldReport{
+			Source: sourceField.Source(),
+		}
+		if catalog, ok := catalogs[sourceField.PhysicalTableID]; ok {
+			if annotation, ok := catalog.Columns[sourceField.Column]; ok {
+				field.RedshiftType = coalesce(annotation.DataType)
+				field.Description = coalesce(annotation.Description)
+			}
+		}
+		addField(sourceField.Trace, field)
+	}
+	for logicalTableID, logicalTable := range dataSet.LogicalTableMap {
+		for i, transform := range logicalTable.DataTransforms {
+			op, ok := transform.(*types.TransformOperationMemberCreateColumnsOperation)
+			if !ok {
+				continue
+			}
+			for _, column := range op.Value.Columns {
+				addField(traceField(dataSet, logicalTableID, i+1, coalesce(column.ColumnName)), &FieldReport{
+					Calculated: true,
+					Expression: coalesce(column.Expression),
+				})
+			}
+		}
+	}
+
+	for _, column := range dataSet.OutputColumns {
+		if field, ok := fields[coalesce(column.Name)]; ok {
+			report.Fields = append(report.Fields, field)
+			delete(fields, coalesce(column.Name))
+		}
+	}
+	names := lo.Keys(fields)
+	sort.Strings(names)
+	for _, name := range names {
+		report.Fields = append(report.Fields, fields[name])
+	}
+	return report
+}
+
+func newParameterReports(parameters []types.DatasetParameter) []*ParameterReport {
+	reports := make([]*ParameterReport, 0, len(parameters))
+	for _, parameter := range parameters {
+		var report *ParameterReport
+		switch {
+		case parameter.StringDatasetParameter != nil:
+			p := parameter.StringDatasetParameter
+			report = &ParameterReport{Name: coalesce(p.Name), Type: "String", ValueType: string(p.ValueType)}
+			if p.DefaultValues != nil {
+				report.DefaultValues = p.DefaultValues.StaticValues
+			}
+		case parameter.IntegerDatasetParameter != nil:
+			p := parameter.IntegerDatasetParameter
+			report = &ParameterReport{Name: coalesce(p.Name), Type: "Integer", ValueType: string(p.ValueType)}
+			if p.DefaultValues != nil {
+				report.DefaultValues = lo.Map(p.DefaultValues.StaticValues, func(v int64, _ int) string {
+					return strconv.FormatInt(v, 10)
+				})
+			}
+		case parameter.DecimalDatasetParameter != nil:
+			p := parameter.DecimalDatasetParameter
+			report = &ParameterReport{Name: coalesce(p.Name), Type: "Decimal", ValueType: string(p.ValueType)}
+			if p.DefaultValues != nil {
+				report.DefaultValues = lo.Map(p.DefaultValues.StaticValues, func(v float64, _ int) string {
+					return strconv.FormatFloat(v, 'f', -1, 64)
+				})
+			}
+		case parameter.DateTimeDatasetParameter != nil:
+			p := parameter.DateTimeDatasetParameter
+			report = &ParameterReport{Name: coalesce(p.Name), Type: "DateTime", ValueType: string(p.ValueType)}
+			if p.DefaultValues != nil {
+				report.DefaultValues = lo.Map(p.DefaultValues.StaticValues, func(v time.Time, _ int) string {
+					return v.Format(time.RFC3339)
+				})
+			}
+		default:
+			continue
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// markdownCell escapes the value for a cell of a Markdown table.
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", `\|`)
+	return strings.ReplaceAll(strings.TrimSpace(value), "\n", "<br>")
+}
+
+const markdownReportTemplate = `{{ define "index" -}}
+# Data dictionary
+
+| Data set | Import mode | Fields | Sources |
+|---|---|---|---|
+{{ range . -}}
+| [{{ cell .Name }}]({{ .DataSetID }}.md) | {{ .ImportMode }} | {{ len .Fields }} | {{ range $i, $s := .Sources }}{{ if $i }}, {{ end }}` + "`{{ $s.Schema }}.{{ $s.Table }}`" + `{{ end }} |
+{{ end -}}
+{{ end -}}
+
+{{ define "data_set" -}}
+# {{ .Name }}
+
+- Data set ID: ` + "`{{ .DataSetID }}`" + `
+- Import mode: {{ .ImportMode }}
+{{- if .LastUpdatedTime }}
+- Last updated: {{ .LastUpdatedTime.Format "2006-01-02 15:04:05 MST" }}
+{{- end }}
+
+## Sources
+
+| Relation | Data source | Description |
+|---|---|---|
+{{ range .Sources -}}
+| ` + "`{{ .Schema }}.{{ .Table }}`" + ` | {{ .DataSourceID }} | {{ cell .Description }} |
+{{ end -}}
+{{ if .Parameters }}
+## Parameters
+
+| Name | Type | Value type | Default values |
+|---|---|---|---|
+{{ range .Parameters -}}
+| {{ cell .Name }} | {{ .Type }} | {{ .ValueType }} | {{ cell (join .DefaultValues ", ") }} |
+{{ end -}}
+{{ end }}
+## Fields
+
+| Field | Source | Redshift type | Description | Cast type | Geographic role | Folder | Calculated |
+|---|---|---|---|---|---|---|---|
+{{ range .Fields -}}
+| {{ cell .Name }} | {{ if .Source }}` + "`{{ .Source }}`" + `{{ end }} | {{ .RedshiftType }} | {{ cell .Description }} | {{ .CastType }} | {{ .GeographicRole }} | {{ cell .Folder }} | {{ if .Calculated }}yes: ` + "`{{ cell .Expression }}`" + `{{ end }} |
+{{ end -}}
+{{ end -}}
+`
+
+const htmlReportTemplate = `{{ define "head" -}}
+<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ . }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+td.description { white-space: pre-wrap; }
+</style>
+</head>
+<body>
+{{ end -}}
+
+{{ define "index" -}}
+{{ template "head" "Data dictionary" -}}
+<h1>Data dictionary</h1>
+<table>
+<tr><th>Data set</th><th>Import mode</th><th>Fields</th><th>Sources</th></tr>
+{{ range . -}}
+<tr><td><a href="{{ .DataSetID }}.html">{{ .Name }}</a></td><td>{{ .ImportMode }}</td><td>{{ len .Fields }}</td><td>{{ range $i, $s := .Sources }}{{ if $i }}, {{ end }}<code>{{ $s.Schema }}.{{ $s.Table }}</code>{{ end }}</td></tr>
+{{ end -}}
+</table>
+</body>
+</html>
+{{ end -}}
+
+{{ define "data_set" -}}
+{{ template "head" .Name -}}
+<h1>{{ .Name }}</h1>
+<ul>
+<li>Data set ID: <code>{{ .DataSetID }}</code></li>
+<li>Import mode: {{ .ImportMode }}</li>
+{{- if .LastUpdatedTime }}
+<li>Last updated: {{ .LastUpdatedTime.Format "2006-01-02 15:04:05 MST" }}</li>
+{{- end }}
+</ul>
+<h2>Sources</h2>
+<table>
+<tr><th>Relation</th><th>Data source</th><th>Description</th></tr>
+{{ range .Sources -}}
+<tr><td><code>{{ .Schema }}.{{ .Table }}</code></td><td>{{ .DataSourceID }}</td><td class="description">{{ .Description }}</td></tr>
+{{ end -}}
+</table>
+{{- if .Parameters }}
+<h2>Parameters</h2>
+<table>
+<tr><th>Name</th><th>Type</th><th>Value type</th><th>Default values</th></tr>
+{{ range .Parameters -}}
+<tr><td>{{ .Name }}</td><td>{{ .Type }}</td><td>{{ .ValueType }}</td><td>{{ join .DefaultValues ", " }}</td></tr>
+{{ end -}}
+</table>
+{{- end }}
+<h2>Fields</h2>
+<table>
+<tr><th>Field</th><th>Source</th><th>Redshift type</th><th>Description</th><th>Cast type</th><th>Geographic role</th><th>Folder</th><th>Calculated</th></tr>
+{{ range .Fields -}}
+<tr><td>{{ .Name }}</td><td>{{ if .Source }}<code>{{ .Source }}</code>{{ end }}</td><td>{{ .RedshiftType }}</td><td class="description">{{ .Description }}</td><td>{{ .CastType }}</td><td>{{ .GeographicRole }}</td><td>{{ .Folder }}</td><td>{{ if .Calculated }}yes: <code>{{ .Expression }}</code>{{ end }}</td></tr>
+{{ end -}}
+</table>
+</body>
+</html>
+{{ end -}}
+`
+
+var (
+	markdownReport = template.Must(template.New("report").Funcs(template.FuncMap{
+		"cell": markdownCell,
+		"join": strings.Join,
+	}).Parse(markdownReportTemplate))
+	htmlReport = htmltemplate.Must(htmltemplate.New("report").Funcs(htmltemplate.FuncMap{
+		"join": strings.Join,
+	}).Parse(htmlReportTemplate))
+)
+
+// renderMarkdownReport renders the index page for []*DataSetReport, and the page of the data set for *DataSetReport.
+func renderMarkdownReport(w io.Writer, data interface{}) error {
+	if _, ok := data.([]*DataSetReport); ok {
+		return markdownReport.ExecuteTemplate(w, "index", data)
+	}
+	return markdownReport.ExecuteTemplate(w, "data_set", data)
+}
+
+// renderHTMLReport is the HTML version of renderMarkdownReport.
+func renderHTMLReport(w io.Writer, data interface{}) error {
+	if _, ok := data.([]*DataSetReport); ok {
+		return htmlReport.ExecuteTemplate(w, "index", data)
+	}
+	return htmlReport.ExecuteTemplate(w, "data_set", data)
+}
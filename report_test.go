@@ -0,0 +1,152 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestNewDataSetReport(t *testing.T) {
+	dataSet := testDataSet("users",
+		testRename("pref_code", "Prefecture"),
+		&types.TransformOperationMemberCastColumnTypeOperation{
+			Value: types.CastColumnTypeOperation{ColumnName: aws.String("Prefecture"), NewColumnType: types.ColumnDataTypeInteger},
+		},
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{ColumnName: aws.String("Prefecture"), Tags: []types.ColumnTag{
+				{ColumnGeographicRole: types.GeoSpatialDataRoleState},
+			}},
+		},
+		&types.TransformOperationMemberCreateColumnsOperation{
+			Value: types.CreateColumnsOperation{Columns: []types.CalculatedColumn{
+				{ColumnId: aws.String("c1"), ColumnName: aws.String("Region"), Expression: aws.String("ifelse({Prefecture} = 13, 'Kanto', 'Other')")},
+			}},
+		},
+		&types.TransformOperationMemberTagColumnOperation{
+			Value: types.TagColumnOperation{ColumnName: aws.String("Region"), Tags: []types.ColumnTag{
+				{ColumnDescription: &types.ColumnDescription{Text: aws.String("Region | area")}},
+			}},
+		},
+		&types.TransformOperationMemberProjectOperation{
+			Value: types.ProjectOperation{ProjectedColumns: []string{"id", "Prefecture", "Region"}},
+		},
+	)
+	dataSet.Name = aws.String("Users")
+	relationalTable := testRelationalTable(dataSet)
+	relationalTable.InputColumns = append(relationalTable.InputColumns, types.InputColumn{Name: aws.String("dw_hash"), Type: types.InputColumnDataTypeString})
+	dataSet.FieldFolders = map[string]types.FieldFolder{
+		"Address": {Columns: []string{"Prefecture"}},
+	}
+	dataSet.DatasetParameters = []types.DatasetParameter{
+		{StringDatasetParameter: &types.StringDatasetParameter{
+			Id: aws.String("p1"), Name: aws.String("Country"), ValueType: types.DatasetParameterValueTypeSingleValued,
+			DefaultValues: &types.StringDatasetParameterDefaultValues{StaticValues: []string{"JP"}},
+		}},
+	}
+	catalogs := map[string]*relationCatalog{
+		"physical": {
+			Comment: aws.String("Users of the service"),
+			Columns: ColumnAnnotations{
+				"id":        {CoumnName: "id", Name: aws.String("User ID"), DataType: aws.String("integer")},
+				"pref_code": {CoumnName: "pref_code", Name: aws.String("Prefecture"), Description: aws.String("JIS X 0401 code"), DataType: aws.String("character varying(2)")},
+				"dw_hash":   {CoumnName: "dw_hash", DataType: aws.String("character varying(64)")},
+			},
+		},
+	}
+	report := newDataSetReport(dataSet, catalogs)
+	if len(report.Sources) != 1 || report.Sources[0].Description != "Users of the service" {
+		t.Errorf("sources = %+v", report.Sources)
+	}
+	if len(report.Parameters) != 1 || report.Parameters[0].Type != "String" || strings.Join(report.Parameters[0].DefaultValues, ",") != "JP" {
+		t.Errorf("parameters = %+v", report.Parameters)
+	}
+	names := make([]string, 0, len(report.Fields))
+	for _, field := range report.Fields {
+		names = append(names, field.Name)
+	}
+	// without OutputColumns, the fields are sorted by name. dw_hash is hidden.
+	if got := strings.Join(names, ","); got != "Prefecture,Region,id" {
+		t.Errorf("fields = %s", got)
+	}
+	for _, field := range report.Fields {
+		switch field.Name {
+		case "Prefecture":
+			want := FieldReport{
+				Name:           "Prefecture",
+				Source:         "public.users.pref_code",
+				RedshiftType:   "character varying(2)",
+				Description:    "JIS X 0401 code",
+				CastType:       "INTEGER",
+				GeographicRole: "STATE",
+				Folder:         "Address",
+			}
+			if *field != want {
+				t.Errorf("Prefecture = %+v, want %+v", *field, want)
+			}
+		case "Region":
+			if !field.Calculated || field.Description != "Region | area" || field.Source != "" {
+				t.Errorf("Region = %+v", *field)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := renderMarkdownReport(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# Users",
+		"| `public.users` | warehouse | Users of the service |",
+		"| Country | String | SINGLE_VALUED | JP |",
+		"| Prefecture | `public.users.pref_code` | character varying(2) | JIS X 0401 code | INTEGER | STATE | Address |  |",
+		"| Region |  |  | Region \\| area |  |  |  | yes: `ifelse({Prefecture} = 13, 'Kanto', 'Other')` |",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("markdown does not contain %q:\n%s", want, buf.String())
+		}
+	}
+	buf.Reset()
+	if err := renderHTMLReport(&buf, []*DataSetReport{report}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `<a href="users.html">Users</a>`) {
+		t.Errorf("html index does not link the data set:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := renderHTMLReport(&buf, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<code>ifelse({Prefecture} = 13, &#39;Kanto&#39;, &#39;Other&#39;)</code>") {
+		t.Errorf("html does not contain the escaped expression:\n%s", buf.String())
+	}
+}
+
+func TestReportDataSetCatalogCache(t *testing.T) {
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users"))
+	app := newTestApp(t, client, io.Discard)
+	// the relation is read from the catalog cache, without connecting to Redshift
+	key := testArn("datasource/warehouse") + "/public.users"
+	app.catalog = &catalogCache{
+		columnAnnotations: map[string]ColumnAnnotations{
+			key: {"id": &ColumnAnnotation{CoumnName: "id", Name: aws.String("User ID")}},
+		},
+		tableComments: map[string]*string{key: aws.String("users of the service")},
+		observe:       func(time.Duration) { t.Error("Redshift is queried") },
+	}
+	report, err := app.ReportDataSet(context.Background(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sources) != 1 || report.Sources[0].Description != "users of the service" {
+		t.Errorf("sources = %+v, want the table comment", report.Sources)
+	}
+}
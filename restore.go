@@ -0,0 +1,67 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+type RestoreOption struct {
+	DataSetID string `help:"data set ID" required:""`
+	Backup    string `help:"backup file of the data set, local path or s3://bucket/key" required:""`
+	DryRun    bool   `help:"if true, no update data set and display plan"`
+	Verbose   bool   `help:"Outputs the input information for the UpdateDataSet API"`
+
+	OnConflict string `help:"Behavior when the data set is updated by someone else during restore" enum:"abort,replan" default:"abort"`
+	MaxReplan  int    `help:"Maximum number of attempts with --on-conflict=replan" default:"3"`
+
+	BackupOption    `embed:""`
+	IngestionOption `embed:""`
+}
+
+// annotateOption returns the options of annotate to update the data set with the same checks as annotate.
+func (opt *RestoreOption) annotateOption() *AnnotateOption {
+	return &AnnotateOption{
+		DryRun:          opt.DryRun,
+		Verbose:         opt.Verbose || opt.DryRun,
+		OnConflict:      opt.OnConflict,
+		MaxReplan:       opt.MaxReplan,
+		BackupOption:    opt.BackupOption,
+		IngestionOption: opt.IngestionOption,
+	}
+}
+
+// RunRestore updates the data set with the definition of the backup.
+// The current definition is backed up, and checked for concurrent updates before update in the same way as annotate.
+func (app *App) RunRestore(ctx context.Context, opt *RestoreOption) error {
+	if opt.DryRun {
+		log.Println("[info] ************* start dry run ****************")
+		defer log.Println("[info] *************  end dry run  ****************")
+	}
+	backup, err := app.LoadDataSetBackup(ctx, opt.BackupOption, opt.Backup)
+	if err != nil {
+		return err
+	}
+	if coalesce(backup.DataSet.DataSetId) != opt.DataSetID {
+		return fmt.Errorf("backup %s is for data set `%s`, not `%s`", opt.Backup, coalesce(backup.DataSet.DataSetId), opt.DataSetID)
+	}
+	log.Printf("[info] restore data set %s from backup at %s", opt.DataSetID, backup.BackedUpAt.Format("2006-01-02T15:04:05Z07:00"))
+	restored, err := DataSetFingerprint(backup.DataSet)
+	if err != nil {
+		return err
+	}
+	return app.updateDataSet(ctx, opt.annotateOption(), opt.DataSetID, func(dataSet *types.DataSet) (*quicksight.UpdateDataSetInput, map[string]string, bool, error) {
+		updateDataSetInput, err := NewUpdateDataSetInput(backup.DataSet)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("NewUpdateDataSetInput: %w", err)
+		}
+		current, err := DataSetFingerprint(dataSet)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		return updateDataSetInput, nil, current != restored, nil
+	})
+}
@@ -0,0 +1,176 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+var _ QuickSightClient = (*quicksighttest.Client)(nil)
+
+func TestRunRestore(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSet(testDataSet("example", testRename("id", "ID")))
+	app := newTestApp(t, client, io.Discard)
+	backupOpt := BackupOption{BackupLocation: t.TempDir()}
+	described, err := app.describeDataSet(ctx, aws.String(testAWSAccountID), "example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	location, err := app.BackupDataSet(ctx, backupOpt, described)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// someone renames the field in the console
+	broken, _ := client.DataSet(testAWSAccountID, "example")
+	logicalTable := broken.LogicalTableMap["logical"]
+	logicalTable.DataTransforms[0].(*types.TransformOperationMemberRenameColumnOperation).Value.NewColumnName = aws.String("user_id")
+	broken.LogicalTableMap["logical"] = logicalTable
+	client.PutDataSet(broken)
+
+	err = app.RunRestore(ctx, &RestoreOption{
+		DataSetID:    "example",
+		Backup:       location,
+		BackupOption: backupOpt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(client.Updates()); got != 1 {
+		t.Fatalf("UpdateDataSet called %d times, want 1", got)
+	}
+	restored, _ := client.DataSet(testAWSAccountID, "example")
+	if got := aws.ToString(restored.OutputColumns[0].Name); got != "ID" {
+		t.Errorf("restored output column = %s, want ID", got)
+	}
+}
+
+func TestRunRestoreConcurrentUpdate(t *testing.T) {
+	for _, onConflict := range []string{"abort", "replan"} {
+		t.Run(onConflict, func(t *testing.T) {
+			ctx := context.Background()
+			client := quicksighttest.NewClient()
+			client.PutDataSet(testDataSet("example", testRename("id", "ID")))
+			app := newTestApp(t, client, io.Discard)
+			backupOpt := BackupOption{BackupLocation: t.TempDir()}
+			described, err := app.describeDataSet(ctx, aws.String(testAWSAccountID), "example")
+			if err != nil {
+				t.Fatal(err)
+			}
+			location, err := app.BackupDataSet(ctx, backupOpt, described)
+			if err != nil {
+				t.Fatal(err)
+			}
+			broken, _ := client.DataSet(testAWSAccountID, "example")
+			broken.Name = aws.String("broken")
+			client.PutDataSet(broken)
+			// the data set is renamed again in the console right after restore describes it.
+			// describe 1 is the backup above, 2 is the plan of restore and 3 is the check before update.
+			client.UpdateAfterDescribe(testAWSAccountID, "example", 2, func(dataSet *types.DataSet) {
+				dataSet.Name = aws.String("renamed in the console")
+			})
+			err = app.RunRestore(ctx, &RestoreOption{
+				DataSetID:    "example",
+				Backup:       location,
+				OnConflict:   onConflict,
+				MaxReplan:    3,
+				BackupOption: backupOpt,
+			})
+			restored, _ := client.DataSet(testAWSAccountID, "example")
+			switch onConflict {
+			case "abort":
+				if !errors.Is(err, ErrConcurrentUpdate) {
+					t.Errorf("error = %v, want ErrConcurrentUpdate", err)
+				}
+				if n := len(client.Updates()); n != 0 {
+					t.Errorf("UpdateDataSet called %d times, want 0", n)
+				}
+			case "replan":
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := len(client.Updates()); n != 1 {
+					t.Errorf("UpdateDataSet called %d times, want 1", n)
+				}
+				if got := aws.ToString(restored.Name); got != "example" {
+					t.Errorf("restored name = %s, want example", got)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users", testRename("id", "ID")))
+	original, _ := client.DataSet(testAWSAccountID, "users")
+	app := newTestApp(t, client, io.Discard)
+	backupOpt := BackupOption{BackupLocation: t.TempDir()}
+	annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+	export := &DataSetExport{
+		DataSetID: "users",
+		Fields: []*FieldExport{
+			{Name: "User ID", Source: "public.users.id", Description: "ID of the user"},
+			{Name: "Prefecture", Source: "public.users.pref_code", GeographicRole: "STATE", Folder: "Address"},
+		},
+	}
+	if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := app.RunAnnotate(ctx, &AnnotateOption{
+		DataSetID:       "users",
+		AnnotationsFile: annotationsFile,
+		ForceRename:     true,
+		OnConflict:      "abort",
+		BackupOption:    backupOpt,
+		IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	annotated, _ := client.DataSet(testAWSAccountID, "users")
+	if reflect.DeepEqual(annotated.OutputColumns, original.OutputColumns) {
+		t.Fatal("the data set is not annotated")
+	}
+	backups, err := filepath.Glob(filepath.Join(backupOpt.BackupLocation, "users", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want 1 backup by annotate", backups)
+	}
+
+	err = app.RunRestore(ctx, &RestoreOption{
+		DataSetID:       "users",
+		Backup:          backups[0],
+		OnConflict:      "abort",
+		BackupOption:    backupOpt,
+		IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := client.DataSet(testAWSAccountID, "users")
+	want, err := DataSetFingerprint(original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DataSetFingerprint(restored); err != nil || got != want {
+		t.Errorf("restored data set = %s, want the original %s", marshalYAML(t, restored), marshalYAML(t, original))
+	}
+	if !reflect.DeepEqual(restored.OutputColumns, original.OutputColumns) {
+		t.Errorf("restored output columns = %+v, want %+v", restored.OutputColumns, original.OutputColumns)
+	}
+}
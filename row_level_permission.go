@@ -0,0 +1,84 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/samber/lo"
+)
+
+// DescribeRowLevelPermissionColumns returns the column names of the row-level security permissions data set.
+func (app *App) DescribeRowLevelPermissionColumns(ctx context.Context, dataSetArn string) ([]string, error) {
+	arnObj, err := arn.Parse(dataSetArn)
+	if err != nil {
+		return nil, err
+	}
+	if arnObj.Service != "quicksight" || !strings.HasPrefix(arnObj.Resource, "dataset/") {
+		return nil, fmt.Errorf("%s is not quicksight data set arn", dataSetArn)
+	}
+	output, err := app.client.DescribeDataSet(ctx, &quicksight.DescribeDataSetInput{
+		AwsAccountId: aws.String(arnObj.AccountID),
+		DataSetId:    aws.String(strings.TrimPrefix(arnObj.Resource, "dataset/")),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lo.Map(output.DataSet.OutputColumns, func(column types.OutputColumn, _ int) string {
+		return coalesce(column.Name)
+	}), nil
+}
+
+// checkRowLevelPermissionDataSet returns an error if a renamed column is referenced by the row-level security permissions data set.
+// The permissions data set is another data set, so it is not rewritten by annotate.
+func (app *App) checkRowLevelPermissionDataSet(ctx context.Context, rls *types.RowLevelPermissionDataSet, renamedColumns map[string]string) error {
+	if rls == nil || len(renamedColumns) == 0 {
+		return nil
+	}
+	permissionColumns, err := app.DescribeRowLevelPermissionColumns(ctx, coalesce(rls.Arn))
+	if err != nil {
+		return fmt.Errorf("row-level security permissions data set `%s`: %w", coalesce(rls.Arn), err)
+	}
+	oldColumnNames := lo.Keys(renamedColumns)
+	sort.Strings(oldColumnNames)
+	for _, oldColumnName := range oldColumnNames {
+		if !lo.Contains(permissionColumns, oldColumnName) {
+			continue
+		}
+		if rls.Status == types.StatusDisabled {
+			log.Printf("[warn] renamed column `%s` is referenced by the disabled row-level security permissions data set `%s`", oldColumnName, coalesce(rls.Arn))
+			continue
+		}
+		return fmt.Errorf(
+			"rename `%s` to `%s` breaks row-level security: the column is referenced by the permissions data set `%s`, rename the column of the permissions data set first",
+			oldColumnName, renamedColumns[oldColumnName], coalesce(rls.Arn),
+		)
+	}
+	return nil
+}
+
+// renameRowLevelPermissionTagRuleColumns rewrites the column name referenced by row-level security tag rules.
+// Reports whether the tag rules have been changed.
+func renameRowLevelPermissionTagRuleColumns(cfg *types.RowLevelPermissionTagConfiguration, oldColumnName, newColumnName string) bool {
+	if cfg == nil {
+		return false
+	}
+	var changed bool
+	cfg.TagRules = cloneSlice(cfg.TagRules)
+	for i, rule := range cfg.TagRules {
+		if coalesce(rule.ColumnName) != oldColumnName {
+			continue
+		}
+		rule.ColumnName = aws.String(newColumnName)
+		cfg.TagRules[i] = rule
+		log.Printf("[debug] change row-level security tag rule `%s` column `%s` to `%s`", coalesce(rule.TagKey), oldColumnName, newColumnName)
+		changed = true
+	}
+	return changed
+}
@@ -0,0 +1,101 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestCheckRowLevelPermissionDataSet(t *testing.T) {
+	client := quicksighttest.NewClient()
+	// the permissions data set has the columns id and pref_code
+	client.PutDataSet(testDataSet("permissions"))
+	app := newTestApp(t, client, io.Discard)
+	ctx := context.Background()
+	rls := &types.RowLevelPermissionDataSet{
+		Arn:              aws.String(testArn("dataset/permissions")),
+		PermissionPolicy: types.RowLevelPermissionPolicyGrantAccess,
+		Status:           types.StatusEnabled,
+	}
+	err := app.checkRowLevelPermissionDataSet(ctx, rls, map[string]string{"pref_code": "Prefecture"})
+	if err == nil || !strings.Contains(err.Error(), "rename `pref_code` to `Prefecture` breaks row-level security") {
+		t.Errorf("error = %v, want the rename breaks row-level security", err)
+	}
+	if err := app.checkRowLevelPermissionDataSet(ctx, rls, map[string]string{"dw_hash": "Hash"}); err != nil {
+		t.Errorf("rename the column not referenced: %s", err)
+	}
+	rls.Status = types.StatusDisabled
+	if err := app.checkRowLevelPermissionDataSet(ctx, rls, map[string]string{"pref_code": "Prefecture"}); err != nil {
+		t.Errorf("rename the column referenced by the disabled permissions data set: %s", err)
+	}
+}
+
+func TestAnnotateRowLevelPermission(t *testing.T) {
+	renamePrefCode := &DataSetExport{
+		DataSetID: "users",
+		Fields: []*FieldExport{
+			{Name: "Prefecture", Source: "public.users.pref_code"},
+		},
+	}
+	t.Run("permissions data set blocks rename", func(t *testing.T) {
+		client := quicksighttest.NewClient()
+		client.PutDataSource(testDataSource("warehouse"))
+		client.PutDataSet(testDataSet("permissions"))
+		dataSet := testDataSet("users")
+		dataSet.RowLevelPermissionDataSet = &types.RowLevelPermissionDataSet{
+			Arn:              aws.String(testArn("dataset/permissions")),
+			PermissionPolicy: types.RowLevelPermissionPolicyGrantAccess,
+			Status:           types.StatusEnabled,
+		}
+		client.PutDataSet(dataSet)
+		app := newTestApp(t, client, io.Discard)
+		annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+		if err := os.WriteFile(annotationsFile, marshalYAML(t, renamePrefCode), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := app.RunAnnotate(context.Background(), &AnnotateOption{
+			DataSetID:       "users",
+			AnnotationsFile: annotationsFile,
+			OnConflict:      "abort",
+			BackupOption:    BackupOption{NoBackup: true},
+			IngestionOption: IngestionOption{SpiceRefresh: "allow"},
+		})
+		if err == nil || !strings.Contains(err.Error(), "breaks row-level security") {
+			t.Errorf("error = %v, want the rename breaks row-level security", err)
+		}
+		if n := len(client.Updates()); n != 0 {
+			t.Errorf("updates = %d, want 0", n)
+		}
+	})
+	t.Run("tag rules follow rename", func(t *testing.T) {
+		client := quicksighttest.NewClient()
+		client.PutDataSource(testDataSource("warehouse"))
+		dataSet := testDataSet("users")
+		dataSet.RowLevelPermissionTagConfiguration = &types.RowLevelPermissionTagConfiguration{
+			Status: types.StatusEnabled,
+			TagRules: []types.RowLevelPermissionTagRule{
+				{ColumnName: aws.String("pref_code"), TagKey: aws.String("prefecture")},
+				{ColumnName: aws.String("id"), TagKey: aws.String("user")},
+			},
+		}
+		client.PutDataSet(dataSet)
+		app := newTestApp(t, client, io.Discard)
+		runTestAnnotate(t, app, renamePrefCode, &AnnotateOption{})
+
+		updated, _ := client.DataSet(testAWSAccountID, "users")
+		columns := make(map[string]string)
+		for _, rule := range updated.RowLevelPermissionTagConfiguration.TagRules {
+			columns[aws.ToString(rule.TagKey)] = aws.ToString(rule.ColumnName)
+		}
+		if columns["prefecture"] != "Prefecture" || columns["user"] != "id" {
+			t.Errorf("tag rule columns = %v, want prefecture=Prefecture user=id", columns)
+		}
+	})
+}
@@ -0,0 +1,231 @@
+package redshiftdatasetannotator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight"
+	"github.com/aws/aws-sdk-go-v2/service/quicksight/types"
+)
+
+type SyncOption struct {
+	AnnotateOption `embed:""`
+
+	Interval      time.Duration `help:"Interval between sync runs" default:"5m"`
+	MetricsListen string        `help:"Address to expose Prometheus metrics on /metrics, empty to disable" default:":8080"`
+}
+
+// catalogCache caches the column annotations (and the table comments, if read) during a sync run,
+// so that a relation used by many data sets is queried once.
+type catalogCache struct {
+	columnAnnotations map[string]ColumnAnnotations
+	tableComments     map[string]*string
+	observe           func(time.Duration)
+}
+
+// syncRunResult is the result of a sync run. err is the error of the run itself, e.g. listing the data sets.
+type syncRunResult struct {
+	scanned int
+	skipped int
+	updated int
+	failed  int
+	err     error
+}
+
+// RunSync re-runs annotate across the selected data sets every interval, until ctx is canceled.
+// Data sets whose column comments are not changed since the last successful run are skipped.
+func (app *App) RunSync(ctx context.Context, opt *SyncOption) error {
+	merged := *opt
+	merged.AnnotateOption = *app.settings.annotateOption(&opt.AnnotateOption)
+	opt = &merged
+	if err := opt.validate(); err != nil {
+		return err
+	}
+	if opt.RewriteFieldReferences && !opt.Yes {
+		return errors.New("sync can not confirm rewrites of field references, --rewrite-field-references requires --yes")
+	}
+	if opt.Interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	metrics := newSyncMetrics()
+	if opt.MetricsListen != "" {
+		ln, err := net.Listen("tcp", opt.MetricsListen)
+		if err != nil {
+			return fmt.Errorf("metrics listen: %w", err)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+		srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("[error] metrics server: %s", err)
+			}
+		}()
+		log.Printf("[info] expose metrics on http://%s/metrics", ln.Addr())
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Printf("[warn] metrics server shutdown: %s", err)
+			}
+		}()
+	}
+	if opt.DryRun {
+		log.Println("[info] dry run, the data sets are not updated")
+	}
+	log.Printf("[info] start sync every %s", opt.Interval)
+	fingerprints := make(map[string]string)
+	for {
+		result := app.syncOnce(ctx, &opt.AnnotateOption, fingerprints, metrics)
+		metrics.observeRun(result)
+		if result.err != nil {
+			log.Printf("[error] sync: %s", result.err)
+		}
+		log.Printf("[info] sync run finished scanned=%d skipped=%d updated=%d failed=%d", result.scanned, result.skipped, result.updated, result.failed)
+		timer := time.NewTimer(opt.Interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Printf("[info] stop sync: %s", context.Cause(ctx))
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// syncOnce annotates the selected data sets once. fingerprints holds the fingerprints of the column annotations
+// of the data sets synced successfully, and is updated.
+// Listing the data sets stops when ctx is canceled, but the data set in progress is finished,
+// as canceling it in the middle leaves the backup without update.
+func (app *App) syncOnce(ctx context.Context, opt *AnnotateOption, fingerprints map[string]string, metrics *syncMetrics) syncRunResult {
+	var result syncRunResult
+	// data sources and comments are re-read in each run
+	app.dataSrouceCache = make(map[string]*quicksight.DescribeDataSourceOutput)
+	app.catalog = &catalogCache{
+		columnAnnotations: make(map[string]ColumnAnnotations),
+		tableComments:     make(map[string]*string),
+		observe:           metrics.observeCatalogQuery,
+	}
+	defer func() {
+		app.catalog = nil
+	}()
+	dataSetIDs := []string{opt.DataSetID}
+	var failed []string
+	if opt.DataSourceID != "" {
+		var err error
+		dataSetIDs, failed, err = app.findDataSetsByDataSource(ctx, opt.DataSourceID, opt.Schema, opt.Table)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Println("[info] sync canceled while listing data sets")
+				return result
+			}
+			result.err = err
+			return result
+		}
+		// the data sets that failed to describe are counted as failed in this run
+		result.scanned += len(failed)
+		result.failed += len(failed)
+	}
+	for _, dataSetID := range dataSetIDs {
+		if ctx.Err() != nil {
+			log.Printf("[info] sync canceled, %d data set(s) are left", len(dataSetIDs)+len(failed)-result.scanned)
+			break
+		}
+		result.scanned++
+		skipped, updated, err := app.syncDataSet(context.WithoutCancel(ctx), opt, dataSetID, fingerprints)
+		switch {
+		case err != nil:
+			log.Printf("[error] data set %s: %s", dataSetID, err)
+			result.failed++
+		case skipped:
+			result.skipped++
+		case updated:
+			result.updated++
+		}
+	}
+	return result
+}
+
+// syncDataSet annotates the data set if its column annotations are changed, and reports whether it is skipped or updated.
+func (app *App) syncDataSet(ctx context.Context, opt *AnnotateOption, dataSetID string, fingerprints map[string]string) (bool, bool, error) {
+	described, err := app.describeDataSet(ctx, aws.String(app.AWSAccountID()), dataSetID)
+	if err != nil {
+		return false, false, err
+	}
+	var fileAnnotations *DataSetExport
+	if opt.AnnotationsFile != "" {
+		fileAnnotations, err = loadAnnotationsFile(opt.AnnotationsFile, dataSetID)
+		if err != nil {
+			return false, false, err
+		}
+	}
+	fingerprint, err := app.catalogFingerprint(ctx, described.DataSet, fileAnnotations)
+	if err != nil {
+		return false, false, err
+	}
+	if fingerprints[dataSetID] == fingerprint {
+		log.Printf("[debug] column comments of data set %s are not changed, fingerprint=%s", dataSetID, fingerprint)
+		return true, false, nil
+	}
+	before, err := DataSetFingerprint(described.DataSet)
+	if err != nil {
+		return false, false, err
+	}
+	log.Printf("[info] annotate data set %s", dataSetID)
+	if err := app.annotateDataSet(ctx, opt, dataSetID); err != nil {
+		return false, false, err
+	}
+	fingerprints[dataSetID] = fingerprint
+	latest, err := app.describeDataSet(ctx, aws.String(app.AWSAccountID()), dataSetID)
+	if err != nil {
+		return false, false, err
+	}
+	after, err := DataSetFingerprint(latest.DataSet)
+	if err != nil {
+		return false, false, err
+	}
+	return false, before != after, nil
+}
+
+// catalogFingerprint returns the fingerprint of the column annotations of the Redshift tables in the data set.
+func (app *App) catalogFingerprint(ctx context.Context, dataSet *types.DataSet, fileAnnotations *DataSetExport) (string, error) {
+	relations := make(map[string]ColumnAnnotations)
+	for physicalTableID, physicalTable := range dataSet.PhysicalTableMap {
+		relationalTable, ok := physicalTable.(*types.PhysicalTableMemberRelationalTable)
+		if !ok {
+			continue
+		}
+		describeDataSourceOutput, err := app.DescribeDataSrouce(ctx, coalesce(relationalTable.Value.DataSourceArn))
+		if err != nil {
+			return "", fmt.Errorf("physical table `%s`: %w", physicalTableID, err)
+		}
+		if describeDataSourceOutput.DataSource.Type != types.DataSourceTypeRedshift {
+			continue
+		}
+		var columnAnnotations ColumnAnnotations
+		if fileAnnotations != nil {
+			columnAnnotations = fileAnnotations.ColumnAnnotations(coalesce(relationalTable.Value.Schema), coalesce(relationalTable.Value.Name))
+		} else {
+			columnAnnotations, err = app.GetColumnAnnotations(ctx, describeDataSourceOutput.DataSource, relationalTable.Value)
+			if err != nil {
+				return "", fmt.Errorf("GetColumnAnnotations: %w", err)
+			}
+		}
+		relations[physicalTableID] = columnAnnotations
+	}
+	bs, err := json.Marshal(relations)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:]), nil
+}
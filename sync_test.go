@@ -0,0 +1,87 @@
+package redshiftdatasetannotator
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mashiike/redshift-data-set-annotator/quicksighttest"
+)
+
+func TestSyncOnce(t *testing.T) {
+	ctx := context.Background()
+	client := quicksighttest.NewClient()
+	client.PutDataSource(testDataSource("warehouse"))
+	client.PutDataSet(testDataSet("users"))
+	app := newTestApp(t, client, &bytes.Buffer{})
+	annotationsFile := filepath.Join(t.TempDir(), "users.yaml")
+	writeAnnotations := func(description string) {
+		t.Helper()
+		export := &DataSetExport{
+			DataSetID: "users",
+			Fields:    []*FieldExport{{Name: "id", Source: "public.users.id", Description: description}},
+		}
+		if err := os.WriteFile(annotationsFile, marshalYAML(t, export), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opt := &AnnotateOption{
+		DataSetID:              "users",
+		AnnotationsFile:        annotationsFile,
+		ForceUpdateDescription: true,
+		OnConflict:             "abort",
+		BackupOption:           BackupOption{NoBackup: true},
+		IngestionOption:        IngestionOption{SpiceRefresh: "allow"},
+	}
+	metrics := newSyncMetrics()
+	fingerprints := make(map[string]string)
+	syncOnce := func(ctx context.Context, want syncRunResult) {
+		t.Helper()
+		result := app.syncOnce(ctx, opt, fingerprints, metrics)
+		metrics.observeRun(result)
+		if result != want {
+			t.Fatalf("result = %+v, want %+v", result, want)
+		}
+	}
+
+	writeAnnotations("User ID")
+	syncOnce(ctx, syncRunResult{scanned: 1, updated: 1})
+	// the annotations are not changed, the data set is skipped.
+	syncOnce(ctx, syncRunResult{scanned: 1, skipped: 1})
+	writeAnnotations("ID of the user")
+	syncOnce(ctx, syncRunResult{scanned: 1, updated: 1})
+	if n := len(client.Updates()); n != 2 {
+		t.Errorf("updates = %d, want 2", n)
+	}
+
+	// a canceled context stops the run before the next data set.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	syncOnce(canceled, syncRunResult{})
+
+	var buf bytes.Buffer
+	metrics.observeCatalogQuery(300 * time.Millisecond)
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"rsdsa_sync_runs_total 4\n",
+		"rsdsa_sync_data_sets_scanned_total 3\n",
+		"rsdsa_sync_data_sets_skipped_total 1\n",
+		"rsdsa_sync_data_sets_updated_total 2\n",
+		"rsdsa_sync_data_sets_failed_total 0\n",
+		"# TYPE rsdsa_catalog_query_duration_seconds histogram\n",
+		"rsdsa_catalog_query_duration_seconds_bucket{le=\"0.25\"} 0\n",
+		"rsdsa_catalog_query_duration_seconds_bucket{le=\"0.5\"} 1\n",
+		"rsdsa_catalog_query_duration_seconds_bucket{le=\"+Inf\"} 1\n",
+		"rsdsa_catalog_query_duration_seconds_count 1\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics does not contain %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -1,25 +1,34 @@
 package redshiftdatasetannotator
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
+
+// standard endpoints, <cluster>.<id>.<region>.redshift.amazonaws.com and <workgroup>.<account>.<region>.redshift-serverless.amazonaws.com (or amazonaws.com.cn).
+var (
+	provisionedHostPattern = regexp.MustCompile(`^([^.]+)\.[^.]+\.[^.]+\.redshift\.amazonaws\.com(\.cn)?$`)
+	serverlessHostPattern  = regexp.MustCompile(`^([^.]+)\.[^.]+\.[^.]+\.redshift-serverless\.amazonaws\.com(\.cn)?$`)
+)
 
 func isProvisoned(hostname string) bool {
-	return strings.HasSuffix(hostname, "redshift.amazonaws.com")
+	return provisionedHostPattern.MatchString(strings.ToLower(hostname))
 }
 
 func getCluseterID(hostname string) string {
-	if isProvisoned(hostname) {
-		return strings.Split(hostname, ".")[0]
+	if m := provisionedHostPattern.FindStringSubmatch(strings.ToLower(hostname)); m != nil {
+		return m[1]
 	}
 	return ""
 }
 
 func isServeless(hostname string) bool {
-	return strings.HasSuffix(hostname, "redshift-serverless.amazonaws.com")
+	return serverlessHostPattern.MatchString(strings.ToLower(hostname))
 }
 
 func getWorkgroupName(hostname string) string {
-	if isServeless(hostname) {
-		return strings.Split(hostname, ".")[0]
+	if m := serverlessHostPattern.FindStringSubmatch(strings.ToLower(hostname)); m != nil {
+		return m[1]
 	}
 	return ""
 }
@@ -41,14 +50,6 @@ func nillif[T comparable](t, empty T) *T {
 	return &t
 }
 
-func clonePointer[T any](p *T) *T {
-	if p == nil {
-		return nil
-	}
-	cloned := *p
-	return &cloned
-}
-
 func cloneSlice[T any](s []T) []T {
 	if s == nil {
 		return nil
@@ -57,14 +58,3 @@ func cloneSlice[T any](s []T) []T {
 	copy(cloned, s)
 	return cloned
 }
-
-func cloneMap[T any](m map[string]T) map[string]T {
-	if m == nil {
-		return nil
-	}
-	cloned := make(map[string]T, len(m))
-	for key, value := range m {
-		cloned[key] = value
-	}
-	return cloned
-}